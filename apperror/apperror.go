@@ -0,0 +1,69 @@
+package apperror
+
+import (
+	"errors"
+)
+
+// Kind - Category of an application error, mapped to an HTTP status by the web layer
+type Kind int
+
+const (
+	// Internal for unexpected failures such as database outages
+	Internal Kind = iota
+	// InvalidArgument for missing or malformed input
+	InvalidArgument
+	// NotFound for missing resources
+	NotFound
+	// AlreadyExists for resources that must be unique
+	AlreadyExists
+	// Conflict for operations not allowed in the current state
+	Conflict
+	// Unauthenticated for missing or invalid credentials
+	Unauthenticated
+	// Forbidden for authenticated users without permission
+	Forbidden
+)
+
+// Error - Application error with a stable machine readable code
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+}
+
+// New implements
+func New(kind Kind, code, message string) *Error {
+	return &Error{
+		Kind:    kind,
+		Code:    code,
+		Message: message,
+	}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is matches errors with the same code, so a sentinel can be compared
+// with errors.Is even when it was wrapped
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// As returns the first *Error in the chain of err, or nil
+func As(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	return nil
+}
+
+// KindOf returns the kind of err, Internal for errors without one
+func KindOf(err error) Kind {
+	if appErr := As(err); appErr != nil {
+		return appErr.Kind
+	}
+	return Internal
+}
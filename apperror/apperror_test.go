@@ -0,0 +1,24 @@
+package apperror
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError(t *testing.T) {
+
+	errNotFound := New(NotFound, "store_not_found", "Não foi encontrado o estabelecimento")
+	wrapped := fmt.Errorf("GetStore: %w", errNotFound)
+
+	assert.True(t, errors.Is(wrapped, errNotFound))
+	assert.False(t, errors.Is(wrapped, New(NotFound, "consumer_not_found", "")))
+	assert.Equal(t, errNotFound, As(wrapped))
+	assert.Equal(t, NotFound, KindOf(wrapped))
+
+	assert.Nil(t, As(errors.New("mongo: connection refused")))
+	assert.Equal(t, Internal, KindOf(errors.New("mongo: connection refused")))
+
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/rokoga/filas-backend/apperror"
+)
+
+const (
+	// ErrorInvalidToken for malformed, tampered or expired tokens
+	ErrorInvalidToken = "Token de acesso inválido"
+)
+
+var (
+	// ErrInvalidToken for malformed, tampered or expired tokens
+	ErrInvalidToken = apperror.New(apperror.Unauthenticated, "invalid_token", ErrorInvalidToken)
+)
+
+// header of every token, HS256 JWT
+var header = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Claims - Payload of a staff token
+type Claims struct {
+	UserID    string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// TokenManager issues and verifies HMAC-signed JWTs
+type TokenManager struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewTokenManager implements
+func NewTokenManager(secret []byte, ttl time.Duration) *TokenManager {
+	return &TokenManager{
+		secret: secret,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+// Issue returns a signed token for the user
+func (m *TokenManager) Issue(userID string) (string, error) {
+	now := m.now()
+	claims := Claims{
+		UserID:    userID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(m.ttl).Unix(),
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	return unsigned + "." + m.sign(unsigned), nil
+}
+
+// Verify checks the signature and expiry of a token and returns its claims
+func (m *TokenManager) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != header {
+		return nil, ErrInvalidToken
+	}
+
+	signature := m.sign(parts[0] + "." + parts[1])
+	if !hmac.Equal([]byte(signature), []byte(parts[2])) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.UserID == "" || m.now().Unix() >= claims.ExpiresAt {
+		return nil, ErrInvalidToken
+	}
+
+	return &claims, nil
+}
+
+func (m *TokenManager) sign(unsigned string) string {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// HashPassword returns the bcrypt hash of a password
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether the password matches the bcrypt hash
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
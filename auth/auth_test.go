@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToken(t *testing.T) {
+
+	tokens := NewTokenManager([]byte("secret"), time.Hour)
+
+	token, err := tokens.Issue("user1")
+	assert.Nil(t, err)
+
+	claims, err := tokens.Verify(token)
+	assert.Nil(t, err)
+	assert.Equal(t, "user1", claims.UserID)
+
+	parts := strings.Split(token, ".")
+	tampered := parts[0] + "." + parts[1] + "x." + parts[2]
+
+	other := NewTokenManager([]byte("other secret"), time.Hour)
+
+	expired := NewTokenManager([]byte("secret"), time.Hour)
+	expired.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+	tests := []struct {
+		tokens *TokenManager
+		token  string
+	}{
+		{tokens: tokens, token: ""},
+		{tokens: tokens, token: "a.b.c"},
+		{tokens: tokens, token: tampered},
+		{tokens: other, token: token},
+		{tokens: expired, token: token},
+	}
+
+	for _, test := range tests {
+		claims, err := test.tokens.Verify(test.token)
+		assert.Equal(t, ErrInvalidToken, err)
+		assert.Nil(t, claims)
+	}
+
+}
+
+func TestPassword(t *testing.T) {
+
+	hash, err := HashPassword("senha-segura")
+	assert.Nil(t, err)
+	assert.NotEqual(t, "senha-segura", hash)
+
+	assert.True(t, CheckPassword(hash, "senha-segura"))
+	assert.False(t, CheckPassword(hash, "senha-errada"))
+	assert.False(t, CheckPassword("", "senha-segura"))
+
+}
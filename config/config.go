@@ -1,6 +1,172 @@
 package config
 
-import "github.com/spf13/viper"
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// defaults for every optional key
+var defaults = map[string]interface{}{
+	"address":                       ":8080",
+	"baseurl":                       "http://localhost:8080",
+	"dbdriver":                      "mongodb",
+	"dbport":                        "27017",
+	"dbuserscollection":             "users",
+	"dbqueuecollection":             "queue",
+	"dboutboxcollection":            "outbox",
+	"dbwebhookscollection":          "webhooks",
+	"dbwebhookdeliveriescollection": "webhookDeliveries",
+	"dbtimeout":                     "5s",
+	"dballowstandalone":             false,
+	"authtokenttl":                  "12h",
+	"readtimeout":                   "15s",
+	"writetimeout":                  "0s",
+	"shutdowntimeout":               "15s",
+	"draindelay":                    "0s",
+	"loglevel":                      "info",
+	"featurestreaming":              true,
+	"featureregistration":           true,
+	"notifyprovider":                "none",
+	"notifychannel":                 "sms",
+	"notifytimeout":                 "10s",
+	"notifynearfront":               2,
+	"notifypollinterval":            "2s",
+	"notifybackoff":                 "5s",
+	"notifymaxbackoff":              "15m",
+	"notifymaxattempts":             8,
+	"webhooktimeout":                "10s",
+	"webhookpollinterval":           "2s",
+	"webhookbackoff":                "10s",
+	"webhookmaxbackoff":             "1h",
+	"webhookmaxattempts":            10,
+	"webhookallowprivate":           false,
+}
+
+// Config - Application configuration
+type Config struct {
+	Server   ServerConfig
+	Database DatabaseConfig
+	Auth     AuthConfig
+	Features FeatureConfig
+	Log      LogConfig
+	Notify   NotifyConfig
+	Webhook  WebhookConfig
+}
+
+// ServerConfig - HTTP server configuration
+type ServerConfig struct {
+	// Address the server listens on, e.g. ":8080"
+	Address string
+	// BaseURL is the public URL used in the links sent to consumers
+	BaseURL string
+	// ReadTimeout bounds reading a whole request
+	ReadTimeout time.Duration
+	// WriteTimeout bounds writing a response, zero keeps streams open
+	WriteTimeout time.Duration
+	// ShutdownTimeout bounds draining in-flight requests on shutdown
+	ShutdownTimeout time.Duration
+	// DrainDelay is how long readiness fails before the server stops accepting connections
+	DrainDelay time.Duration
+	// MetricsToken is the bearer token scrapers send to /metrics, which is
+	// not served when empty
+	MetricsToken string
+}
+
+// DatabaseConfig - MongoDB configuration
+type DatabaseConfig struct {
+	Driver          string
+	Host            string
+	Port            string
+	User            string
+	Password        string
+	Name            string
+	Collection      string
+	UsersCollection string
+	// QueueCollection holds one document per consumer in a store queue
+	QueueCollection string
+	// OutboxCollection holds the messages waiting to be sent to consumers
+	OutboxCollection string
+	// WebhooksCollection holds the webhooks of the stores and
+	// WebhookDeliveriesCollection the events sent to them
+	WebhooksCollection          string
+	WebhookDeliveriesCollection string
+	// Timeout bounds connecting and every database operation
+	Timeout time.Duration
+	// AllowStandalone lets the server run on a database without
+	// transactions, writing queue changes and their messages one after the
+	// other. Meant for development only.
+	AllowStandalone bool
+}
+
+// AuthConfig - Staff authentication configuration
+type AuthConfig struct {
+	Secret   string
+	TokenTTL time.Duration
+	// Admins are the IDs of the users allowed to assign an owner to the
+	// stores created before stores had one
+	Admins []string
+}
+
+// LogConfig - Logging configuration
+type LogConfig struct {
+	// Level is one of debug, info, warn or error
+	Level string
+}
+
+// NotifyConfig - Messages sent to consumers about their place in the queue
+type NotifyConfig struct {
+	// Provider is none, file or http
+	Provider string
+	// File receives the messages of the file provider, stdout when empty
+	File string
+	// URL, Token and Channel configure the http gateway, Channel is sms or whatsapp
+	URL     string
+	Token   string
+	Channel string
+	// Timeout bounds each request to the gateway
+	Timeout time.Duration
+	// NearFront is how many consumers are left ahead when the near front
+	// message is sent
+	NearFront int
+	// PollInterval is how often the outbox is checked for messages to send
+	PollInterval time.Duration
+	// Backoff is the wait before retrying a failed message, doubled on
+	// every failure up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// MaxAttempts is how many failures move a message to the dead letters
+	MaxAttempts int
+}
+
+// WebhookConfig - Queue events posted to the endpoints of store integrations
+type WebhookConfig struct {
+	// Timeout bounds each request to an endpoint
+	Timeout time.Duration
+	// PollInterval is how often the deliveries are checked for events to post
+	PollInterval time.Duration
+	// Backoff is the wait before retrying a failed delivery, doubled on
+	// every failure up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// MaxAttempts is how many failures move a delivery to the dead letters
+	MaxAttempts int
+	// AllowPrivate lets webhooks point to loopback, private and link-local
+	// addresses. Meant for local development only.
+	AllowPrivate bool
+}
+
+// FeatureConfig - Feature flags
+type FeatureConfig struct {
+	// Streaming enables the Server-Sent Events routes
+	Streaming bool
+	// Registration enables creating staff accounts through the API
+	Registration bool
+}
 
 // ReadConfig retun .env parameters configuration
 func ReadConfig(filename string, defaults map[string]interface{}) (*viper.Viper, error) {
@@ -19,3 +185,168 @@ func ReadConfig(filename string, defaults map[string]interface{}) (*viper.Viper,
 
 	return v, nil
 }
+
+// Load reads the configuration file, applies environment overrides and
+// validates the result
+func Load(filename string) (*Config, error) {
+	v, err := ReadConfig(filename, defaults)
+	if err != nil {
+		return nil, fmt.Errorf("Erro ao ler o arquivo de configuração: %v", err)
+	}
+
+	cfg := &Config{
+		Server: ServerConfig{
+			Address:         v.GetString("address"),
+			BaseURL:         strings.TrimSuffix(v.GetString("baseurl"), "/"),
+			ReadTimeout:     v.GetDuration("readtimeout"),
+			WriteTimeout:    v.GetDuration("writetimeout"),
+			ShutdownTimeout: v.GetDuration("shutdowntimeout"),
+			DrainDelay:      v.GetDuration("draindelay"),
+			MetricsToken:    v.GetString("metricstoken"),
+		},
+		Database: DatabaseConfig{
+			Driver:                      v.GetString("dbdriver"),
+			Host:                        v.GetString("dbhost"),
+			Port:                        v.GetString("dbport"),
+			User:                        v.GetString("dbuser"),
+			Password:                    v.GetString("dbpass"),
+			Name:                        v.GetString("dbname"),
+			Collection:                  v.GetString("dbcollection"),
+			UsersCollection:             v.GetString("dbuserscollection"),
+			QueueCollection:             v.GetString("dbqueuecollection"),
+			OutboxCollection:            v.GetString("dboutboxcollection"),
+			WebhooksCollection:          v.GetString("dbwebhookscollection"),
+			WebhookDeliveriesCollection: v.GetString("dbwebhookdeliveriescollection"),
+			Timeout:                     v.GetDuration("dbtimeout"),
+			AllowStandalone:             v.GetBool("dballowstandalone"),
+		},
+		Auth: AuthConfig{
+			Secret:   v.GetString("authsecret"),
+			TokenTTL: v.GetDuration("authtokenttl"),
+			Admins:   splitList(v.GetString("authadmins")),
+		},
+		Features: FeatureConfig{
+			Streaming:    v.GetBool("featurestreaming"),
+			Registration: v.GetBool("featureregistration"),
+		},
+		Log: LogConfig{
+			Level: strings.ToLower(v.GetString("loglevel")),
+		},
+		Notify: NotifyConfig{
+			Provider:     strings.ToLower(v.GetString("notifyprovider")),
+			File:         v.GetString("notifyfile"),
+			URL:          v.GetString("notifyurl"),
+			Token:        v.GetString("notifytoken"),
+			Channel:      strings.ToLower(v.GetString("notifychannel")),
+			Timeout:      v.GetDuration("notifytimeout"),
+			NearFront:    v.GetInt("notifynearfront"),
+			PollInterval: v.GetDuration("notifypollinterval"),
+			Backoff:      v.GetDuration("notifybackoff"),
+			MaxBackoff:   v.GetDuration("notifymaxbackoff"),
+			MaxAttempts:  v.GetInt("notifymaxattempts"),
+		},
+		Webhook: WebhookConfig{
+			Timeout:      v.GetDuration("webhooktimeout"),
+			PollInterval: v.GetDuration("webhookpollinterval"),
+			Backoff:      v.GetDuration("webhookbackoff"),
+			MaxBackoff:   v.GetDuration("webhookmaxbackoff"),
+			MaxAttempts:  v.GetInt("webhookmaxattempts"),
+			AllowPrivate: v.GetBool("webhookallowprivate"),
+		},
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// splitList reads a comma separated setting, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// Validate reports the first invalid setting
+func (cfg *Config) Validate() error {
+	if cfg.Server.Address == "" {
+		return errors.New("address deve ser configurado")
+	}
+
+	u, err := url.Parse(cfg.Server.BaseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("baseurl deve ser uma URL http(s) absoluta: %q", cfg.Server.BaseURL)
+	}
+
+	if cfg.Database.Host == "" || cfg.Database.Name == "" || cfg.Database.Collection == "" || cfg.Database.UsersCollection == "" || cfg.Database.QueueCollection == "" || cfg.Database.OutboxCollection == "" {
+		return errors.New("dbhost, dbname, dbcollection, dbuserscollection, dbqueuecollection e dboutboxcollection devem ser configurados")
+	}
+
+	if cfg.Database.WebhooksCollection == "" || cfg.Database.WebhookDeliveriesCollection == "" {
+		return errors.New("dbwebhookscollection e dbwebhookdeliveriescollection devem ser configurados")
+	}
+
+	if cfg.Auth.Secret == "" {
+		return errors.New("authsecret deve ser configurado")
+	}
+
+	if cfg.Database.Timeout <= 0 || cfg.Auth.TokenTTL <= 0 || cfg.Server.ShutdownTimeout <= 0 {
+		return errors.New("dbtimeout, authtokenttl e shutdowntimeout devem ser positivos")
+	}
+
+	if cfg.Server.ReadTimeout < 0 || cfg.Server.WriteTimeout < 0 || cfg.Server.DrainDelay < 0 {
+		return errors.New("readtimeout, writetimeout e draindelay não podem ser negativos")
+	}
+
+	switch cfg.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("loglevel deve ser debug, info, warn ou error: %q", cfg.Log.Level)
+	}
+
+	switch cfg.Notify.Provider {
+	case "none", "file":
+	case "http":
+		u, err := url.Parse(cfg.Notify.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("notifyurl deve ser uma URL http(s) absoluta: %q", cfg.Notify.URL)
+		}
+	default:
+		return fmt.Errorf("notifyprovider deve ser none, file ou http: %q", cfg.Notify.Provider)
+	}
+
+	if cfg.Notify.Channel != "sms" && cfg.Notify.Channel != "whatsapp" {
+		return fmt.Errorf("notifychannel deve ser sms ou whatsapp: %q", cfg.Notify.Channel)
+	}
+
+	if cfg.Notify.Timeout <= 0 || cfg.Notify.NearFront < 0 {
+		return errors.New("notifytimeout deve ser positivo e notifynearfront não pode ser negativo")
+	}
+
+	if cfg.Notify.PollInterval <= 0 || cfg.Notify.Backoff <= 0 || cfg.Notify.MaxBackoff < cfg.Notify.Backoff || cfg.Notify.MaxAttempts < 1 {
+		return errors.New("notifypollinterval, notifybackoff e notifymaxattempts devem ser positivos e notifymaxbackoff não pode ser menor que notifybackoff")
+	}
+
+	if cfg.Webhook.Timeout <= 0 || cfg.Webhook.PollInterval <= 0 || cfg.Webhook.Backoff <= 0 || cfg.Webhook.MaxBackoff < cfg.Webhook.Backoff || cfg.Webhook.MaxAttempts < 1 {
+		return errors.New("webhooktimeout, webhookpollinterval, webhookbackoff e webhookmaxattempts devem ser positivos e webhookmaxbackoff não pode ser menor que webhookbackoff")
+	}
+
+	return nil
+}
+
+// URI returns the MongoDB connection string
+func (db DatabaseConfig) URI() string {
+	if db.User == "" {
+		return fmt.Sprintf("%s://%s:%s", db.Driver, db.Host, db.Port)
+	}
+
+	return fmt.Sprintf("%s://%s:%s@%s:%s", db.Driver,
+		url.QueryEscape(db.User), url.QueryEscape(db.Password), db.Host, db.Port)
+}
@@ -1,9 +1,41 @@
 package domain
 
+import "time"
+
 // Consumer - Consumer domain
 type Consumer struct {
-	Name      string `bson:"name,omitempty" json:"name"`
-	Phone     string `bson:"phone,omitempty" json:"phone"`
-	Accesskey string `bson:"accessKey,omitempty" json:"accessKey"`
-	Status    string `bson:"status,omitempty" json:"status"`
+	// ID identifies the consumer in routes and logs instead of the phone
+	ID string `bson:"_id,omitempty" json:"id"`
+	// StoreID is the store whose queue the consumer joined
+	StoreID string `bson:"storeId,omitempty" json:"-"`
+	// QueueID is the queue of the store the consumer joined, empty for the
+	// default queue
+	QueueID string `bson:"queueId,omitempty" json:"queueId"`
+	Name    string `bson:"name,omitempty" json:"name"`
+	Phone   string `bson:"phone,omitempty" json:"phone"`
+	// PartySize is how many people the consumer brings, including themselves
+	PartySize int            `bson:"partySize,omitempty" json:"partySize"`
+	Accesskey string         `bson:"accessKey,omitempty" json:"accessKey"`
+	Status    ConsumerStatus `bson:"status,omitempty" json:"status"`
+	JoinedAt  *time.Time     `bson:"joinedAt,omitempty" json:"joinedAt,omitempty"`
+	CalledAt  *time.Time     `bson:"calledAt,omitempty" json:"calledAt,omitempty"`
+	ServedAt  *time.Time     `bson:"servedAt,omitempty" json:"servedAt,omitempty"`
+	// AccessKeyExpiresAt is set once the consumer leaves the queue or the key is revoked
+	AccessKeyExpiresAt *time.Time `bson:"accessKeyExpiresAt,omitempty" json:"accessKeyExpiresAt,omitempty"`
+	// EstimatedWaitSeconds is computed by the service and never persisted
+	EstimatedWaitSeconds int64 `bson:"-" json:"estimatedWaitSeconds"`
+}
+
+// Party returns the party size, one for consumers that joined before it was
+// asked
+func (c *Consumer) Party() int {
+	if c.PartySize < 1 {
+		return 1
+	}
+	return c.PartySize
+}
+
+// AccessKeyExpired reports whether the access key can no longer be used
+func (c *Consumer) AccessKeyExpired(now time.Time) bool {
+	return c.AccessKeyExpiresAt != nil && !now.Before(*c.AccessKeyExpiresAt)
 }
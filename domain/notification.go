@@ -0,0 +1,89 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// NotificationKind - Moment of the queue a consumer is told about
+type NotificationKind string
+
+const (
+	// NotifyJoined is sent when the consumer joins, with the access URL
+	NotifyJoined NotificationKind = "joined"
+	// NotifyNearFront is sent when few consumers are left ahead
+	NotifyNearFront NotificationKind = "near_front"
+	// NotifyCalled is sent when the store calls the consumer
+	NotifyCalled NotificationKind = "called"
+	// NotifyRemoved is sent when the staff removes the consumer
+	NotifyRemoved NotificationKind = "removed"
+	// NotifyNoShow is sent when the consumer missed the call and lost the place
+	NotifyNoShow NotificationKind = "no_show"
+)
+
+// DefaultTemplates are used for the kinds a store did not customize
+var DefaultTemplates = map[NotificationKind]string{
+	NotifyJoined:    "Olá {{.Name}}, você entrou na fila de {{.Store}} na posição {{.Position}}. Acompanhe em {{.URL}}",
+	NotifyNearFront: "{{.Name}}, falta pouco! Há {{.Ahead}} pessoa(s) na sua frente na fila de {{.Store}}. Acompanhe em {{.URL}}",
+	NotifyCalled:    "{{.Name}}, chegou a sua vez! Dirija-se ao atendimento de {{.Store}}.",
+	NotifyRemoved:   "{{.Name}}, você foi removido da fila de {{.Store}}.",
+	NotifyNoShow:    "{{.Name}}, você não compareceu ao ser chamado e saiu da fila de {{.Store}}.",
+}
+
+// NotificationData - Fields available to the message templates
+type NotificationData struct {
+	Store string
+	// Queue is the name of the queue the consumer joined
+	Queue string
+	Name  string
+	// Position is the place in line starting at 1, Ahead the consumers before
+	Position int
+	Ahead    int
+	// URL is the access URL of the consumer
+	URL string
+}
+
+// Message renders the message of the given kind with the store template,
+// or the default one
+func (s *Store) Message(kind NotificationKind, data NotificationData) (string, error) {
+	text, ok := s.MessageTemplates[kind]
+	if !ok {
+		text = DefaultTemplates[kind]
+	}
+
+	tmpl, err := template.New(string(kind)).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// validateTemplates checks that every template is of a known kind and
+// renders with sample data
+func validateTemplates(templates map[NotificationKind]string) error {
+	sample := NotificationData{Store: "Loja", Queue: "Caixa", Name: "Fulano", Position: 3, Ahead: 2, URL: "https://filas.app/loja/chave"}
+
+	for kind, text := range templates {
+		field := fmt.Sprintf("messageTemplates.%s", kind)
+		if _, ok := DefaultTemplates[kind]; !ok {
+			return &SettingsError{Field: field, Reason: "tipo de mensagem desconhecido"}
+		}
+
+		tmpl, err := template.New(string(kind)).Parse(text)
+		if err != nil {
+			return &SettingsError{Field: field, Reason: "modelo inválido"}
+		}
+		if err := tmpl.Execute(&strings.Builder{}, sample); err != nil {
+			return &SettingsError{Field: field, Reason: "modelo usa um campo desconhecido"}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package domain
+
+import "time"
+
+// DeliveryStatus - Delivery state of a message in the outbox or of a webhook
+// delivery
+type DeliveryStatus string
+
+const (
+	// DeliveryPending is waiting for its first or next attempt
+	DeliveryPending DeliveryStatus = "pending"
+	// DeliverySent was accepted by the provider or the webhook endpoint
+	DeliverySent DeliveryStatus = "sent"
+	// DeliveryDead gave up after too many attempts
+	DeliveryDead DeliveryStatus = "dead"
+)
+
+// OutboxMessage - A message to a consumer, stored until it is delivered
+type OutboxMessage struct {
+	ID         string           `bson:"_id,omitempty" json:"id"`
+	StoreID    string           `bson:"storeId" json:"storeId"`
+	ConsumerID string           `bson:"consumerId" json:"consumerId"`
+	Kind       NotificationKind `bson:"kind" json:"kind"`
+	To         string           `bson:"to" json:"to"`
+	Body       string           `bson:"body" json:"body"`
+	Status     DeliveryStatus   `bson:"status" json:"status"`
+	Attempts   int              `bson:"attempts" json:"attempts"`
+	LastError  string           `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	CreatedAt  time.Time        `bson:"createdAt" json:"createdAt"`
+	// NextAttemptAt is when a pending message is sent next
+	NextAttemptAt time.Time `bson:"nextAttemptAt" json:"nextAttemptAt"`
+	// LockedUntil keeps other workers away while one sends the message
+	LockedUntil *time.Time `bson:"lockedUntil,omitempty" json:"-"`
+	SentAt      *time.Time `bson:"sentAt,omitempty" json:"sentAt,omitempty"`
+}
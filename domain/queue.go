@@ -0,0 +1,135 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rokoga/filas-backend/slug"
+)
+
+const (
+	// DefaultQueueID is the queue every store has. Consumers that joined
+	// before stores had several queues belong to it.
+	DefaultQueueID = "principal"
+	// DefaultQueueName is the name of the default queue until it is renamed
+	DefaultQueueName = "Principal"
+)
+
+// Queue - A named line of a store, such as "Caixa" or "Retirada"
+type Queue struct {
+	// ID is made from the name when the queue is created and kept on renames
+	ID   string `bson:"id" json:"id"`
+	Name string `bson:"name" json:"name"`
+	// Settings replace the ones of the store for this queue when set
+	Settings *QueueSettings `bson:"settings,omitempty" json:"settings,omitempty"`
+	// Length is computed by the service and never persisted
+	Length int `bson:"-" json:"length"`
+}
+
+// QueueList returns the queues of the store. Stores created before they
+// could have several queues only have the default one.
+func (s *Store) QueueList() []Queue {
+	if len(s.Queues) == 0 {
+		return []Queue{{ID: DefaultQueueID, Name: DefaultQueueName}}
+	}
+	return s.Queues
+}
+
+// FindQueue returns the queue of the store with the ID, nil when there is none
+func (s *Store) FindQueue(id string) *Queue {
+	queues := s.QueueList()
+	for i := range queues {
+		if queues[i].ID == id {
+			return &queues[i]
+		}
+	}
+	return nil
+}
+
+// SettingsOf returns the settings of the queue, the ones of the store unless
+// the queue has its own
+func (s *Store) SettingsOf(queueID string) QueueSettings {
+	if queue := s.FindQueue(queueID); queue != nil && queue.Settings != nil {
+		return *queue.Settings
+	}
+	return s.Settings
+}
+
+// Waiting returns the consumers of the queue waiting to be called, in the
+// order they joined
+func (s *Store) Waiting(queueID string) []*Consumer {
+	waiting := []*Consumer{}
+	for _, consumer := range s.Queue {
+		if consumer.Status == StatusWaiting && consumer.InQueue(queueID) {
+			waiting = append(waiting, consumer)
+		}
+	}
+	return waiting
+}
+
+// JoinedQueue returns the ID of the queue the consumer joined
+func (c *Consumer) JoinedQueue() string {
+	if c.QueueID == "" {
+		return DefaultQueueID
+	}
+	return c.QueueID
+}
+
+// InQueue reports whether the consumer joined the queue with the ID
+func (c *Consumer) InQueue(queueID string) bool {
+	return c.JoinedQueue() == queueID
+}
+
+// validateQueues checks the queues replacing the ones of store and fills in
+// the IDs of the new ones. The default queue cannot be removed, nor a queue
+// with consumers still waiting or called.
+func validateQueues(store *Store, queues []Queue) ([]Queue, error) {
+	result := make([]Queue, 0, len(queues))
+	seen := map[string]bool{}
+
+	for _, queue := range queues {
+		queue.Name = strings.TrimSpace(queue.Name)
+		if queue.Name == "" {
+			return nil, &SettingsError{Field: "queues.name", Reason: "não pode ser vazio"}
+		}
+
+		if queue.ID == "" {
+			queue.ID = slug.Make(queue.Name)
+			if queue.ID == "" {
+				return nil, &SettingsError{Field: "queues.name", Reason: fmt.Sprintf("nome inválido \"%s\"", queue.Name)}
+			}
+		}
+		if seen[queue.ID] {
+			return nil, &SettingsError{Field: "queues.id", Reason: fmt.Sprintf("fila \"%s\" repetida", queue.ID)}
+		}
+		seen[queue.ID] = true
+
+		if queue.Settings != nil {
+			if err := queue.Settings.validate("queues.settings"); err != nil {
+				return nil, err
+			}
+			settings := *queue.Settings
+			queue.Settings = &settings
+		}
+
+		queue.Length = 0
+		result = append(result, queue)
+	}
+
+	if !seen[DefaultQueueID] {
+		return nil, &SettingsError{Field: "queues", Reason: "a fila principal não pode ser removida"}
+	}
+
+	for _, consumer := range store.Queue {
+		if !consumer.Status.Active() {
+			continue
+		}
+		for _, queue := range store.QueueList() {
+			if consumer.InQueue(queue.ID) && !seen[queue.ID] {
+				return nil, &SettingsError{Field: "queues", Reason: fmt.Sprintf("a fila \"%s\" ainda tem consumidores", queue.Name)}
+			}
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,176 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rokoga/filas-backend/apperror"
+)
+
+// QueueMode - Manual switch of a store queue
+type QueueMode string
+
+const (
+	// ModeAuto follows the opening hours. A store without opening hours is
+	// always open.
+	ModeAuto QueueMode = "auto"
+	// ModeOpen takes new consumers outside the opening hours
+	ModeOpen QueueMode = "open"
+	// ModePaused stops new consumers for a while, the queue is still served
+	ModePaused QueueMode = "paused"
+	// ModeClosed stops new consumers until the queue is opened again
+	ModeClosed QueueMode = "closed"
+)
+
+// Valid reports whether the mode is one of the known modes
+func (m QueueMode) Valid() bool {
+	switch m {
+	case ModeAuto, ModeOpen, ModePaused, ModeClosed:
+		return true
+	}
+	return false
+}
+
+// QueueStatus - Whether a store queue takes new consumers
+type QueueStatus string
+
+const (
+	// QueueOpen takes new consumers
+	QueueOpen QueueStatus = "open"
+	// QueuePaused was paused by the staff
+	QueuePaused QueueStatus = "paused"
+	// QueueClosed is outside the opening hours or was closed by the staff
+	QueueClosed QueueStatus = "closed"
+)
+
+// QueueState - Current state of a store queue
+type QueueState struct {
+	Status QueueStatus `json:"status"`
+	// NextOpening is when the queue takes consumers again. It is unknown
+	// for a queue closed or paused by the staff without an end.
+	NextOpening *time.Time `json:"nextOpening,omitempty"`
+}
+
+var (
+	// ErrQueueClosed for joins while the queue is closed
+	ErrQueueClosed = apperror.New(apperror.Conflict, "queue_closed", "A fila do estabelecimento está fechada")
+	// ErrQueuePaused for joins while the queue is paused
+	ErrQueuePaused = apperror.New(apperror.Conflict, "queue_paused", "A fila do estabelecimento está pausada")
+)
+
+// QueueClosedError - Error for a join while the queue does not take consumers
+type QueueClosedError struct {
+	State QueueState
+}
+
+func (e *QueueClosedError) Error() string {
+	message := e.sentinel().Message
+	if e.State.NextOpening == nil {
+		return message
+	}
+	return fmt.Sprintf("%s, abre novamente em %s", message, e.State.NextOpening.Format("02/01 às 15:04"))
+}
+
+// Unwrap allows errors.Is(err, ErrQueueClosed) and errors.Is(err, ErrQueuePaused)
+func (e *QueueClosedError) Unwrap() error {
+	return e.sentinel()
+}
+
+// Details returns the state of the queue for the client
+func (e *QueueClosedError) Details() map[string]interface{} {
+	details := map[string]interface{}{"status": e.State.Status}
+	if e.State.NextOpening != nil {
+		details["nextOpening"] = e.State.NextOpening
+	}
+	return details
+}
+
+func (e *QueueClosedError) sentinel() *apperror.Error {
+	if e.State.Status == QueuePaused {
+		return ErrQueuePaused
+	}
+	return ErrQueueClosed
+}
+
+// QueueState returns the state of the queue at the given time. The manual
+// mode comes first, and a pause with an end follows the opening hours again
+// once it is over.
+func (s *Store) QueueState(now time.Time) QueueState {
+	switch s.Mode {
+	case ModeOpen:
+		return QueueState{Status: QueueOpen}
+	case ModeClosed:
+		return QueueState{Status: QueueClosed}
+	case ModePaused:
+		if s.PausedUntil == nil || now.Before(*s.PausedUntil) {
+			return QueueState{Status: QueuePaused, NextOpening: s.PausedUntil}
+		}
+	}
+
+	if s.OpeningHours == nil || len(s.OpeningHours.Periods) == 0 || s.OpeningHours.Contains(now) {
+		return QueueState{Status: QueueOpen}
+	}
+
+	return QueueState{Status: QueueClosed, NextOpening: s.OpeningHours.NextOpening(now)}
+}
+
+// IsOpen reports whether the store takes new consumers at the given time
+func (s *Store) IsOpen(now time.Time) bool {
+	return s.QueueState(now).Status == QueueOpen
+}
+
+// Contains reports whether the time falls in one of the periods
+func (h *OpeningHours) Contains(now time.Time) bool {
+	local := now.In(h.location())
+	minute := local.Hour()*60 + local.Minute()
+
+	for _, period := range h.Periods {
+		if period.Weekday != local.Weekday() {
+			continue
+		}
+		open, okOpen := parseClock(period.Open)
+		closing, okClose := parseClock(period.Close)
+		if okOpen && okClose && minute >= open && minute < closing {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NextOpening returns the start of the first period after the given time,
+// in the store timezone, or nil if there is none in the coming week
+func (h *OpeningHours) NextOpening(now time.Time) *time.Time {
+	loc := h.location()
+	local := now.In(loc)
+
+	for day := 0; day <= 7; day++ {
+		date := local.AddDate(0, 0, day)
+
+		var next *time.Time
+		for _, period := range h.Periods {
+			open, ok := parseClock(period.Open)
+			if period.Weekday != date.Weekday() || !ok {
+				continue
+			}
+			start := time.Date(date.Year(), date.Month(), date.Day(), open/60, open%60, 0, 0, loc)
+			if start.After(now) && (next == nil || start.Before(*next)) {
+				next = &start
+			}
+		}
+		if next != nil {
+			return next
+		}
+	}
+
+	return nil
+}
+
+// location falls back to UTC for a timezone that no longer loads
+func (h *OpeningHours) location() *time.Location {
+	loc, err := time.LoadLocation(h.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueState(t *testing.T) {
+
+	loc, err := time.LoadLocation("America/Sao_Paulo")
+	assert.Nil(t, err)
+
+	// January 1st, 2024 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.January, day, hour, minute, 0, 0, loc)
+	}
+	ptr := func(t time.Time) *time.Time { return &t }
+
+	hours := &OpeningHours{Timezone: "America/Sao_Paulo", Periods: []OpeningPeriod{
+		{Weekday: time.Monday, Open: "09:00", Close: "12:00"},
+		{Weekday: time.Monday, Open: "13:00", Close: "18:00"},
+		{Weekday: time.Wednesday, Open: "10:00", Close: "14:00"},
+	}}
+
+	tests := []struct {
+		name  string
+		store Store
+		now   time.Time
+		state QueueState
+	}{
+		{name: "before opening", store: Store{OpeningHours: hours}, now: at(1, 8, 0), state: QueueState{Status: QueueClosed, NextOpening: ptr(at(1, 9, 0))}},
+		{name: "open", store: Store{OpeningHours: hours}, now: at(1, 10, 0), state: QueueState{Status: QueueOpen}},
+		{name: "lunch break", store: Store{OpeningHours: hours}, now: at(1, 12, 30), state: QueueState{Status: QueueClosed, NextOpening: ptr(at(1, 13, 0))}},
+		{name: "after closing", store: Store{OpeningHours: hours}, now: at(1, 18, 0), state: QueueState{Status: QueueClosed, NextOpening: ptr(at(3, 10, 0))}},
+		{name: "weekend", store: Store{OpeningHours: hours}, now: at(6, 10, 0), state: QueueState{Status: QueueClosed, NextOpening: ptr(at(8, 9, 0))}},
+		{name: "other timezone", store: Store{OpeningHours: hours}, now: at(1, 10, 0).UTC(), state: QueueState{Status: QueueOpen}},
+		{name: "no schedule", store: Store{}, now: at(6, 3, 0), state: QueueState{Status: QueueOpen}},
+		{name: "opened by hand", store: Store{OpeningHours: hours, Mode: ModeOpen}, now: at(6, 10, 0), state: QueueState{Status: QueueOpen}},
+		{name: "closed by hand", store: Store{OpeningHours: hours, Mode: ModeClosed}, now: at(1, 10, 0), state: QueueState{Status: QueueClosed}},
+		{name: "paused", store: Store{Mode: ModePaused}, now: at(1, 10, 0), state: QueueState{Status: QueuePaused}},
+		{name: "paused until", store: Store{Mode: ModePaused, PausedUntil: ptr(at(1, 11, 0))}, now: at(1, 10, 0), state: QueueState{Status: QueuePaused, NextOpening: ptr(at(1, 11, 0))}},
+		{name: "pause over", store: Store{OpeningHours: hours, Mode: ModePaused, PausedUntil: ptr(at(1, 11, 0))}, now: at(1, 11, 30), state: QueueState{Status: QueueOpen}},
+	}
+
+	for _, test := range tests {
+		state := test.store.QueueState(test.now)
+		assert.Equal(t, test.state.Status, state.Status, test.name)
+		if test.state.NextOpening == nil {
+			assert.Nil(t, state.NextOpening, test.name)
+		} else if assert.NotNil(t, state.NextOpening, test.name) {
+			assert.True(t, test.state.NextOpening.Equal(*state.NextOpening), test.name)
+		}
+		assert.Equal(t, test.state.Status == QueueOpen, test.store.IsOpen(test.now), test.name)
+	}
+}
+
+func TestQueueClosedError(t *testing.T) {
+
+	loc, err := time.LoadLocation("America/Sao_Paulo")
+	assert.Nil(t, err)
+
+	next := time.Date(2024, time.January, 8, 9, 0, 0, 0, loc)
+
+	closed := &QueueClosedError{State: QueueState{Status: QueueClosed, NextOpening: &next}}
+	assert.True(t, errors.Is(closed, ErrQueueClosed))
+	assert.Equal(t, "A fila do estabelecimento está fechada, abre novamente em 08/01 às 09:00", closed.Error())
+	assert.Equal(t, map[string]interface{}{"status": QueueClosed, "nextOpening": &next}, closed.Details())
+
+	paused := &QueueClosedError{State: QueueState{Status: QueuePaused}}
+	assert.True(t, errors.Is(paused, ErrQueuePaused))
+	assert.False(t, errors.Is(paused, ErrQueueClosed))
+	assert.Equal(t, "A fila do estabelecimento está pausada", paused.Error())
+}
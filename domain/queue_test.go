@@ -0,0 +1,85 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreQueues(t *testing.T) {
+
+	store := Store{Settings: QueueSettings{MaxWaiting: 10}}
+	assert.Equal(t, []Queue{{ID: DefaultQueueID, Name: DefaultQueueName}}, store.QueueList())
+	assert.NotNil(t, store.FindQueue(DefaultQueueID))
+	assert.Nil(t, store.FindQueue("caixa"))
+
+	store.Queues = []Queue{
+		{ID: DefaultQueueID, Name: "Mesas"},
+		{ID: "caixa", Name: "Caixa", Settings: &QueueSettings{MaxWaiting: 1}},
+	}
+	store.Queue = []*Consumer{
+		{ID: "1", Status: StatusWaiting},
+		{ID: "2", Status: StatusWaiting, QueueID: "caixa"},
+		{ID: "3", Status: StatusCalled, QueueID: "caixa"},
+		{ID: "4", Status: StatusWaiting, QueueID: DefaultQueueID},
+	}
+
+	assert.Equal(t, "Caixa", store.FindQueue("caixa").Name)
+	assert.Equal(t, 10, store.SettingsOf(DefaultQueueID).MaxWaiting)
+	assert.Equal(t, 1, store.SettingsOf("caixa").MaxWaiting)
+
+	ids := func(consumers []*Consumer) []string {
+		result := []string{}
+		for _, consumer := range consumers {
+			result = append(result, consumer.ID)
+		}
+		return result
+	}
+	assert.Equal(t, []string{"1", "4"}, ids(store.Waiting(DefaultQueueID)))
+	assert.Equal(t, []string{"2"}, ids(store.Waiting("caixa")))
+}
+
+func TestStoreUpdateQueues(t *testing.T) {
+
+	store := Store{
+		ID:     "1",
+		Queues: []Queue{{ID: DefaultQueueID, Name: "Mesas"}, {ID: "caixa", Name: "Caixa"}},
+		Queue: []*Consumer{
+			{ID: "1", Status: StatusWaiting, QueueID: "caixa"},
+			{ID: "2", Status: StatusServed, QueueID: "retirada"},
+		},
+	}
+
+	updated, err := (&StoreUpdate{Queues: []Queue{
+		{ID: DefaultQueueID, Name: "Mesas"},
+		{ID: "caixa", Name: " Caixa Rápido ", Length: 5, Settings: &QueueSettings{MaxWaiting: 3}},
+		{Name: "Retirada de Pedidos"},
+	}}).Apply(store)
+	assert.Nil(t, err)
+	if assert.Len(t, updated.Queues, 3) {
+		assert.Equal(t, "Caixa Rápido", updated.Queues[1].Name)
+		assert.Equal(t, 0, updated.Queues[1].Length)
+		assert.Equal(t, "retirada-de-pedidos", updated.Queues[2].ID)
+	}
+
+	tests := []struct {
+		name   string
+		queues []Queue
+		field  string
+	}{
+		{name: "empty name", queues: []Queue{{ID: DefaultQueueID, Name: " "}}, field: "queues.name"},
+		{name: "repeated", queues: []Queue{{ID: DefaultQueueID, Name: "Mesas"}, {Name: "Principal"}}, field: "queues.id"},
+		{name: "negative limit", queues: []Queue{{ID: DefaultQueueID, Name: "Mesas", Settings: &QueueSettings{MaxWaiting: -1}}}, field: "queues.settings.maxWaiting"},
+		{name: "default removed", queues: []Queue{{ID: "caixa", Name: "Caixa"}}, field: "queues"},
+		{name: "queue with consumers removed", queues: []Queue{{ID: DefaultQueueID, Name: "Mesas"}}, field: "queues"},
+	}
+
+	for _, test := range tests {
+		_, err := (&StoreUpdate{Queues: test.queues}).Apply(store)
+		var settingsErr *SettingsError
+		if assert.True(t, errors.As(err, &settingsErr), test.name) {
+			assert.Equal(t, test.field, settingsErr.Field, test.name)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/rokoga/filas-backend/apperror"
+)
+
+// ConsumerStatus - Status of a consumer in the store queue
+// The values are the Portuguese strings already persisted in the database.
+type ConsumerStatus string
+
+const (
+	// StatusWaiting for consumer waiting in the queue
+	StatusWaiting ConsumerStatus = "Na fila"
+	// StatusCalled for consumer called by the store
+	StatusCalled ConsumerStatus = "Chamado"
+	// StatusServed for consumer served after being called
+	StatusServed ConsumerStatus = "Atendido"
+	// StatusNoShow for consumer that did not show up after being called
+	StatusNoShow ConsumerStatus = "Não compareceu"
+	// StatusCancelled for consumer removed from the queue
+	StatusCancelled ConsumerStatus = "Cancelado"
+)
+
+var (
+	// ErrIllegalTransition for status changes not allowed by the transition table
+	ErrIllegalTransition = apperror.New(apperror.Conflict, "illegal_status_transition", "Alteração de status do consumidor não permitida")
+	// ErrInvalidStatus for unknown consumer statuses
+	ErrInvalidStatus = apperror.New(apperror.InvalidArgument, "invalid_status", "Status de consumidor inválido")
+)
+
+// transitions lists the statuses reachable from each status
+var transitions = map[ConsumerStatus][]ConsumerStatus{
+	StatusWaiting: {StatusCalled, StatusCancelled},
+	StatusCalled:  {StatusServed, StatusNoShow, StatusCancelled},
+}
+
+// TransitionError - Error for an illegal consumer status transition
+type TransitionError struct {
+	From ConsumerStatus
+	To   ConsumerStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("Não é possível alterar o status do consumidor de \"%s\" para \"%s\"", e.From, e.To)
+}
+
+// Unwrap allows errors.Is(err, ErrIllegalTransition)
+func (e *TransitionError) Unwrap() error {
+	return ErrIllegalTransition
+}
+
+// InvalidStatusError - Error for an unknown consumer status
+type InvalidStatusError struct {
+	Status string
+}
+
+func (e *InvalidStatusError) Error() string {
+	return fmt.Sprintf("Status de consumidor inválido: \"%s\"", e.Status)
+}
+
+// Unwrap allows errors.Is(err, ErrInvalidStatus)
+func (e *InvalidStatusError) Unwrap() error {
+	return ErrInvalidStatus
+}
+
+// Valid reports whether s is a known status
+func (s ConsumerStatus) Valid() bool {
+	switch s {
+	case StatusWaiting, StatusCalled, StatusServed, StatusNoShow, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+// Active reports whether the consumer still holds a spot in the queue
+func (s ConsumerStatus) Active() bool {
+	return s == StatusWaiting || s == StatusCalled
+}
+
+// CanTransitionTo reports whether s can change to the given status
+func (s ConsumerStatus) CanTransitionTo(to ConsumerStatus) bool {
+	for _, next := range transitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition returns the new status or a *TransitionError when the change is illegal
+func (s ConsumerStatus) Transition(to ConsumerStatus) (ConsumerStatus, error) {
+	if !s.CanTransitionTo(to) {
+		return s, &TransitionError{From: s, To: to}
+	}
+	return to, nil
+}
+
+// StatusesLeadingTo returns every status that can change to the given status
+func StatusesLeadingTo(to ConsumerStatus) []ConsumerStatus {
+	var result []ConsumerStatus
+	for _, from := range []ConsumerStatus{StatusWaiting, StatusCalled, StatusServed, StatusNoShow, StatusCancelled} {
+		if from.CanTransitionTo(to) {
+			result = append(result, from)
+		}
+	}
+	return result
+}
+
+// UnmarshalJSON implements json.Unmarshaler rejecting unknown statuses
+func (s *ConsumerStatus) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	status := ConsumerStatus(value)
+	if !status.Valid() {
+		return &InvalidStatusError{Status: value}
+	}
+
+	*s = status
+	return nil
+}
@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestTransition(t *testing.T) {
+
+	tests := []struct {
+		from ConsumerStatus
+		to   ConsumerStatus
+		err  error
+	}{
+		{from: StatusWaiting, to: StatusCalled, err: nil},
+		{from: StatusWaiting, to: StatusCancelled, err: nil},
+		{from: StatusCalled, to: StatusServed, err: nil},
+		{from: StatusCalled, to: StatusNoShow, err: nil},
+		{from: StatusCalled, to: StatusCancelled, err: nil},
+		{from: StatusWaiting, to: StatusServed, err: &TransitionError{From: StatusWaiting, To: StatusServed}},
+		{from: StatusServed, to: StatusCancelled, err: &TransitionError{From: StatusServed, To: StatusCancelled}},
+		{from: StatusCancelled, to: StatusWaiting, err: &TransitionError{From: StatusCancelled, To: StatusWaiting}},
+		{from: StatusNoShow, to: StatusCalled, err: &TransitionError{From: StatusNoShow, To: StatusCalled}},
+	}
+
+	for _, test := range tests {
+		status, err := test.from.Transition(test.to)
+		if test.err == nil {
+			assert.Nil(t, err)
+			assert.Equal(t, test.to, status)
+		} else {
+			assert.Equal(t, test.err, err)
+			assert.Equal(t, test.from, status)
+		}
+	}
+
+	_, err := StatusServed.Transition(StatusWaiting)
+	assert.True(t, errors.Is(err, ErrIllegalTransition))
+
+	assert.ElementsMatch(t, []ConsumerStatus{StatusWaiting, StatusCalled}, StatusesLeadingTo(StatusCancelled))
+	assert.ElementsMatch(t, []ConsumerStatus{StatusCalled}, StatusesLeadingTo(StatusServed))
+}
+
+func TestStatusMarshalling(t *testing.T) {
+
+	consumer := Consumer{Name: "Fulano", Status: StatusNoShow}
+
+	data, err := json.Marshal(consumer)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"status":"Não compareceu"`)
+
+	var decoded Consumer
+	assert.Nil(t, json.Unmarshal([]byte(`{"name":"Fulano","status":"Na fila"}`), &decoded))
+	assert.Equal(t, StatusWaiting, decoded.Status)
+
+	err = json.Unmarshal([]byte(`{"status":"Perdido"}`), &decoded)
+	assert.Equal(t, &InvalidStatusError{Status: "Perdido"}, err)
+	assert.True(t, errors.Is(err, ErrInvalidStatus))
+
+	// Documents already stored in Mongo keep the plain Portuguese strings
+	raw, err := bson.Marshal(bson.M{"name": "Fulano", "status": "Cancelado"})
+	assert.Nil(t, err)
+
+	var stored Consumer
+	assert.Nil(t, bson.Unmarshal(raw, &stored))
+	assert.Equal(t, StatusCancelled, stored.Status)
+
+	raw, err = bson.Marshal(consumer)
+	assert.Nil(t, err)
+	assert.Equal(t, "Não compareceu", bson.Raw(raw).Lookup("status").StringValue())
+}
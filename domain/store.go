@@ -1,12 +1,55 @@
 package domain
 
+import "time"
+
 // Store - Store Domain
-// Store contains an ordered consumer queue
+// Store contains an ordered consumer queue. Queue entries are persisted in
+// their own collection and only the consumers still waiting or called are
+// loaded with the store.
 type Store struct {
-	ID      string      `bson:"_id,omitempty" json:"_id"`
-	Name    string      `bson:"name,omitempty" json:"name"`
-	URLName string      `bson:"urlname,omitempty" json:"urlName"`
-	Queue   []*Consumer `bson:"queue,omitempty" json:"queue"`
+	ID   string `bson:"_id,omitempty" json:"_id"`
+	Name string `bson:"name,omitempty" json:"name"`
+	// Slug is the URL-safe form of the name used by the public routes
+	Slug         string        `bson:"slug,omitempty" json:"slug"`
+	URLName      string        `bson:"urlname,omitempty" json:"urlName"`
+	OwnerID      string        `bson:"ownerId,omitempty" json:"ownerId,omitempty"`
+	Staff        []string      `bson:"staff,omitempty" json:"staff,omitempty"`
+	Queue        []*Consumer   `bson:"-" json:"queue"`
+	Contact      *Contact      `bson:"contact,omitempty" json:"contact,omitempty"`
+	Address      *Address      `bson:"address,omitempty" json:"address,omitempty"`
+	LogoURL      string        `bson:"logoUrl,omitempty" json:"logoUrl,omitempty"`
+	OpeningHours *OpeningHours `bson:"openingHours,omitempty" json:"openingHours,omitempty"`
+	Settings     QueueSettings `bson:"settings" json:"settings"`
+	// Queues are the named lines consumers choose from when joining
+	Queues []Queue `bson:"queues,omitempty" json:"queues"`
+	// MessageTemplates customize the messages sent to consumers
+	MessageTemplates map[NotificationKind]string `bson:"messageTemplates,omitempty" json:"messageTemplates,omitempty"`
+	// PreviousSlugs keep the links of a renamed store working
+	PreviousSlugs []string `bson:"previousSlugs,omitempty" json:"-"`
+	// Version is incremented on every update, so concurrent edits are detected
+	Version int64 `bson:"version" json:"version"`
+	// Mode is the manual switch of the queue, empty behaves as ModeAuto
+	Mode QueueMode `bson:"mode,omitempty" json:"mode,omitempty"`
+	// PausedUntil ends a pause, a pause without it lasts until changed
+	PausedUntil *time.Time `bson:"pausedUntil,omitempty" json:"pausedUntil,omitempty"`
+	// State is computed by the service and never persisted
+	State *QueueState `bson:"-" json:"state,omitempty"`
+}
+
+// IsManagedBy reports whether the user is the owner or part of the staff
+func (s *Store) IsManagedBy(userID string) bool {
+	if userID == "" {
+		return false
+	}
+	if s.OwnerID == userID {
+		return true
+	}
+	for _, id := range s.Staff {
+		if id == userID {
+			return true
+		}
+	}
+	return false
 }
 
 // filas.app/outback
@@ -0,0 +1,264 @@
+package domain
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rokoga/filas-backend/apperror"
+)
+
+var (
+	// ErrInvalidStoreSettings for store settings that fail validation
+	ErrInvalidStoreSettings = apperror.New(apperror.InvalidArgument, "invalid_store_settings", "Configuração do estabelecimento inválida")
+)
+
+// SettingsError - Error for an invalid store setting
+type SettingsError struct {
+	Field  string
+	Reason string
+}
+
+func (e *SettingsError) Error() string {
+	return fmt.Sprintf("Configuração do estabelecimento inválida em \"%s\": %s", e.Field, e.Reason)
+}
+
+// Unwrap allows errors.Is(err, ErrInvalidStoreSettings)
+func (e *SettingsError) Unwrap() error {
+	return ErrInvalidStoreSettings
+}
+
+// Contact - How customers reach the store
+type Contact struct {
+	Phone   string `bson:"phone,omitempty" json:"phone,omitempty"`
+	Email   string `bson:"email,omitempty" json:"email,omitempty"`
+	Website string `bson:"website,omitempty" json:"website,omitempty"`
+}
+
+// Address - Where the store is
+type Address struct {
+	Street     string `bson:"street,omitempty" json:"street,omitempty"`
+	Number     string `bson:"number,omitempty" json:"number,omitempty"`
+	Complement string `bson:"complement,omitempty" json:"complement,omitempty"`
+	District   string `bson:"district,omitempty" json:"district,omitempty"`
+	City       string `bson:"city,omitempty" json:"city,omitempty"`
+	State      string `bson:"state,omitempty" json:"state,omitempty"`
+	PostalCode string `bson:"postalCode,omitempty" json:"postalCode,omitempty"`
+}
+
+// OpeningHours - Weekly schedule of a store
+type OpeningHours struct {
+	// Timezone is an IANA name such as "America/Sao_Paulo"
+	Timezone string          `bson:"timezone" json:"timezone"`
+	Periods  []OpeningPeriod `bson:"periods" json:"periods"`
+}
+
+// OpeningPeriod - A time range of a weekday in the store timezone
+// Open and Close are "HH:MM" and Close may be "24:00". A period that
+// crosses midnight is written as two periods.
+type OpeningPeriod struct {
+	Weekday time.Weekday `bson:"weekday" json:"weekday"`
+	Open    string       `bson:"open" json:"open"`
+	Close   string       `bson:"close" json:"close"`
+}
+
+// QueueSettings - Limits of the store queue
+type QueueSettings struct {
+	// MaxWaiting caps how many consumers wait at once, zero means no limit
+	MaxWaiting int `bson:"maxWaiting,omitempty" json:"maxWaiting"`
+	// MaxSkip caps how many waiting parties a call for a table may pass over
+	// to find one that fits, zero means no limit
+	MaxSkip int `bson:"maxSkip,omitempty" json:"maxSkip"`
+}
+
+// validate checks the limits are not negative, field names the settings in
+// the errors
+func (s *QueueSettings) validate(field string) error {
+	if s.MaxWaiting < 0 {
+		return &SettingsError{Field: field + ".maxWaiting", Reason: "não pode ser negativo"}
+	}
+	if s.MaxSkip < 0 {
+		return &SettingsError{Field: field + ".maxSkip", Reason: "não pode ser negativo"}
+	}
+	return nil
+}
+
+// StoreUpdate - Changes to a store, nil fields are kept as they are
+type StoreUpdate struct {
+	// Version is the version of the store the changes were made on
+	Version      int64
+	Name         *string
+	Contact      *Contact
+	Address      *Address
+	LogoURL      *string
+	OpeningHours *OpeningHours
+	// Settings apply to the queues without settings of their own
+	Settings *QueueSettings
+	// Queues replace the queues of the store. A queue without ID is new and
+	// gets one made from its name.
+	Queues []Queue
+	// MessageTemplates replace the templates of the given kinds, an empty
+	// template goes back to the default one
+	MessageTemplates map[NotificationKind]string
+}
+
+// Apply validates the changes and returns a copy of the store with them.
+// An empty LogoURL removes the logo and opening hours without periods
+// remove the schedule.
+func (u *StoreUpdate) Apply(store Store) (*Store, error) {
+	if u.Name != nil {
+		name := strings.TrimSpace(*u.Name)
+		if name == "" {
+			return nil, &SettingsError{Field: "name", Reason: "não pode ser vazio"}
+		}
+		store.Name = name
+	}
+
+	if u.Contact != nil {
+		if err := u.Contact.Validate(); err != nil {
+			return nil, err
+		}
+		contact := *u.Contact
+		store.Contact = &contact
+	}
+
+	if u.Address != nil {
+		address := *u.Address
+		store.Address = &address
+	}
+
+	if u.LogoURL != nil {
+		if *u.LogoURL != "" && !isHTTPURL(*u.LogoURL) {
+			return nil, &SettingsError{Field: "logoUrl", Reason: "deve ser uma URL http(s) absoluta"}
+		}
+		store.LogoURL = *u.LogoURL
+	}
+
+	if u.OpeningHours != nil {
+		if len(u.OpeningHours.Periods) == 0 {
+			store.OpeningHours = nil
+		} else {
+			if err := u.OpeningHours.Validate(); err != nil {
+				return nil, err
+			}
+			hours := *u.OpeningHours
+			hours.Periods = append([]OpeningPeriod(nil), u.OpeningHours.Periods...)
+			store.OpeningHours = &hours
+		}
+	}
+
+	if u.Settings != nil {
+		if err := u.Settings.validate("settings"); err != nil {
+			return nil, err
+		}
+		store.Settings = *u.Settings
+	}
+
+	if u.Queues != nil {
+		queues, err := validateQueues(&store, u.Queues)
+		if err != nil {
+			return nil, err
+		}
+		store.Queues = queues
+	}
+
+	if u.MessageTemplates != nil {
+		templates := map[NotificationKind]string{}
+		for kind, text := range store.MessageTemplates {
+			templates[kind] = text
+		}
+		for kind, text := range u.MessageTemplates {
+			if strings.TrimSpace(text) == "" {
+				delete(templates, kind)
+			} else {
+				templates[kind] = text
+			}
+		}
+		if err := validateTemplates(templates); err != nil {
+			return nil, err
+		}
+		store.MessageTemplates = templates
+	}
+
+	return &store, nil
+}
+
+// Validate checks the email and website. The phone is normalized by the
+// service.
+func (c *Contact) Validate() error {
+	if c.Email != "" && !strings.Contains(c.Email, "@") {
+		return &SettingsError{Field: "contact.email", Reason: "email inválido"}
+	}
+	if c.Website != "" && !isHTTPURL(c.Website) {
+		return &SettingsError{Field: "contact.website", Reason: "deve ser uma URL http(s) absoluta"}
+	}
+	return nil
+}
+
+// Validate checks the timezone and that the periods of each weekday are
+// well formed and do not overlap
+func (h *OpeningHours) Validate() error {
+	if _, err := time.LoadLocation(h.Timezone); err != nil || h.Timezone == "" {
+		return &SettingsError{Field: "openingHours.timezone", Reason: fmt.Sprintf("fuso horário desconhecido \"%s\"", h.Timezone)}
+	}
+
+	byDay := map[time.Weekday][][2]int{}
+
+	for _, period := range h.Periods {
+		if period.Weekday < time.Sunday || period.Weekday > time.Saturday {
+			return &SettingsError{Field: "openingHours.periods", Reason: "dia da semana deve ser de 0 (domingo) a 6 (sábado)"}
+		}
+
+		open, okOpen := parseClock(period.Open)
+		closing, okClose := parseClock(period.Close)
+		if !okOpen || !okClose || open >= closing {
+			return &SettingsError{Field: "openingHours.periods", Reason: fmt.Sprintf("período inválido %s-%s", period.Open, period.Close)}
+		}
+
+		byDay[period.Weekday] = append(byDay[period.Weekday], [2]int{open, closing})
+	}
+
+	for _, ranges := range byDay {
+		sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+		for i := 1; i < len(ranges); i++ {
+			if ranges[i][0] < ranges[i-1][1] {
+				return &SettingsError{Field: "openingHours.periods", Reason: "períodos do mesmo dia se sobrepõem"}
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseClock returns the minutes since midnight of "HH:MM", up to "24:00"
+func parseClock(value string) (int, bool) {
+	if len(value) != 5 || value[2] != ':' {
+		return 0, false
+	}
+
+	hours, okHours := parseDigits(value[:2])
+	minutes, okMinutes := parseDigits(value[3:])
+	if !okHours || !okMinutes || minutes > 59 || hours > 24 || (hours == 24 && minutes != 0) {
+		return 0, false
+	}
+
+	return hours*60 + minutes, true
+}
+
+func parseDigits(value string) (int, bool) {
+	result := 0
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return 0, false
+		}
+		result = result*10 + int(r-'0')
+	}
+	return result, true
+}
+
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
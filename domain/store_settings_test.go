@@ -0,0 +1,117 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpeningHoursValidate(t *testing.T) {
+
+	period := func(day time.Weekday, open, close string) OpeningPeriod {
+		return OpeningPeriod{Weekday: day, Open: open, Close: close}
+	}
+
+	tests := []struct {
+		name  string
+		hours OpeningHours
+		valid bool
+	}{
+		{name: "lunch break", hours: OpeningHours{Timezone: "America/Sao_Paulo", Periods: []OpeningPeriod{
+			period(time.Monday, "09:00", "12:00"), period(time.Monday, "13:00", "18:00"),
+		}}, valid: true},
+		{name: "until midnight", hours: OpeningHours{Timezone: "UTC", Periods: []OpeningPeriod{period(time.Friday, "18:00", "24:00")}}, valid: true},
+		{name: "unknown timezone", hours: OpeningHours{Timezone: "Brasil/Centro", Periods: []OpeningPeriod{period(time.Monday, "09:00", "18:00")}}, valid: false},
+		{name: "missing timezone", hours: OpeningHours{Periods: []OpeningPeriod{period(time.Monday, "09:00", "18:00")}}, valid: false},
+		{name: "closes before opening", hours: OpeningHours{Timezone: "UTC", Periods: []OpeningPeriod{period(time.Monday, "18:00", "09:00")}}, valid: false},
+		{name: "bad clock", hours: OpeningHours{Timezone: "UTC", Periods: []OpeningPeriod{period(time.Monday, "9h", "18:00")}}, valid: false},
+		{name: "past midnight", hours: OpeningHours{Timezone: "UTC", Periods: []OpeningPeriod{period(time.Monday, "18:00", "24:30")}}, valid: false},
+		{name: "bad weekday", hours: OpeningHours{Timezone: "UTC", Periods: []OpeningPeriod{period(7, "09:00", "18:00")}}, valid: false},
+		{name: "overlap", hours: OpeningHours{Timezone: "UTC", Periods: []OpeningPeriod{
+			period(time.Monday, "09:00", "13:00"), period(time.Monday, "12:00", "18:00"),
+		}}, valid: false},
+	}
+
+	for _, test := range tests {
+		err := test.hours.Validate()
+		if test.valid {
+			assert.Nil(t, err, test.name)
+		} else {
+			assert.True(t, errors.Is(err, ErrInvalidStoreSettings), test.name)
+		}
+	}
+}
+
+func TestStoreUpdateApply(t *testing.T) {
+
+	str := func(value string) *string { return &value }
+
+	store := Store{
+		ID:      "1",
+		Name:    "Outback",
+		LogoURL: "https://example.com/logo.png",
+		OpeningHours: &OpeningHours{Timezone: "UTC", Periods: []OpeningPeriod{
+			{Weekday: time.Monday, Open: "09:00", Close: "18:00"},
+		}},
+	}
+
+	updated, err := (&StoreUpdate{
+		Name:         str("  Outback Centro "),
+		Contact:      &Contact{Email: "contato@outback.com"},
+		LogoURL:      str(""),
+		OpeningHours: &OpeningHours{},
+		Settings:     &QueueSettings{MaxWaiting: 30},
+	}).Apply(store)
+	assert.Nil(t, err)
+	assert.Equal(t, "Outback Centro", updated.Name)
+	assert.Equal(t, "contato@outback.com", updated.Contact.Email)
+	assert.Equal(t, "", updated.LogoURL)
+	assert.Nil(t, updated.OpeningHours)
+	assert.Equal(t, 30, updated.Settings.MaxWaiting)
+	assert.Equal(t, "Outback", store.Name)
+
+	tests := []struct {
+		update StoreUpdate
+		field  string
+	}{
+		{update: StoreUpdate{Name: str(" ")}, field: "name"},
+		{update: StoreUpdate{Contact: &Contact{Email: "contato"}}, field: "contact.email"},
+		{update: StoreUpdate{Contact: &Contact{Website: "outback.com"}}, field: "contact.website"},
+		{update: StoreUpdate{LogoURL: str("ftp://example.com/logo.png")}, field: "logoUrl"},
+		{update: StoreUpdate{Settings: &QueueSettings{MaxWaiting: -1}}, field: "settings.maxWaiting"},
+		{update: StoreUpdate{Settings: &QueueSettings{MaxSkip: -1}}, field: "settings.maxSkip"},
+		{update: StoreUpdate{MessageTemplates: map[NotificationKind]string{"birthday": "Parabéns"}}, field: "messageTemplates.birthday"},
+		{update: StoreUpdate{MessageTemplates: map[NotificationKind]string{NotifyCalled: "{{.Nome}}, é a sua vez"}}, field: "messageTemplates.called"},
+		{update: StoreUpdate{MessageTemplates: map[NotificationKind]string{NotifyCalled: "{{.Name"}}, field: "messageTemplates.called"},
+	}
+
+	for _, test := range tests {
+		_, err := test.update.Apply(store)
+		var settingsErr *SettingsError
+		if assert.True(t, errors.As(err, &settingsErr), test.field) {
+			assert.Equal(t, test.field, settingsErr.Field)
+		}
+	}
+}
+
+func TestStoreMessage(t *testing.T) {
+
+	store := Store{Name: "Outback", MessageTemplates: map[NotificationKind]string{NotifyCalled: "{{.Name}}, sua mesa está pronta"}}
+	data := NotificationData{Store: "Outback", Name: "Ana", Position: 3, Ahead: 2, URL: "http://app.filas.com/outback/chave"}
+
+	message, err := store.Message(NotifyCalled, data)
+	assert.Nil(t, err)
+	assert.Equal(t, "Ana, sua mesa está pronta", message)
+
+	message, err = store.Message(NotifyJoined, data)
+	assert.Nil(t, err)
+	assert.Equal(t, "Olá Ana, você entrou na fila de Outback na posição 3. Acompanhe em http://app.filas.com/outback/chave", message)
+
+	// An empty template goes back to the default one
+	updated, err := (&StoreUpdate{MessageTemplates: map[NotificationKind]string{NotifyCalled: " "}}).Apply(store)
+	assert.Nil(t, err)
+	assert.Empty(t, updated.MessageTemplates)
+	assert.Len(t, store.MessageTemplates, 1)
+}
@@ -0,0 +1,22 @@
+package domain
+
+// StoreSummary - A store in the listing, without its queue
+type StoreSummary struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+	Open bool   `json:"open"`
+	// State tells why a store is not open and when it opens again
+	State QueueState `json:"state"`
+	// QueueLength is the number of consumers waiting
+	QueueLength int `json:"queueLength"`
+}
+
+// StorePage - A page of the store listing
+type StorePage struct {
+	Stores []*StoreSummary `json:"stores"`
+	// Total is the number of stores matching the search, on every page
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
@@ -0,0 +1,9 @@
+package domain
+
+// User - Store owner or staff account
+type User struct {
+	ID           string `bson:"_id,omitempty" json:"_id"`
+	Name         string `bson:"name,omitempty" json:"name"`
+	Email        string `bson:"email,omitempty" json:"email"`
+	PasswordHash string `bson:"passwordHash,omitempty" json:"-"`
+}
@@ -0,0 +1,47 @@
+package domain
+
+import "time"
+
+// Webhook - Endpoint of a store integration that receives its queue events
+type Webhook struct {
+	ID      string `bson:"_id,omitempty" json:"id"`
+	StoreID string `bson:"storeId" json:"storeId"`
+	URL     string `bson:"url" json:"url"`
+	// Events are the event types sent to the endpoint
+	Events []string `bson:"events" json:"events"`
+	// Secret signs every payload, it is only shown when the webhook is created
+	Secret    string    `bson:"secret" json:"-"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+// Subscribed reports whether events of the given type are sent to the webhook
+func (w *Webhook) Subscribed(eventType string) bool {
+	for _, subscribed := range w.Events {
+		if subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery - An event sent to a webhook, kept as its delivery log
+type WebhookDelivery struct {
+	ID        string `bson:"_id,omitempty" json:"id"`
+	WebhookID string `bson:"webhookId" json:"webhookId"`
+	StoreID   string `bson:"storeId" json:"storeId"`
+	Event     string `bson:"event" json:"event"`
+	// Payload is the exact body posted, so every attempt sends the same bytes
+	Payload   string         `bson:"payload" json:"payload"`
+	Status    DeliveryStatus `bson:"status" json:"status"`
+	Attempts  int            `bson:"attempts" json:"attempts"`
+	LastError string         `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	// ResponseStatus is the HTTP status of the last attempt, zero when the
+	// endpoint could not be reached
+	ResponseStatus int       `bson:"responseStatus,omitempty" json:"responseStatus,omitempty"`
+	CreatedAt      time.Time `bson:"createdAt" json:"createdAt"`
+	// NextAttemptAt is when a pending delivery is sent next
+	NextAttemptAt time.Time `bson:"nextAttemptAt" json:"nextAttemptAt"`
+	// LockedUntil keeps other workers away while one sends the delivery
+	LockedUntil *time.Time `bson:"lockedUntil,omitempty" json:"-"`
+	DeliveredAt *time.Time `bson:"deliveredAt,omitempty" json:"deliveredAt,omitempty"`
+}
@@ -0,0 +1,136 @@
+package event
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// ConsumerJoined for consumer added to the queue
+	ConsumerJoined = "consumer.joined"
+	// ConsumerCancelled for consumer removed from the queue
+	ConsumerCancelled = "consumer.cancelled"
+	// ConsumerCalled for consumer called by the store
+	ConsumerCalled = "consumer.called"
+	// ConsumerServed for consumer served after being called
+	ConsumerServed = "consumer.served"
+	// ConsumerNoShow for consumer that did not show up after being called
+	ConsumerNoShow = "consumer.noshow"
+	// StoreOpened for queue opened by hand or back to its opening hours while open
+	StoreOpened = "store.opened"
+	// StorePaused for queue paused by hand
+	StorePaused = "store.paused"
+	// StoreClosed for queue closed by hand or back to its opening hours while closed
+	StoreClosed = "store.closed"
+)
+
+// Types lists every event type published by the service
+var Types = []string{ConsumerJoined, ConsumerCancelled, ConsumerCalled, ConsumerServed, ConsumerNoShow, StoreOpened, StorePaused, StoreClosed}
+
+// Valid reports whether eventType is published by the service
+func Valid(eventType string) bool {
+	for _, t := range Types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// subscriberBuffer is the number of events a slow subscriber may lag behind
+// before new events are dropped for it
+const subscriberBuffer = 16
+
+// Event - Change in a store queue
+type Event struct {
+	Type       string    `json:"type"`
+	StoreID    string    `json:"storeId"`
+	ConsumerID string    `json:"consumerId"`
+	OccurredAt time.Time `json:"occurredAt"`
+	// QueueID is the queue of the store that changed, empty for store events
+	QueueID string `json:"queueId,omitempty"`
+}
+
+// Hub - In-process publish/subscribe of queue events per store
+type Hub struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[chan Event]struct{}
+	closed      bool
+}
+
+// NewHub implements
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: make(map[string]map[chan Event]struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving the events of a store and a function
+// to cancel the subscription. The channel is closed on cancel or when the
+// hub is closed.
+func (h *Hub) Subscribe(storeID string) (<-chan Event, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+
+	if h.subscribers[storeID] == nil {
+		h.subscribers[storeID] = make(map[chan Event]struct{})
+	}
+	h.subscribers[storeID][ch] = struct{}{}
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+
+			if _, ok := h.subscribers[storeID][ch]; ok {
+				delete(h.subscribers[storeID], ch)
+				if len(h.subscribers[storeID]) == 0 {
+					delete(h.subscribers, storeID)
+				}
+				close(ch)
+			}
+		})
+	}
+
+	return ch, cancel
+}
+
+// Publish delivers the event to every subscriber of its store without
+// blocking. Subscribers only use events as a signal to reload the queue, so
+// an event is dropped for a subscriber whose buffer is full.
+func (h *Hub) Publish(e Event) {
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now().UTC()
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for ch := range h.subscribers[e.StoreID] {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Close ends every subscription and rejects new ones
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for storeID, subscribers := range h.subscribers {
+		for ch := range subscribers {
+			close(ch)
+		}
+		delete(h.subscribers, storeID)
+	}
+}
@@ -0,0 +1,72 @@
+package event
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublish(t *testing.T) {
+
+	hub := NewHub()
+
+	events, cancel := hub.Subscribe("store1")
+	other, cancelOther := hub.Subscribe("store2")
+	defer cancelOther()
+
+	hub.Publish(Event{Type: ConsumerJoined, StoreID: "store1", ConsumerID: "consumer1"})
+
+	e := <-events
+	assert.Equal(t, ConsumerJoined, e.Type)
+	assert.Equal(t, "store1", e.StoreID)
+	assert.False(t, e.OccurredAt.IsZero())
+	assert.Len(t, other, 0)
+
+	cancel()
+	_, ok := <-events
+	assert.False(t, ok)
+
+	// Cancelling twice and publishing without subscribers must be harmless
+	cancel()
+	hub.Publish(Event{Type: ConsumerCalled, StoreID: "store1"})
+}
+
+func TestPublishDoesNotBlock(t *testing.T) {
+
+	hub := NewHub()
+
+	events, cancel := hub.Subscribe("store1")
+	defer cancel()
+
+	for i := 0; i < subscriberBuffer*2; i++ {
+		hub.Publish(Event{Type: ConsumerJoined, StoreID: "store1"})
+	}
+
+	assert.Len(t, events, subscriberBuffer)
+}
+
+func TestClose(t *testing.T) {
+
+	hub := NewHub()
+
+	events, cancel := hub.Subscribe("store1")
+
+	hub.Close()
+
+	_, ok := <-events
+	assert.False(t, ok)
+
+	cancel()
+
+	late, _ := hub.Subscribe("store1")
+	_, ok = <-late
+	assert.False(t, ok)
+}
+
+func TestValid(t *testing.T) {
+
+	assert.True(t, Valid(ConsumerJoined))
+	assert.True(t, Valid(StoreOpened))
+	assert.False(t, Valid("consumer.unknown"))
+	assert.False(t, Valid(""))
+}
@@ -6,39 +6,34 @@ import (
 	"time"
 
 	"github.com/rokoga/filas-backend/config"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 // GetConnection implements MongoDB connection
-func GetConnection(configFile string) (*mongo.Client, *mongo.Collection, error) {
-	cfg, err := config.ReadConfig(configFile, nil)
-	if err != nil {
-		return nil, nil, fmt.Errorf("Erro ao ler o arquivo de configuração: %v", err)
-	}
-
-	port := cfg.GetString("dbport")
-	dbhost := cfg.GetString("dbhost")
-	dbdriver := cfg.GetString("dbdriver")
-	// dbuser := cfg.GetString("dbuser")
-	// dbpass := cfg.GetString("dbpass")
-	database := cfg.GetString("dbname")
-	dbcollection := cfg.GetString("dbcollection")
-	uri := fmt.Sprintf("%s://%s:%s", dbdriver, dbhost, port)
-
-	client, err := mongo.NewClient(options.Client().ApplyURI(uri))
+func GetConnection(cfg config.DatabaseConfig) (*mongo.Client, *mongo.Collection, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(cfg.URI()))
 	if err != nil {
 		return nil, nil, fmt.Errorf("Erro ao criar cliente de conexão com o banco: %v", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
 	defer cancel()
 	err = client.Connect(ctx)
 	if err != nil {
 		return nil, nil, fmt.Errorf("Erro ao criar conexão com o banco: %v", err)
 	}
 
-	collection := client.Database(database).Collection(dbcollection)
+	// Connect is lazy, ping so an unreachable server fails the startup
+	err = Ping(ctx, client)
+	if err != nil {
+		CloseConnection(client)
+		return nil, nil, err
+	}
+
+	collection := client.Database(cfg.Name).Collection(cfg.Collection)
 
 	return client, collection, nil
 }
@@ -55,3 +50,29 @@ func CloseConnection(dbClient *mongo.Client) error {
 
 	return nil
 }
+
+// Ping checks that the database server is reachable
+func Ping(ctx context.Context, dbClient *mongo.Client) error {
+	err := dbClient.Ping(ctx, readpref.Primary())
+	if err != nil {
+		return fmt.Errorf("Erro ao conectar com o banco: %v", err)
+	}
+
+	return nil
+}
+
+// SupportsTransactions reports whether the server is part of a replica set
+// or a sharded cluster, the deployments where transactions are available
+func SupportsTransactions(ctx context.Context, dbClient *mongo.Client) (bool, error) {
+	var result struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+
+	err := dbClient.Database("admin").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&result)
+	if err != nil {
+		return false, fmt.Errorf("Erro ao consultar o servidor do banco: %v", err)
+	}
+
+	return result.SetName != "" || result.Msg == "isdbgrid", nil
+}
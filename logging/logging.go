@@ -0,0 +1,114 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// FieldRequestID correlates every log line of a request
+	FieldRequestID = "request_id"
+	// FieldPhone is redacted before the entry is written
+	FieldPhone = "phone"
+	// FieldAccessKey is redacted before the entry is written
+	FieldAccessKey = "access_key"
+)
+
+type contextKey struct{}
+
+// New returns a JSON logger writing to out at the given level
+// (debug, info, warn or error)
+func New(out io.Writer, level string) (*logrus.Logger, error) {
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(out)
+	logger.SetLevel(lvl)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.AddHook(redactHook{})
+
+	return logger, nil
+}
+
+// NewContext returns a copy of ctx carrying the entry
+func NewContext(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, contextKey{}, entry)
+}
+
+// FromContext returns the entry carried by ctx, or one of the standard
+// logger when there is none
+func FromContext(ctx context.Context) *logrus.Entry {
+	if entry, ok := ctx.Value(contextKey{}).(*logrus.Entry); ok {
+		return entry
+	}
+
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+// RequestID returns the request ID of the entry carried by ctx
+func RequestID(ctx context.Context) string {
+	id, _ := FromContext(ctx).Data[FieldRequestID].(string)
+	return id
+}
+
+// NewRequestID returns a random 16 hex characters ID
+func NewRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// RedactPhone keeps only the last 4 digits of a phone number
+func RedactPhone(phone string) string {
+	if len(phone) <= 4 {
+		return strings.Repeat("*", len(phone))
+	}
+
+	return strings.Repeat("*", len(phone)-4) + phone[len(phone)-4:]
+}
+
+// RedactAccessKey keeps only the first 4 characters of an access key, enough
+// to tell keys apart without allowing their use
+func RedactAccessKey(accessKey string) string {
+	if len(accessKey) <= 4 {
+		return "****"
+	}
+
+	return accessKey[:4] + "****"
+}
+
+// redactHook masks sensitive fields of every entry
+type redactHook struct{}
+
+func (redactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (redactHook) Fire(entry *logrus.Entry) error {
+	// Data may be shared with the entry that created this one
+	data := make(logrus.Fields, len(entry.Data))
+	for key, value := range entry.Data {
+		data[key] = value
+	}
+
+	if phone, ok := data[FieldPhone].(string); ok {
+		data[FieldPhone] = RedactPhone(phone)
+	}
+	if accessKey, ok := data[FieldAccessKey].(string); ok {
+		data[FieldAccessKey] = RedactAccessKey(accessKey)
+	}
+
+	entry.Data = data
+	return nil
+}
@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+
+	tests := []struct {
+		phone           string
+		resultPhone     string
+		accessKey       string
+		resultAccessKey string
+	}{
+		{phone: "+5511999990000", resultPhone: "**********0000", accessKey: "Zm9vYmFyYmF6cXV4", resultAccessKey: "Zm9v****"},
+		{phone: "123", resultPhone: "***", accessKey: "abc", resultAccessKey: "****"},
+		{phone: "", resultPhone: "", accessKey: "", resultAccessKey: "****"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.resultPhone, RedactPhone(test.phone))
+		assert.Equal(t, test.resultAccessKey, RedactAccessKey(test.accessKey))
+	}
+
+}
+
+func TestNew(t *testing.T) {
+	var out bytes.Buffer
+
+	logger, err := New(&out, "info")
+	assert.Nil(t, err)
+
+	entry := logger.WithField(FieldPhone, "11999990000")
+	entry.WithField(FieldAccessKey, "Zm9vYmFyYmF6cXV4").Info("consumer joined")
+	logger.Debug("not written")
+
+	line := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &line))
+	assert.Equal(t, "consumer joined", line["msg"])
+	assert.Equal(t, "info", line["level"])
+	assert.Equal(t, "*******0000", line[FieldPhone])
+	assert.Equal(t, "Zm9v****", line[FieldAccessKey])
+
+	// The entry the line derived from keeps its original data
+	assert.Equal(t, "11999990000", entry.Data[FieldPhone])
+
+	_, err = New(&out, "verbose")
+	assert.NotNil(t, err)
+}
+
+func TestContext(t *testing.T) {
+	var out bytes.Buffer
+
+	logger, _ := New(&out, "info")
+	entry := logger.WithField(FieldRequestID, "abc123")
+
+	ctx := NewContext(context.Background(), entry)
+
+	assert.Equal(t, entry, FromContext(ctx))
+	assert.Equal(t, "abc123", RequestID(ctx))
+	assert.NotNil(t, FromContext(context.Background()))
+	assert.Equal(t, "", RequestID(context.Background()))
+	assert.Len(t, NewRequestID(), 16)
+}
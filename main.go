@@ -1,16 +1,57 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/gin-gonic/gin"
+	"github.com/rokoga/filas-backend/config"
+	"github.com/rokoga/filas-backend/logging"
 	"github.com/rokoga/filas-backend/web"
 )
 
+// defaultConfigPath is used when FILAS_CONFIG is not set
+const defaultConfigPath = "config/dev/.env"
+
 func main() {
 
-	done := make(chan string)
-	go web.Run(done)
+	configPath := os.Getenv("FILAS_CONFIG")
+	if configPath == "" {
+		configPath = defaultConfigPath
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	logger, err := logging.New(os.Stdout, cfg.Log.Level)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if cfg.Log.Level != "debug" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		stop()
+	}()
 
-	fmt.Print(<-done)
+	if err := web.Run(ctx, cfg, logger); err != nil {
+		logger.WithError(err).Error("server failed")
+		os.Exit(1)
+	}
 
 }
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rokoga/filas-backend/event"
+)
+
+const namespace = "filas"
+
+// Metrics holds the Prometheus collectors of the API
+type Metrics struct {
+	registry     *prometheus.Registry
+	httpDuration *prometheus.HistogramVec
+	dbDuration   *prometheus.HistogramVec
+	queueLength  *prometheus.GaugeVec
+	queueEvents  *prometheus.CounterVec
+	waitDuration *prometheus.HistogramVec
+}
+
+// New registers the collectors in a registry of their own, along with the
+// Go runtime and process collectors
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by route and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		dbDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "mongo_operation_duration_seconds",
+			Help:      "Latency of MongoDB operations by repository method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation", "result"}),
+		queueLength: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "queue_length",
+			Help:      "Consumers waiting in the queue of a store.",
+		}, []string{"store"}),
+		queueEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "queue_events_total",
+			Help:      "Queue changes by store and event type.",
+		}, []string{"store", "event"}),
+		waitDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "queue_wait_seconds",
+			Help:      "Time consumers waited between joining and being called.",
+			Buckets:   []float64{60, 300, 600, 900, 1200, 1800, 2700, 3600, 5400, 7200},
+		}, []string{"store"}),
+	}
+
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.httpDuration,
+		m.dbDuration,
+		m.queueLength,
+		m.queueEvents,
+		m.waitDuration,
+	)
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records a served HTTP request
+func (m *Metrics) ObserveRequest(method, route string, status int, elapsed time.Duration) {
+	m.httpDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(elapsed.Seconds())
+}
+
+// ObserveDBOperation records a database operation and whether it failed
+func (m *Metrics) ObserveDBOperation(operation string, err error, elapsed time.Duration) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+
+	m.dbDuration.WithLabelValues(operation, result).Observe(elapsed.Seconds())
+}
+
+// SetQueueLength records the consumers waiting in a store
+func (m *Metrics) SetQueueLength(storeID string, length int) {
+	m.queueLength.WithLabelValues(storeID).Set(float64(length))
+}
+
+// CountQueueEvent records a queue change, such as a join or a call
+func (m *Metrics) CountQueueEvent(storeID, eventType string) {
+	m.queueEvents.WithLabelValues(storeID, eventType).Inc()
+}
+
+// ObserveWait records how long a consumer waited to be called
+func (m *Metrics) ObserveWait(storeID string, wait time.Duration) {
+	m.waitDuration.WithLabelValues(storeID).Observe(wait.Seconds())
+}
+
+// RemoveStore drops the series of a removed store
+func (m *Metrics) RemoveStore(storeID string) {
+	m.queueLength.DeleteLabelValues(storeID)
+	m.waitDuration.DeleteLabelValues(storeID)
+	for _, eventType := range event.Types {
+		m.queueEvents.DeleteLabelValues(storeID, eventType)
+	}
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rokoga/filas-backend/event"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueMetrics(t *testing.T) {
+	m := New()
+
+	m.SetQueueLength("store1", 3)
+	m.CountQueueEvent("store1", event.ConsumerJoined)
+	m.CountQueueEvent("store1", event.ConsumerJoined)
+	m.CountQueueEvent("store1", event.ConsumerCancelled)
+	m.ObserveWait("store1", 10*time.Minute)
+
+	assert.Equal(t, float64(3), testutil.ToFloat64(m.queueLength.WithLabelValues("store1")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.queueEvents.WithLabelValues("store1", event.ConsumerJoined)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.queueEvents.WithLabelValues("store1", event.ConsumerCancelled)))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.waitDuration))
+
+	m.RemoveStore("store1")
+
+	assert.Equal(t, 0, testutil.CollectAndCount(m.queueLength))
+	assert.Equal(t, 0, testutil.CollectAndCount(m.queueEvents))
+	assert.Equal(t, 0, testutil.CollectAndCount(m.waitDuration))
+}
+
+func TestObserveDBOperation(t *testing.T) {
+	m := New()
+
+	m.ObserveDBOperation("AddConsumer", nil, time.Millisecond)
+	m.ObserveDBOperation("AddConsumer", errors.New("timeout"), time.Millisecond)
+
+	assert.Equal(t, 2, testutil.CollectAndCount(m.dbDuration))
+}
+
+func TestHandler(t *testing.T) {
+	m := New()
+	m.ObserveRequest(http.MethodGet, "/store/id/:id", http.StatusOK, time.Millisecond)
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), `filas_http_request_duration_seconds_count{method="GET",route="/store/id/:id",status="200"} 1`))
+	assert.True(t, strings.Contains(w.Body.String(), "go_goroutines"))
+}
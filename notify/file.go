@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// FileNotifier writes each message as a JSON line instead of sending it,
+// for development
+type FileNotifier struct {
+	mu sync.Mutex
+	w  io.Writer
+	// closer is set when the notifier opened the file itself
+	closer io.Closer
+}
+
+// NewFileNotifier implements
+func NewFileNotifier(w io.Writer) *FileNotifier {
+	return &FileNotifier{w: w}
+}
+
+// Send implements
+func (n *FileNotifier) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(struct {
+		Message
+		SentAt time.Time `json:"sentAt"`
+	}{msg, time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	_, err = n.w.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the file opened by New, writers given to NewFileNotifier
+// are left open
+func (n *FileNotifier) Close() error {
+	if n.closer == nil {
+		return nil
+	}
+	return n.closer.Close()
+}
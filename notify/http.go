@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// HTTPNotifier sends messages through an SMS or WhatsApp gateway. Each
+// message is posted as JSON with the channel, the phone and the text.
+type HTTPNotifier struct {
+	url     string
+	token   string
+	channel string
+	client  *http.Client
+}
+
+// NewHTTPNotifier implements
+// token is sent as a bearer token when set, and timeout bounds each request.
+func NewHTTPNotifier(url, token, channel string, timeout time.Duration) *HTTPNotifier {
+	return &HTTPNotifier{
+		url:     url,
+		token:   token,
+		channel: channel,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// gatewayRequest is the body posted to the gateway
+type gatewayRequest struct {
+	Channel string `json:"channel"`
+	To      string `json:"to"`
+	Body    string `json:"body"`
+	// Reference lets the gateway report back which message it delivered
+	Reference string `json:"reference,omitempty"`
+}
+
+// Send implements
+// Any status other than 2xx is an error.
+func (n *HTTPNotifier) Send(ctx context.Context, msg Message) error {
+	payload, err := json.Marshal(gatewayRequest{
+		Channel:   n.channel,
+		To:        msg.To,
+		Body:      msg.Body,
+		Reference: msg.ConsumerID,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Drained so the connection is reused
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("gateway de notificação respondeu %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/rokoga/filas-backend/config"
+)
+
+// Message - A text message to a consumer
+type Message struct {
+	// To is the phone of the consumer in E.164
+	To   string `json:"to"`
+	Body string `json:"body"`
+	// Kind, StoreID and ConsumerID identify what the message is about
+	Kind       string `json:"kind"`
+	StoreID    string `json:"storeId"`
+	ConsumerID string `json:"consumerId"`
+}
+
+// Notifier - Sends messages to consumers
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the notifier of the configured provider. The file provider
+// keeps its file open, close it through io.Closer.
+func New(cfg config.NotifyConfig) (Notifier, error) {
+	switch cfg.Provider {
+	case "http":
+		return NewHTTPNotifier(cfg.URL, cfg.Token, cfg.Channel, cfg.Timeout), nil
+	case "file":
+		if cfg.File == "" {
+			return NewFileNotifier(os.Stdout), nil
+		}
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return &FileNotifier{w: f, closer: f}, nil
+	case "none":
+		return Discard{}, nil
+	}
+
+	return nil, fmt.Errorf("provedor de notificação desconhecido: %q", cfg.Provider)
+}
+
+// Discard drops every message
+type Discard struct{}
+
+// Send implements
+func (Discard) Send(ctx context.Context, msg Message) error {
+	return ctx.Err()
+}
+
+// Memory keeps the messages sent, for tests
+type Memory struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewMemory implements
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// Send implements
+func (m *Memory) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns a copy of the messages sent so far
+func (m *Memory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message(nil), m.messages...)
+}
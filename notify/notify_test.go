@@ -0,0 +1,80 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rokoga/filas-backend/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPNotifier(t *testing.T) {
+
+	ctx := context.Background()
+	msg := Message{To: "+5511988887777", Body: "Chegou a sua vez", Kind: "called", ConsumerID: "c1"}
+
+	var received gatewayRequest
+	status := http.StatusAccepted
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "Bearer segredo", r.Header.Get("Authorization"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	notifier := NewHTTPNotifier(server.URL, "segredo", "whatsapp", time.Second)
+
+	assert.Nil(t, notifier.Send(ctx, msg))
+	assert.Equal(t, gatewayRequest{Channel: "whatsapp", To: msg.To, Body: msg.Body, Reference: "c1"}, received)
+
+	status = http.StatusServiceUnavailable
+	assert.NotNil(t, notifier.Send(ctx, msg))
+}
+
+func TestFileNotifier(t *testing.T) {
+
+	var buf bytes.Buffer
+	notifier := NewFileNotifier(&buf)
+
+	assert.Nil(t, notifier.Send(context.Background(), Message{To: "+5511988887777", Body: "Olá", Kind: "joined"}))
+
+	var line map[string]interface{}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "+5511988887777", line["to"])
+	assert.Equal(t, "Olá", line["body"])
+	assert.Equal(t, "joined", line["kind"])
+	assert.NotEmpty(t, line["sentAt"])
+	assert.Nil(t, notifier.Close())
+}
+
+func TestNew(t *testing.T) {
+
+	tests := []struct {
+		cfg      config.NotifyConfig
+		notifier interface{}
+		valid    bool
+	}{
+		{cfg: config.NotifyConfig{Provider: "none"}, notifier: Discard{}, valid: true},
+		{cfg: config.NotifyConfig{Provider: "file"}, notifier: &FileNotifier{}, valid: true},
+		{cfg: config.NotifyConfig{Provider: "http", URL: "https://sms.example.com", Channel: "sms", Timeout: time.Second}, notifier: &HTTPNotifier{}, valid: true},
+		{cfg: config.NotifyConfig{Provider: "pombo"}, valid: false},
+	}
+
+	for _, test := range tests {
+		notifier, err := New(test.cfg)
+		if !test.valid {
+			assert.NotNil(t, err, test.cfg.Provider)
+			continue
+		}
+		assert.Nil(t, err, test.cfg.Provider)
+		assert.IsType(t, test.notifier, notifier, test.cfg.Provider)
+	}
+}
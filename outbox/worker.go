@@ -0,0 +1,135 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/logging"
+	"github.com/rokoga/filas-backend/notify"
+	"github.com/rokoga/filas-backend/repository"
+	"github.com/sirupsen/logrus"
+)
+
+// Options - How often the worker looks for messages and how it retries them
+type Options struct {
+	// PollInterval is the pause between drains of the outbox
+	PollInterval time.Duration
+	// Backoff is the wait after the first failure, doubled on every
+	// failure after it up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// MaxAttempts is how many failures move a message to the dead letters
+	MaxAttempts int
+	// Lease is how long a message stays locked while it is sent. It must be
+	// longer than the notifier takes to give up.
+	Lease time.Duration
+}
+
+// Worker sends the messages of the outbox through the notifier
+type Worker struct {
+	repo     repository.OutboxRepository
+	notifier notify.Notifier
+	opts     Options
+	now      func() time.Time
+}
+
+// NewWorker implements
+func NewWorker(repo repository.OutboxRepository, notifier notify.Notifier, opts Options) *Worker {
+	return &Worker{
+		repo:     repo,
+		notifier: notifier,
+		opts:     opts,
+		now:      time.Now,
+	}
+}
+
+// Run drains the outbox every PollInterval until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.Drain(ctx); err != nil && ctx.Err() == nil {
+			logging.FromContext(ctx).WithError(err).Error("outbox drain failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Drain sends every message due now and returns how many were attempted
+func (w *Worker) Drain(ctx context.Context) (int, error) {
+	attempted := 0
+
+	for ctx.Err() == nil {
+		message, err := w.repo.Claim(ctx, w.now().UTC(), w.opts.Lease)
+		if errors.Is(err, repository.ErrNoDueMessages) {
+			return attempted, nil
+		}
+		if err != nil {
+			return attempted, err
+		}
+
+		if err := w.deliver(ctx, message); err != nil {
+			return attempted, err
+		}
+		attempted++
+	}
+
+	return attempted, ctx.Err()
+}
+
+// deliver sends a claimed message and records the outcome. Only a failure
+// to record it is returned, the message itself is retried later.
+func (w *Worker) deliver(ctx context.Context, message *domain.OutboxMessage) error {
+	log := logging.FromContext(ctx).WithFields(logrus.Fields{
+		"message_id":   message.ID,
+		"store_id":     message.StoreID,
+		"consumer_id":  message.ConsumerID,
+		"notification": message.Kind,
+	})
+
+	err := w.notifier.Send(ctx, notify.Message{
+		To:         message.To,
+		Body:       message.Body,
+		Kind:       string(message.Kind),
+		StoreID:    message.StoreID,
+		ConsumerID: message.ConsumerID,
+	})
+	if err == nil {
+		return w.repo.MarkSent(ctx, message.ID, w.now().UTC())
+	}
+
+	if ctx.Err() != nil {
+		// Shutting down, the lock expires and the message is sent again
+		return ctx.Err()
+	}
+
+	attempts := message.Attempts + 1
+	dead := attempts >= w.opts.MaxAttempts
+	if dead {
+		log.WithError(err).WithField("attempts", attempts).Error("notification moved to dead letters")
+	} else {
+		log.WithError(err).WithField("attempts", attempts).Warn("notification failed, will retry")
+	}
+
+	return w.repo.MarkFailed(ctx, message.ID, err.Error(), w.now().UTC().Add(w.opts.Wait(attempts)), dead)
+}
+
+// Wait returns the wait after the given number of failed attempts
+func (opts Options) Wait(attempts int) time.Duration {
+	wait := opts.Backoff
+	for i := 1; i < attempts && wait < opts.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > opts.MaxBackoff {
+		wait = opts.MaxBackoff
+	}
+	return wait
+}
@@ -0,0 +1,171 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/notify"
+	"github.com/rokoga/filas-backend/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyNotifier fails the first failures messages and keeps the others
+type flakyNotifier struct {
+	failures int
+	sent     []notify.Message
+}
+
+func (n *flakyNotifier) Send(ctx context.Context, msg notify.Message) error {
+	if n.failures > 0 {
+		n.failures--
+		return errors.New("gateway indisponível")
+	}
+	n.sent = append(n.sent, msg)
+	return nil
+}
+
+func newTestWorker(repo repository.OutboxRepository, notifier notify.Notifier, now *time.Time) *Worker {
+	worker := NewWorker(repo, notifier, Options{
+		PollInterval: time.Second,
+		Backoff:      time.Minute,
+		MaxBackoff:   4 * time.Minute,
+		MaxAttempts:  3,
+		Lease:        time.Minute,
+	})
+	worker.now = func() time.Time { return *now }
+
+	return worker
+}
+
+func enqueue(t *testing.T, repo repository.OutboxRepository, now time.Time) string {
+	message := &domain.OutboxMessage{
+		StoreID:       "s1",
+		ConsumerID:    "c1",
+		Kind:          domain.NotifyCalled,
+		To:            "+5511988887777",
+		Body:          "Chegou a sua vez",
+		Status:        domain.DeliveryPending,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	}
+	assert.Nil(t, repo.Enqueue(context.Background(), message))
+
+	return message.ID
+}
+
+func TestDrainRetries(t *testing.T) {
+
+	ctx := context.Background()
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	repo := repository.NewOutboxMockRepository()
+	notifier := &flakyNotifier{failures: 2}
+	worker := newTestWorker(repo, notifier, &now)
+
+	enqueue(t, repo, now)
+
+	attempted, err := worker.Drain(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, attempted)
+
+	messages, err := repo.ListByConsumer(ctx, "s1", "c1")
+	assert.Nil(t, err)
+	assert.Equal(t, domain.DeliveryPending, messages[0].Status)
+	assert.Equal(t, 1, messages[0].Attempts)
+	assert.Equal(t, "gateway indisponível", messages[0].LastError)
+	assert.Equal(t, now.Add(time.Minute), messages[0].NextAttemptAt)
+
+	// Not due before its backoff
+	attempted, err = worker.Drain(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, attempted)
+
+	now = now.Add(time.Minute)
+	_, err = worker.Drain(ctx)
+	assert.Nil(t, err)
+
+	messages, _ = repo.ListByConsumer(ctx, "s1", "c1")
+	assert.Equal(t, now.Add(2*time.Minute), messages[0].NextAttemptAt)
+
+	now = now.Add(2 * time.Minute)
+	_, err = worker.Drain(ctx)
+	assert.Nil(t, err)
+
+	messages, _ = repo.ListByConsumer(ctx, "s1", "c1")
+	assert.Equal(t, domain.DeliverySent, messages[0].Status)
+	assert.Equal(t, 3, messages[0].Attempts)
+	assert.Equal(t, "", messages[0].LastError)
+	assert.Equal(t, now, *messages[0].SentAt)
+	assert.Len(t, notifier.sent, 1)
+	assert.Equal(t, notify.Message{To: "+5511988887777", Body: "Chegou a sua vez", Kind: "called", StoreID: "s1", ConsumerID: "c1"}, notifier.sent[0])
+}
+
+func TestDrainDeadLetter(t *testing.T) {
+
+	ctx := context.Background()
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	repo := repository.NewOutboxMockRepository()
+	notifier := &flakyNotifier{failures: 10}
+	worker := newTestWorker(repo, notifier, &now)
+
+	enqueue(t, repo, now)
+
+	for i := 0; i < 5; i++ {
+		_, err := worker.Drain(ctx)
+		assert.Nil(t, err)
+		now = now.Add(time.Hour)
+	}
+
+	messages, err := repo.ListByConsumer(ctx, "s1", "c1")
+	assert.Nil(t, err)
+	assert.Equal(t, domain.DeliveryDead, messages[0].Status)
+	assert.Equal(t, 3, messages[0].Attempts)
+	assert.Equal(t, 7, notifier.failures)
+}
+
+func TestDrainLocked(t *testing.T) {
+
+	ctx := context.Background()
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	repo := repository.NewOutboxMockRepository()
+	notifier := &flakyNotifier{}
+	worker := newTestWorker(repo, notifier, &now)
+
+	enqueue(t, repo, now)
+
+	// Claimed by a worker that died while sending
+	_, err := repo.Claim(ctx, now, time.Minute)
+	assert.Nil(t, err)
+
+	attempted, err := worker.Drain(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, attempted)
+
+	now = now.Add(time.Minute)
+	attempted, err = worker.Drain(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, attempted)
+	assert.Len(t, notifier.sent, 1)
+}
+
+func TestWait(t *testing.T) {
+
+	opts := Options{Backoff: 5 * time.Second, MaxBackoff: time.Minute}
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 5 * time.Second},
+		{attempts: 2, want: 10 * time.Second},
+		{attempts: 4, want: 40 * time.Second},
+		{attempts: 5, want: time.Minute},
+		{attempts: 50, want: time.Minute},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, opts.Wait(tt.attempts), tt.attempts)
+	}
+}
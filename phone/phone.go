@@ -0,0 +1,96 @@
+package phone
+
+import (
+	"strings"
+
+	"github.com/rokoga/filas-backend/apperror"
+)
+
+const (
+	// ErrorInvalidPhone for numbers that cannot be converted to E.164
+	ErrorInvalidPhone = "Número de telefone inválido"
+)
+
+var (
+	// ErrInvalidPhone for numbers that cannot be converted to E.164
+	ErrInvalidPhone = apperror.New(apperror.InvalidArgument, "invalid_phone", ErrorInvalidPhone)
+)
+
+// brazilCode is the country calling code assumed for national numbers
+const brazilCode = "55"
+
+// Normalize converts a phone number to E.164, e.g. "+5511999990000".
+// Numbers without a country code are read as Brazilian, with or without
+// the trunk prefix "0" and a carrier selection code ("0 15 11 ...").
+// Spaces, dots, dashes and parentheses are ignored.
+func Normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+
+	international := false
+	switch {
+	case strings.HasPrefix(raw, "+"):
+		international = true
+		raw = raw[1:]
+	case strings.HasPrefix(raw, "00"):
+		international = true
+		raw = raw[2:]
+	}
+
+	var digits strings.Builder
+	for _, r := range raw {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == ' ' || r == '.' || r == '-' || r == '(' || r == ')':
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+	number := digits.String()
+
+	if international {
+		if strings.HasPrefix(number, brazilCode) {
+			return normalizeBrazil(number[len(brazilCode):])
+		}
+		// Country calling codes never start with 0 and E.164 allows 15 digits
+		if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+			return "", ErrInvalidPhone
+		}
+		return "+" + number, nil
+	}
+
+	if strings.HasPrefix(number, "0") {
+		number = number[1:]
+		// A carrier selection code comes before the area code
+		if len(number) == 12 || len(number) == 13 {
+			number = number[2:]
+		}
+	} else if strings.HasPrefix(number, brazilCode) && (len(number) == 12 || len(number) == 13) {
+		number = number[len(brazilCode):]
+	}
+
+	return normalizeBrazil(number)
+}
+
+// normalizeBrazil validates a national number made of a two digit area code
+// followed by an 8 digit landline or a 9 digit mobile number
+func normalizeBrazil(national string) (string, error) {
+	if len(national) != 10 && len(national) != 11 {
+		return "", ErrInvalidPhone
+	}
+
+	// Area codes go from 11 to 99 and never contain a 0
+	if national[0] == '0' || national[1] == '0' {
+		return "", ErrInvalidPhone
+	}
+
+	subscriber := national[2:]
+	if len(subscriber) == 9 && subscriber[0] != '9' {
+		return "", ErrInvalidPhone
+	}
+	if len(subscriber) == 8 && (subscriber[0] < '2' || subscriber[0] > '5') {
+		return "", ErrInvalidPhone
+	}
+
+	return "+" + brazilCode + national, nil
+}
@@ -0,0 +1,42 @@
+package phone
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+
+	tests := []struct {
+		raw    string
+		result string
+		err    error
+	}{
+		{raw: "+55 11 99999-0000", result: "+5511999990000", err: nil},
+		{raw: "11999990000", result: "+5511999990000", err: nil},
+		{raw: "(11) 99999-0000", result: "+5511999990000", err: nil},
+		{raw: "011999990000", result: "+5511999990000", err: nil},
+		{raw: "0 15 11 99999-0000", result: "+5511999990000", err: nil},
+		{raw: "5511999990000", result: "+5511999990000", err: nil},
+		{raw: "0055 11 99999 0000", result: "+5511999990000", err: nil},
+		{raw: "(21) 3333-4444", result: "+552133334444", err: nil},
+		{raw: "+1 415 555 2671", result: "+14155552671", err: nil},
+		{raw: "+351 912 345 678", result: "+351912345678", err: nil},
+		{raw: "", result: "", err: ErrInvalidPhone},
+		{raw: "123", result: "", err: ErrInvalidPhone},
+		{raw: "1199999000a", result: "", err: ErrInvalidPhone},
+		{raw: "11899990000", result: "", err: ErrInvalidPhone},
+		{raw: "1199990000", result: "", err: ErrInvalidPhone},
+		{raw: "01999990000", result: "", err: ErrInvalidPhone},
+		{raw: "+0123456789", result: "", err: ErrInvalidPhone},
+		{raw: "+1234567890123456", result: "", err: ErrInvalidPhone},
+	}
+
+	for _, test := range tests {
+		result, err := Normalize(test.raw)
+		assert.Equal(t, test.err, err, test.raw)
+		assert.Equal(t, test.result, result, test.raw)
+	}
+
+}
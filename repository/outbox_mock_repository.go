@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rokoga/filas-backend/domain"
+)
+
+// OutboxMockRepositoryImpl implements
+type OutboxMockRepositoryImpl struct {
+	mu       sync.Mutex
+	messages []*domain.OutboxMessage
+	lastID   int
+}
+
+// NewOutboxMockRepository implements
+func NewOutboxMockRepository() OutboxRepository {
+	return &OutboxMockRepositoryImpl{}
+}
+
+// EnsureIndexes implements
+func (repo *OutboxMockRepositoryImpl) EnsureIndexes(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Enqueue implements
+func (repo *OutboxMockRepositoryImpl) Enqueue(ctx context.Context, messages ...*domain.OutboxMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for _, message := range messages {
+		if message.ID == "" {
+			repo.lastID++
+			message.ID = strconv.Itoa(repo.lastID)
+		}
+		stored := *message
+		repo.messages = append(repo.messages, &stored)
+	}
+
+	return nil
+}
+
+// Claim implements
+func (repo *OutboxMockRepositoryImpl) Claim(ctx context.Context, now time.Time, lease time.Duration) (*domain.OutboxMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	var due *domain.OutboxMessage
+	for _, message := range repo.messages {
+		if message.Status != domain.DeliveryPending || message.NextAttemptAt.After(now) {
+			continue
+		}
+		if message.LockedUntil != nil && message.LockedUntil.After(now) {
+			continue
+		}
+		if due == nil || message.NextAttemptAt.Before(due.NextAttemptAt) {
+			due = message
+		}
+	}
+
+	if due == nil {
+		return nil, ErrNoDueMessages
+	}
+
+	lockedUntil := now.Add(lease)
+	due.LockedUntil = &lockedUntil
+
+	claimed := *due
+	return &claimed, nil
+}
+
+// MarkSent implements
+func (repo *OutboxMockRepositoryImpl) MarkSent(ctx context.Context, id string, sentAt time.Time) error {
+	return repo.update(ctx, id, func(message *domain.OutboxMessage) {
+		message.Status = domain.DeliverySent
+		message.SentAt = &sentAt
+		message.LastError = ""
+	})
+}
+
+// MarkFailed implements
+func (repo *OutboxMockRepositoryImpl) MarkFailed(ctx context.Context, id string, lastError string, nextAttemptAt time.Time, dead bool) error {
+	return repo.update(ctx, id, func(message *domain.OutboxMessage) {
+		message.Status = domain.DeliveryPending
+		if dead {
+			message.Status = domain.DeliveryDead
+		}
+		message.LastError = lastError
+		message.NextAttemptAt = nextAttemptAt
+	})
+}
+
+func (repo *OutboxMockRepositoryImpl) update(ctx context.Context, id string, change func(*domain.OutboxMessage)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for _, message := range repo.messages {
+		if message.ID == id {
+			change(message)
+			message.Attempts++
+			message.LockedUntil = nil
+			return nil
+		}
+	}
+
+	return ErrNotFoundMessage
+}
+
+// ListByConsumer implements
+func (repo *OutboxMockRepositoryImpl) ListByConsumer(ctx context.Context, storeID, consumerID string) ([]*domain.OutboxMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	result := []*domain.OutboxMessage{}
+	for _, message := range repo.messages {
+		if message.StoreID == storeID && message.ConsumerID == consumerID {
+			copied := *message
+			result = append(result, &copied)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+
+	return result, nil
+}
+
+// RemoveByStore implements
+func (repo *OutboxMockRepositoryImpl) RemoveByStore(ctx context.Context, storeID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	kept := repo.messages[:0]
+	for _, message := range repo.messages {
+		if message.StoreID != storeID {
+			kept = append(kept, message)
+		}
+	}
+	repo.messages = kept
+
+	return nil
+}
@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/rokoga/filas-backend/apperror"
+	"github.com/rokoga/filas-backend/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// ErrorNoDueMessages for an outbox without messages to send now
+	ErrorNoDueMessages = "Não há mensagens para enviar"
+	// ErrorNotFoundMessage for message not found
+	ErrorNotFoundMessage = "Não foi encontrada a mensagem"
+)
+
+var (
+	// ErrNoDueMessages for an outbox without messages to send now
+	ErrNoDueMessages = apperror.New(apperror.NotFound, "no_due_messages", ErrorNoDueMessages)
+	// ErrNotFoundMessage for message not found
+	ErrNotFoundMessage = apperror.New(apperror.NotFound, "message_not_found", ErrorNotFoundMessage)
+)
+
+// OutboxRepositoryImpl implements
+type OutboxRepositoryImpl struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+}
+
+// NewOutboxRepository implements
+// timeout bounds every operation, on top of the caller context.
+func NewOutboxRepository(db *mongo.Collection, timeout time.Duration) OutboxRepository {
+	return &OutboxRepositoryImpl{
+		collection: db,
+		timeout:    timeout,
+	}
+}
+
+// EnsureIndexes implements
+// Due messages are found by status and time, and the messages of a
+// consumer by store and consumer.
+func (repo *OutboxRepositoryImpl) EnsureIndexes(ctx context.Context) error {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}},
+			Options: options.Index().SetName("status_nextAttemptAt"),
+		},
+		{
+			Keys:    bson.D{{Key: "storeId", Value: 1}, {Key: "consumerId", Value: 1}, {Key: "createdAt", Value: 1}},
+			Options: options.Index().SetName("storeId_consumerId_createdAt"),
+		},
+	}
+
+	_, err := repo.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// Enqueue implements
+// Called with the context of a transaction, the messages are only stored
+// if the queue change they are about is.
+func (repo *OutboxRepositoryImpl) Enqueue(ctx context.Context, messages ...*domain.OutboxMessage) error {
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	docs := make([]interface{}, 0, len(messages))
+	for _, message := range messages {
+		if message.ID == "" {
+			message.ID = primitive.NewObjectID().Hex()
+		}
+		docs = append(docs, message)
+	}
+
+	_, err := repo.collection.InsertMany(ctx, docs)
+	return err
+}
+
+// Claim implements
+// The pending message due the longest is locked until now plus lease with a
+// single find and update, so two workers never send the same message. A
+// worker that dies while sending leaves the lock to expire.
+func (repo *OutboxRepositoryImpl) Claim(ctx context.Context, now time.Time, lease time.Duration) (*domain.OutboxMessage, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "status", Value: domain.DeliveryPending},
+		{Key: "nextAttemptAt", Value: bson.D{{Key: "$lte", Value: now}}},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "lockedUntil", Value: bson.D{{Key: "$exists", Value: false}}}},
+			bson.D{{Key: "lockedUntil", Value: bson.D{{Key: "$lte", Value: now}}}},
+		}},
+	}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "lockedUntil", Value: now.Add(lease)}}},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var message domain.OutboxMessage
+
+	err := repo.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&message)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNoDueMessages
+		}
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+// MarkSent implements
+func (repo *OutboxRepositoryImpl) MarkSent(ctx context.Context, id string, sentAt time.Time) error {
+
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "status", Value: domain.DeliverySent},
+			{Key: "sentAt", Value: sentAt},
+		}},
+		{Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}},
+		{Key: "$unset", Value: bson.D{{Key: "lockedUntil", Value: ""}, {Key: "lastError", Value: ""}}},
+	}
+
+	return repo.update(ctx, id, update)
+}
+
+// MarkFailed implements
+// A dead message is never claimed again, any other is retried at
+// nextAttemptAt.
+func (repo *OutboxRepositoryImpl) MarkFailed(ctx context.Context, id string, lastError string, nextAttemptAt time.Time, dead bool) error {
+
+	status := domain.DeliveryPending
+	if dead {
+		status = domain.DeliveryDead
+	}
+
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "status", Value: status},
+			{Key: "lastError", Value: lastError},
+			{Key: "nextAttemptAt", Value: nextAttemptAt},
+		}},
+		{Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}},
+		{Key: "$unset", Value: bson.D{{Key: "lockedUntil", Value: ""}}},
+	}
+
+	return repo.update(ctx, id, update)
+}
+
+func (repo *OutboxRepositoryImpl) update(ctx context.Context, id string, update bson.D) error {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	result, err := repo.collection.UpdateOne(ctx, bson.D{{Key: "_id", Value: id}}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrNotFoundMessage
+	}
+
+	return nil
+}
+
+// ListByConsumer implements
+// The oldest messages come first.
+func (repo *OutboxRepositoryImpl) ListByConsumer(ctx context.Context, storeID, consumerID string) ([]*domain.OutboxMessage, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "storeId", Value: storeID},
+		{Key: "consumerId", Value: consumerID},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}})
+
+	cursor, err := repo.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []*domain.OutboxMessage{}
+
+	err = cursor.All(ctx, &messages)
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// RemoveByStore implements
+// Messages of a removed store are never sent, even the ones waiting.
+func (repo *OutboxRepositoryImpl) RemoveByStore(ctx context.Context, storeID string) error {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	_, err := repo.collection.DeleteMany(ctx, bson.D{{Key: "storeId", Value: storeID}})
+	return err
+}
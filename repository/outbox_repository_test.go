@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rokoga/filas-backend/config"
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/infra"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestOutbox(t *testing.T) {
+
+	ctx := context.Background()
+	cfg, err := config.Load("../config/tests/.env")
+	if err != nil {
+		panic(err)
+	}
+
+	dbClient, dbCollection, err := infra.GetConnection(cfg.Database)
+	if err != nil {
+		panic(err)
+	}
+	defer infra.CloseConnection(dbClient)
+
+	outboxCollection := dbCollection.Database().Collection(cfg.Database.OutboxCollection)
+	outbox := NewOutboxRepository(outboxCollection, cfg.Database.Timeout)
+	assert.Nil(t, outbox.EnsureIndexes(ctx))
+	defer outboxCollection.DeleteMany(ctx, bson.D{{Key: "storeId", Value: "outbox-test"}})
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	message := &domain.OutboxMessage{
+		StoreID:       "outbox-test",
+		ConsumerID:    "c1",
+		Kind:          domain.NotifyJoined,
+		To:            "+5511988887777",
+		Body:          "Você entrou na fila",
+		Status:        domain.DeliveryPending,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	}
+	assert.Nil(t, outbox.Enqueue(ctx, message))
+	assert.NotEmpty(t, message.ID)
+
+	claimed, err := outbox.Claim(ctx, now, time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, message.ID, claimed.ID)
+
+	// Locked until the lease expires
+	_, err = outbox.Claim(ctx, now, time.Minute)
+	assert.Equal(t, ErrNoDueMessages, err)
+
+	assert.Nil(t, outbox.MarkFailed(ctx, message.ID, "gateway indisponível", now.Add(time.Minute), false))
+
+	_, err = outbox.Claim(ctx, now, time.Minute)
+	assert.Equal(t, ErrNoDueMessages, err)
+
+	claimed, err = outbox.Claim(ctx, now.Add(time.Minute), time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, claimed.Attempts)
+
+	assert.Nil(t, outbox.MarkSent(ctx, message.ID, now.Add(time.Minute)))
+
+	messages, err := outbox.ListByConsumer(ctx, "outbox-test", "c1")
+	assert.Nil(t, err)
+	assert.Len(t, messages, 1)
+	assert.Equal(t, domain.DeliverySent, messages[0].Status)
+	assert.Equal(t, 2, messages[0].Attempts)
+	assert.Equal(t, "", messages[0].LastError)
+
+	assert.Equal(t, ErrNotFoundMessage, outbox.MarkSent(ctx, "unknown", now))
+
+	assert.Nil(t, outbox.RemoveByStore(ctx, "outbox-test"))
+	messages, err = outbox.ListByConsumer(ctx, "outbox-test", "c1")
+	assert.Nil(t, err)
+	assert.Empty(t, messages)
+}
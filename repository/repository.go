@@ -1,21 +1,101 @@
 package repository
 
 import (
+	"context"
+	"time"
+
 	"github.com/rokoga/filas-backend/domain"
 )
 
+// StoreSort - Order of a store listing
+type StoreSort string
+
+const (
+	// SortByName lists stores alphabetically, ignoring case
+	SortByName StoreSort = "name"
+	// SortByNameDesc lists stores in reverse alphabetical order
+	SortByNameDesc StoreSort = "-name"
+	// SortByCreated lists the oldest stores first
+	SortByCreated StoreSort = "created"
+	// SortByCreatedDesc lists the newest stores first
+	SortByCreatedDesc StoreSort = "-created"
+)
+
+// StoreListOptions - Search, order and page of a store listing
+type StoreListOptions struct {
+	// Search matches part of the name, ignoring case and accents
+	Search string
+	Sort   StoreSort
+	Limit  int
+	Offset int
+}
+
 // StoreRepository - Repository for persisting a Store
 type StoreRepository interface {
-	Create(store *domain.Store) (*domain.Store, error)
-	RemoveStore(id string) error
-	GetAllStores() ([]string, error)
-	GetStoreByID(id string) (*domain.Store, error)
-	GetStore(name string) (*domain.Store, error)
-	AddConsumer(id string, consumer *domain.Consumer) error
-	RemoveConsumer(id string, phone string) error
-	GetConsumer(id string, phone string) (int, *domain.Consumer, error)
-	GetAllConsumers(id string) ([]*domain.Consumer, error)
-	ValidateConsumer(storeName, accessKey string) (int, *domain.Consumer, error)
+	Create(ctx context.Context, store *domain.Store) (*domain.Store, error)
+	UpdateStore(ctx context.Context, store *domain.Store) (*domain.Store, error)
+	RemoveStore(ctx context.Context, id string) error
+	ListStores(ctx context.Context, opts StoreListOptions) ([]*domain.StoreSummary, int, error)
+	GetStoreByID(ctx context.Context, id string) (*domain.Store, error)
+	GetStore(ctx context.Context, name string) (*domain.Store, error)
+	GetStoreBySlug(ctx context.Context, slug string) (*domain.Store, error)
+	AddConsumer(ctx context.Context, id string, consumer *domain.Consumer, maxWaiting int) error
+	RemoveConsumer(ctx context.Context, id, queueID, consumerID string) error
+	GetConsumer(ctx context.Context, id, queueID, consumerID string) (int, *domain.Consumer, error)
+	GetAllConsumers(ctx context.Context, id, queueID string) ([]*domain.Consumer, error)
+	CountWaiting(ctx context.Context, id string) (int, error)
+	GetCallHistory(ctx context.Context, id, queueID string, limit int) ([]*domain.Consumer, error)
+	ValidateConsumer(ctx context.Context, storeSlug, accessKey string) (int, *domain.Consumer, error)
+	CallNext(ctx context.Context, id, queueID string) (*domain.Consumer, error)
+	CallNextFitting(ctx context.Context, id, queueID string, capacity, maxSkip int) (int, *domain.Consumer, error)
+	UpdateConsumerStatus(ctx context.Context, id, queueID, consumerID string, status domain.ConsumerStatus) error
+	SetAccessKey(ctx context.Context, id, queueID, consumerID, accessKey string) error
+	RevokeAccessKey(ctx context.Context, id, queueID, consumerID string) error
+	SetQueueMode(ctx context.Context, id string, mode domain.QueueMode, until *time.Time) error
+	AddStaff(ctx context.Context, id string, userID string) error
+	SetOwner(ctx context.Context, id string, userID string) error
+	EnsureIndexes(ctx context.Context) error
+	MigrateQueue(ctx context.Context) (int, error)
+	MigrateSlugs(ctx context.Context) (int, error)
+}
+
+// OutboxRepository - Repository for the messages waiting to be sent to consumers
+type OutboxRepository interface {
+	Enqueue(ctx context.Context, messages ...*domain.OutboxMessage) error
+	Claim(ctx context.Context, now time.Time, lease time.Duration) (*domain.OutboxMessage, error)
+	MarkSent(ctx context.Context, id string, sentAt time.Time) error
+	MarkFailed(ctx context.Context, id string, lastError string, nextAttemptAt time.Time, dead bool) error
+	ListByConsumer(ctx context.Context, storeID, consumerID string) ([]*domain.OutboxMessage, error)
+	RemoveByStore(ctx context.Context, storeID string) error
+	EnsureIndexes(ctx context.Context) error
+}
+
+// WebhookRepository - Repository for the webhooks of the stores and their deliveries
+type WebhookRepository interface {
+	CreateWebhook(ctx context.Context, webhook *domain.Webhook) error
+	GetWebhook(ctx context.Context, storeID, id string) (*domain.Webhook, error)
+	ListWebhooks(ctx context.Context, storeID string) ([]*domain.Webhook, error)
+	RemoveWebhook(ctx context.Context, storeID, id string) error
+	RemoveByStore(ctx context.Context, storeID string) error
+	EnqueueDeliveries(ctx context.Context, deliveries ...*domain.WebhookDelivery) error
+	ClaimDelivery(ctx context.Context, now time.Time, lease time.Duration) (*domain.WebhookDelivery, error)
+	MarkDelivered(ctx context.Context, id string, responseStatus int, deliveredAt time.Time) error
+	MarkDeliveryFailed(ctx context.Context, id string, responseStatus int, lastError string, nextAttemptAt time.Time, dead bool) error
+	ListDeliveries(ctx context.Context, storeID, webhookID string, limit int) ([]*domain.WebhookDelivery, error)
+	EnsureIndexes(ctx context.Context) error
+}
+
+// Transactor - Runs repository operations as a single change
+type Transactor interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// UserRepository - Repository for persisting store owner and staff accounts
+type UserRepository interface {
+	CreateUser(ctx context.Context, user *domain.User) (*domain.User, error)
+	GetUserByID(ctx context.Context, id string) (*domain.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*domain.User, error)
+	EnsureIndexes(ctx context.Context) error
 }
 
 // app.filas/outback/token?=24238971alkajrealm
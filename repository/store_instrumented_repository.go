@@ -0,0 +1,265 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/logging"
+	"github.com/rokoga/filas-backend/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+// StoreInstrumentedRepositoryImpl implements
+// It records the latency of every operation of the wrapped repository.
+type StoreInstrumentedRepositoryImpl struct {
+	next    StoreRepository
+	metrics *metrics.Metrics
+}
+
+// NewStoreInstrumentedRepository implements
+func NewStoreInstrumentedRepository(next StoreRepository, m *metrics.Metrics) StoreRepository {
+	return &StoreInstrumentedRepositoryImpl{
+		next:    next,
+		metrics: m,
+	}
+}
+
+func (repo *StoreInstrumentedRepositoryImpl) observe(ctx context.Context, operation string, start time.Time, err error) {
+	elapsed := time.Since(start)
+	repo.metrics.ObserveDBOperation(operation, err, elapsed)
+
+	entry := logging.FromContext(ctx).WithFields(logrus.Fields{
+		"operation":  operation,
+		"latency_ms": elapsed.Milliseconds(),
+	})
+	if err != nil {
+		entry = entry.WithError(err)
+	}
+	entry.Debug("mongo operation")
+}
+
+// Create implements
+func (repo *StoreInstrumentedRepositoryImpl) Create(ctx context.Context, store *domain.Store) (*domain.Store, error) {
+	start := time.Now()
+	result, err := repo.next.Create(ctx, store)
+	repo.observe(ctx, "Create", start, err)
+
+	return result, err
+}
+
+// UpdateStore implements
+func (repo *StoreInstrumentedRepositoryImpl) UpdateStore(ctx context.Context, store *domain.Store) (*domain.Store, error) {
+	start := time.Now()
+	result, err := repo.next.UpdateStore(ctx, store)
+	repo.observe(ctx, "UpdateStore", start, err)
+
+	return result, err
+}
+
+// RemoveStore implements
+func (repo *StoreInstrumentedRepositoryImpl) RemoveStore(ctx context.Context, id string) error {
+	start := time.Now()
+	err := repo.next.RemoveStore(ctx, id)
+	repo.observe(ctx, "RemoveStore", start, err)
+
+	return err
+}
+
+// ListStores implements
+func (repo *StoreInstrumentedRepositoryImpl) ListStores(ctx context.Context, opts StoreListOptions) ([]*domain.StoreSummary, int, error) {
+	start := time.Now()
+	result, total, err := repo.next.ListStores(ctx, opts)
+	repo.observe(ctx, "ListStores", start, err)
+
+	return result, total, err
+}
+
+// GetStoreByID implements
+func (repo *StoreInstrumentedRepositoryImpl) GetStoreByID(ctx context.Context, id string) (*domain.Store, error) {
+	start := time.Now()
+	result, err := repo.next.GetStoreByID(ctx, id)
+	repo.observe(ctx, "GetStoreByID", start, err)
+
+	return result, err
+}
+
+// GetStore implements
+func (repo *StoreInstrumentedRepositoryImpl) GetStore(ctx context.Context, name string) (*domain.Store, error) {
+	start := time.Now()
+	result, err := repo.next.GetStore(ctx, name)
+	repo.observe(ctx, "GetStore", start, err)
+
+	return result, err
+}
+
+// AddConsumer implements
+func (repo *StoreInstrumentedRepositoryImpl) AddConsumer(ctx context.Context, id string, consumer *domain.Consumer, maxWaiting int) error {
+	start := time.Now()
+	err := repo.next.AddConsumer(ctx, id, consumer, maxWaiting)
+	repo.observe(ctx, "AddConsumer", start, err)
+
+	return err
+}
+
+// RemoveConsumer implements
+func (repo *StoreInstrumentedRepositoryImpl) RemoveConsumer(ctx context.Context, id, queueID, consumerID string) error {
+	start := time.Now()
+	err := repo.next.RemoveConsumer(ctx, id, queueID, consumerID)
+	repo.observe(ctx, "RemoveConsumer", start, err)
+
+	return err
+}
+
+// GetConsumer implements
+func (repo *StoreInstrumentedRepositoryImpl) GetConsumer(ctx context.Context, id, queueID, consumerID string) (int, *domain.Consumer, error) {
+	start := time.Now()
+	position, consumer, err := repo.next.GetConsumer(ctx, id, queueID, consumerID)
+	repo.observe(ctx, "GetConsumer", start, err)
+
+	return position, consumer, err
+}
+
+// GetAllConsumers implements
+func (repo *StoreInstrumentedRepositoryImpl) GetAllConsumers(ctx context.Context, id, queueID string) ([]*domain.Consumer, error) {
+	start := time.Now()
+	result, err := repo.next.GetAllConsumers(ctx, id, queueID)
+	repo.observe(ctx, "GetAllConsumers", start, err)
+
+	return result, err
+}
+
+// CountWaiting implements
+func (repo *StoreInstrumentedRepositoryImpl) CountWaiting(ctx context.Context, id string) (int, error) {
+	start := time.Now()
+	result, err := repo.next.CountWaiting(ctx, id)
+	repo.observe(ctx, "CountWaiting", start, err)
+
+	return result, err
+}
+
+// GetStoreBySlug implements
+func (repo *StoreInstrumentedRepositoryImpl) GetStoreBySlug(ctx context.Context, slug string) (*domain.Store, error) {
+	start := time.Now()
+	result, err := repo.next.GetStoreBySlug(ctx, slug)
+	repo.observe(ctx, "GetStoreBySlug", start, err)
+
+	return result, err
+}
+
+// GetCallHistory implements
+func (repo *StoreInstrumentedRepositoryImpl) GetCallHistory(ctx context.Context, id, queueID string, limit int) ([]*domain.Consumer, error) {
+	start := time.Now()
+	result, err := repo.next.GetCallHistory(ctx, id, queueID, limit)
+	repo.observe(ctx, "GetCallHistory", start, err)
+
+	return result, err
+}
+
+// ValidateConsumer implements
+func (repo *StoreInstrumentedRepositoryImpl) ValidateConsumer(ctx context.Context, storeSlug, accessKey string) (int, *domain.Consumer, error) {
+	start := time.Now()
+	position, consumer, err := repo.next.ValidateConsumer(ctx, storeSlug, accessKey)
+	repo.observe(ctx, "ValidateConsumer", start, err)
+
+	return position, consumer, err
+}
+
+// CallNext implements
+func (repo *StoreInstrumentedRepositoryImpl) CallNext(ctx context.Context, id, queueID string) (*domain.Consumer, error) {
+	start := time.Now()
+	result, err := repo.next.CallNext(ctx, id, queueID)
+	repo.observe(ctx, "CallNext", start, err)
+
+	return result, err
+}
+
+// CallNextFitting implements
+func (repo *StoreInstrumentedRepositoryImpl) CallNextFitting(ctx context.Context, id, queueID string, capacity, maxSkip int) (int, *domain.Consumer, error) {
+	start := time.Now()
+	position, result, err := repo.next.CallNextFitting(ctx, id, queueID, capacity, maxSkip)
+	repo.observe(ctx, "CallNextFitting", start, err)
+
+	return position, result, err
+}
+
+// UpdateConsumerStatus implements
+func (repo *StoreInstrumentedRepositoryImpl) UpdateConsumerStatus(ctx context.Context, id, queueID, consumerID string, status domain.ConsumerStatus) error {
+	start := time.Now()
+	err := repo.next.UpdateConsumerStatus(ctx, id, queueID, consumerID, status)
+	repo.observe(ctx, "UpdateConsumerStatus", start, err)
+
+	return err
+}
+
+// SetAccessKey implements
+func (repo *StoreInstrumentedRepositoryImpl) SetAccessKey(ctx context.Context, id, queueID, consumerID, accessKey string) error {
+	start := time.Now()
+	err := repo.next.SetAccessKey(ctx, id, queueID, consumerID, accessKey)
+	repo.observe(ctx, "SetAccessKey", start, err)
+
+	return err
+}
+
+// RevokeAccessKey implements
+func (repo *StoreInstrumentedRepositoryImpl) RevokeAccessKey(ctx context.Context, id, queueID, consumerID string) error {
+	start := time.Now()
+	err := repo.next.RevokeAccessKey(ctx, id, queueID, consumerID)
+	repo.observe(ctx, "RevokeAccessKey", start, err)
+
+	return err
+}
+
+// SetQueueMode implements
+func (repo *StoreInstrumentedRepositoryImpl) SetQueueMode(ctx context.Context, id string, mode domain.QueueMode, until *time.Time) error {
+	start := time.Now()
+	err := repo.next.SetQueueMode(ctx, id, mode, until)
+	repo.observe(ctx, "SetQueueMode", start, err)
+
+	return err
+}
+
+// AddStaff implements
+func (repo *StoreInstrumentedRepositoryImpl) AddStaff(ctx context.Context, id string, userID string) error {
+	start := time.Now()
+	err := repo.next.AddStaff(ctx, id, userID)
+	repo.observe(ctx, "AddStaff", start, err)
+
+	return err
+}
+
+// SetOwner implements
+func (repo *StoreInstrumentedRepositoryImpl) SetOwner(ctx context.Context, id string, userID string) error {
+	start := time.Now()
+	err := repo.next.SetOwner(ctx, id, userID)
+	repo.observe(ctx, "SetOwner", start, err)
+
+	return err
+}
+
+// EnsureIndexes implements
+func (repo *StoreInstrumentedRepositoryImpl) EnsureIndexes(ctx context.Context) error {
+	start := time.Now()
+	err := repo.next.EnsureIndexes(ctx)
+	repo.observe(ctx, "EnsureIndexes", start, err)
+
+	return err
+}
+
+// MigrateQueue implements
+func (repo *StoreInstrumentedRepositoryImpl) MigrateQueue(ctx context.Context) (int, error) {
+	start := time.Now()
+	migrated, err := repo.next.MigrateQueue(ctx)
+	repo.observe(ctx, "MigrateQueue", start, err)
+
+	return migrated, err
+}
+
+// MigrateSlugs implements
+func (repo *StoreInstrumentedRepositoryImpl) MigrateSlugs(ctx context.Context) (int, error) {
+	start := time.Now()
+	migrated, err := repo.next.MigrateSlugs(ctx)
+	repo.observe(ctx, "MigrateSlugs", start, err)
+
+	return migrated, err
+}
@@ -0,0 +1,278 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/logging"
+	"github.com/rokoga/filas-backend/phone"
+	"github.com/rokoga/filas-backend/slug"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// legacyQueueIndex is the access key index of the embedded queue layout
+const legacyQueueIndex = "queue_accessKey_unique"
+
+// legacyStore is a store document that still embeds its queue
+type legacyStore struct {
+	ID    primitive.ObjectID `bson:"_id"`
+	Queue []legacyConsumer   `bson:"queue"`
+}
+
+// legacyConsumer is an embedded queue entry, whose ID was stored as "id"
+type legacyConsumer struct {
+	domain.Consumer `bson:",inline"`
+	LegacyID        string `bson:"id,omitempty"`
+}
+
+// MigrateQueue implements
+// Stores created before the queue got its own collection are moved one at
+// a time: their entries are inserted in the queue collection and the
+// embedded array is removed. Entries keep the same ID on every run, so a
+// store interrupted halfway is finished on the next one. Phones are
+// normalized to E.164 like the ones of new entries. It returns how many
+// entries were moved.
+func (repo *StoreRepositoryImpl) MigrateQueue(ctx context.Context) (int, error) {
+
+	filter := bson.D{{Key: "queue", Value: bson.D{{Key: "$exists", Value: true}}}}
+
+	cursor, err := repo.collection.Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+
+	for cursor.Next(ctx) {
+		var store legacyStore
+		if err := cursor.Decode(&store); err != nil {
+			return migrated, err
+		}
+
+		count, err := repo.migrateStore(ctx, &store)
+		if err != nil {
+			return migrated, err
+		}
+		migrated += count
+	}
+
+	if err := cursor.Err(); err != nil {
+		return migrated, err
+	}
+
+	if err := repo.setDefaultQueue(ctx); err != nil {
+		return migrated, err
+	}
+
+	return migrated, repo.dropLegacyIndex(ctx)
+}
+
+// setDefaultQueue moves the entries added before stores had several queues
+// to the default one, where the phone index sees them
+func (repo *StoreRepositoryImpl) setDefaultQueue(ctx context.Context) error {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	filter := bson.D{{Key: "queueId", Value: bson.D{{Key: "$exists", Value: false}}}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "queueId", Value: domain.DefaultQueueID}}}}
+
+	_, err := repo.queue.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// migrateStore moves the entries of store to the queue collection. The
+// embedded array is only removed once every entry is there or was rejected
+// as a duplicate of another entry, which is logged and dropped.
+func (repo *StoreRepositoryImpl) migrateStore(ctx context.Context, store *legacyStore) (int, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	storeID := store.ID.Hex()
+	log := logging.FromContext(ctx).WithField("store_id", storeID)
+
+	var entries []interface{}
+
+	for i := range store.Queue {
+		consumer := store.Queue[i].Consumer
+		consumer.StoreID = storeID
+		consumer.QueueID = consumer.JoinedQueue()
+		if consumer.ID == "" {
+			consumer.ID = store.Queue[i].LegacyID
+		}
+		if consumer.ID == "" {
+			// The same on every run, so an entry moved before is recognised
+			consumer.ID = storeID + "-" + strconv.Itoa(i)
+		}
+		if consumer.JoinedAt == nil {
+			// Entries older than joinedAt keep the order of the array
+			joinedAt := store.ID.Timestamp().Add(time.Duration(i) * time.Millisecond)
+			consumer.JoinedAt = &joinedAt
+		}
+		if consumer.Phone != "" {
+			normalized, err := phone.Normalize(consumer.Phone)
+			if err != nil {
+				log.WithFields(logrus.Fields{"consumer_id": consumer.ID, logging.FieldPhone: consumer.Phone}).Warn("legacy phone kept as is, it is not a valid number")
+			} else {
+				consumer.Phone = normalized
+			}
+		}
+		entries = append(entries, &consumer)
+	}
+
+	moved := len(entries)
+
+	if len(entries) > 0 {
+		opts := options.InsertMany().SetOrdered(false)
+		if _, err := repo.queue.InsertMany(ctx, entries, opts); err != nil {
+			rejected, err := repo.rejectedEntries(ctx, log, entries, err)
+			if err != nil {
+				return 0, err
+			}
+			moved -= rejected
+		}
+	}
+
+	filter := bson.D{{Key: "_id", Value: store.ID}}
+	update := bson.D{{Key: "$unset", Value: bson.D{{Key: "queue", Value: ""}}}}
+
+	if _, err := repo.collection.UpdateOne(ctx, filter, update); err != nil {
+		return 0, err
+	}
+
+	return moved, nil
+}
+
+// rejectedEntries checks the entries an insert of entries failed on and
+// returns how many were not inserted. Entries already in the collection
+// were moved by an earlier run, any other duplicate is logged and dropped.
+// err is returned as is when an entry failed for another reason.
+func (repo *StoreRepositoryImpl) rejectedEntries(ctx context.Context, log *logrus.Entry, entries []interface{}, err error) (int, error) {
+	bulkErr, ok := err.(mongo.BulkWriteException)
+	if !ok || !isDuplicateKeyError(err) {
+		return 0, err
+	}
+
+	for _, we := range bulkErr.WriteErrors {
+		consumer := entries[we.Index].(*domain.Consumer)
+
+		count, err := repo.queue.CountDocuments(ctx, bson.D{{Key: "_id", Value: consumer.ID}})
+		if err != nil {
+			return 0, err
+		}
+		if count > 0 {
+			continue
+		}
+
+		duplicate := "accessKey"
+		if strings.Contains(we.Message, "index: "+consumerPhoneIndex+" ") {
+			duplicate = "phone"
+		}
+		log.WithFields(logrus.Fields{
+			"consumer_id":      consumer.ID,
+			"status":           consumer.Status,
+			"duplicate":        duplicate,
+			logging.FieldPhone: consumer.Phone,
+		}).Warn("legacy queue entry dropped, another entry has the same key")
+	}
+
+	return len(bulkErr.WriteErrors), nil
+}
+
+// dropLegacyIndex removes the index on the embedded queue, if still there
+func (repo *StoreRepositoryImpl) dropLegacyIndex(ctx context.Context) error {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	return dropIndex(ctx, repo.collection, legacyQueueIndex)
+}
+
+// dropIndex removes the named index of collection, if still there
+func dropIndex(ctx context.Context, collection *mongo.Collection, name string) error {
+	const (
+		namespaceNotFound = 26
+		indexNotFound     = 27
+	)
+
+	_, err := collection.Indexes().DropOne(ctx, name)
+	if e, ok := err.(mongo.CommandError); ok && (e.Code == namespaceNotFound || e.Code == indexNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+// MigrateSlugs implements
+// Stores created before slugs get one from their name, and the path of
+// their URL is updated to match. It returns how many stores were updated.
+func (repo *StoreRepositoryImpl) MigrateSlugs(ctx context.Context) (int, error) {
+
+	filter := bson.D{{Key: "slug", Value: bson.D{{Key: "$exists", Value: false}}}}
+
+	cursor, err := repo.collection.Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+
+	for cursor.Next(ctx) {
+		var store domain.Store
+		if err := cursor.Decode(&store); err != nil {
+			return migrated, err
+		}
+
+		if err := repo.migrateSlug(ctx, &store); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+
+	return migrated, cursor.Err()
+}
+
+func (repo *StoreRepositoryImpl) migrateSlug(ctx context.Context, store *domain.Store) error {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(store.ID)
+	if err != nil {
+		return ErrParserID
+	}
+
+	base := slug.Make(store.Name)
+	if base == "" {
+		base = store.ID
+	}
+
+	for attempt := 1; attempt <= slug.MaxAttempts; attempt++ {
+		storeSlug := slug.WithSuffix(base, attempt)
+
+		set := bson.D{{Key: "slug", Value: storeSlug}}
+		if i := strings.LastIndex(store.URLName, "/mystore/"); i >= 0 {
+			set = append(set, bson.E{Key: "urlname", Value: store.URLName[:i] + "/mystore/" + storeSlug})
+		}
+
+		filter := bson.D{{Key: "_id", Value: oid}}
+		update := bson.D{{Key: "$set", Value: set}}
+
+		_, err := repo.collection.UpdateOne(ctx, filter, update)
+		if !isDuplicateKeyOn(err, storeSlugIndex) {
+			return err
+		}
+	}
+
+	return ErrSlugExists
+}
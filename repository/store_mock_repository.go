@@ -1,21 +1,28 @@
 package repository
 
 import (
-	"errors"
+	"context"
 	"math/rand"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/slug"
 )
 
 // MockStore implements
 type MockStore struct {
 	aStore []*domain.Store
+	// aQueue holds every consumer of every store, in the order they joined
+	aQueue []*domain.Consumer
 }
 
 // StoreMockRepositoryImpl implements
 type StoreMockRepositoryImpl struct {
+	mu        sync.RWMutex
 	mockStore MockStore
 }
 
@@ -24,12 +31,58 @@ func NewStoreMockRepository() StoreRepository {
 	return &StoreMockRepositoryImpl{
 		mockStore: MockStore{
 			aStore: nil,
+			aQueue: nil,
 		},
 	}
 }
 
+// EnsureIndexes implements
+func (repo *StoreMockRepositoryImpl) EnsureIndexes(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MigrateQueue implements
+func (repo *StoreMockRepositoryImpl) MigrateQueue(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, nil
+}
+
+// MigrateSlugs implements
+func (repo *StoreMockRepositoryImpl) MigrateSlugs(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, nil
+}
+
 // Create implements
-func (repo *StoreMockRepositoryImpl) Create(store *domain.Store) (*domain.Store, error) {
+func (repo *StoreMockRepositoryImpl) Create(ctx context.Context, store *domain.Store) (*domain.Store, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for _, elem := range repo.mockStore.aStore {
+		if strings.EqualFold(elem.Name, store.Name) {
+			return nil, ErrStoreExists
+		}
+		if store.Slug != "" && elem.Slug == store.Slug {
+			return nil, ErrSlugExists
+		}
+	}
+	if store.Slug != "" && repo.slugGivenUp("", store.Slug) {
+		return nil, ErrSlugExists
+	}
 
 	if store.ID == "" {
 		s1 := rand.NewSource(time.Now().UnixNano())
@@ -42,8 +95,67 @@ func (repo *StoreMockRepositoryImpl) Create(store *domain.Store) (*domain.Store,
 	return store, nil
 }
 
+// UpdateStore implements
+func (repo *StoreMockRepositoryImpl) UpdateStore(ctx context.Context, store *domain.Store) (*domain.Store, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for _, elem := range repo.mockStore.aStore {
+		if elem.ID == store.ID {
+			continue
+		}
+		if strings.EqualFold(elem.Name, store.Name) {
+			return nil, ErrStoreExists
+		}
+		if elem.Slug == store.Slug {
+			return nil, ErrSlugExists
+		}
+	}
+	if repo.slugGivenUp(store.ID, store.Slug) {
+		return nil, ErrSlugExists
+	}
+
+	for i, elem := range repo.mockStore.aStore {
+		if elem.ID == store.ID {
+			if elem.Version != store.Version {
+				return nil, ErrStoreVersionConflict
+			}
+
+			// Only the fields written by the Mongo repository change
+			updated := *elem
+			updated.Name = store.Name
+			updated.Slug = store.Slug
+			updated.URLName = store.URLName
+			updated.Contact = store.Contact
+			updated.Address = store.Address
+			updated.LogoURL = store.LogoURL
+			updated.OpeningHours = store.OpeningHours
+			updated.Settings = store.Settings
+			updated.Queues = store.Queues
+			updated.MessageTemplates = store.MessageTemplates
+			updated.PreviousSlugs = store.PreviousSlugs
+			updated.Version++
+			repo.mockStore.aStore[i] = &updated
+
+			return repo.withQueue(&updated), nil
+		}
+	}
+
+	return nil, ErrNotFoundStore
+}
+
 // RemoveStore implements
-func (repo *StoreMockRepositoryImpl) RemoveStore(id string) error {
+func (repo *StoreMockRepositoryImpl) RemoveStore(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
 
 	for i, elem := range repo.mockStore.aStore {
 		if elem.ID == id {
@@ -51,119 +163,608 @@ func (repo *StoreMockRepositoryImpl) RemoveStore(id string) error {
 			repo.mockStore.aStore[len(repo.mockStore.aStore)-1] = nil
 			repo.mockStore.aStore = repo.mockStore.aStore[:len(repo.mockStore.aStore)-1]
 
+			var queue []*domain.Consumer
+			for _, consumer := range repo.mockStore.aQueue {
+				if consumer.StoreID != id {
+					queue = append(queue, consumer)
+				}
+			}
+			repo.mockStore.aQueue = queue
+
 			return nil
 		}
 	}
 
-	return errors.New(ErrorNotFoundStore)
+	return ErrNotFoundStore
 }
 
-// GetAllStores implements
-func (repo *StoreMockRepositoryImpl) GetAllStores() ([]string, error) {
-	var result []string
+// ListStores implements
+// Stores are kept in the order they were created.
+func (repo *StoreMockRepositoryImpl) ListStores(ctx context.Context, opts StoreListOptions) ([]*domain.StoreSummary, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	search := strings.ToLower(opts.Search)
+	searchSlug := slug.Make(opts.Search)
+	now := time.Now()
+
+	var matches []*domain.StoreSummary
 
-	for _, value := range repo.mockStore.aStore {
-		result = append(result, value.Name)
+	for _, elem := range repo.mockStore.aStore {
+		if search != "" && !strings.Contains(strings.ToLower(elem.Name), search) &&
+			(searchSlug == "" || !strings.Contains(elem.Slug, searchSlug)) {
+			continue
+		}
+
+		state := elem.QueueState(now)
+		waiting := Filter(repo.storeQueue(elem.ID), func(status domain.ConsumerStatus) bool {
+			return status == domain.StatusWaiting
+		})
+
+		matches = append(matches, &domain.StoreSummary{
+			ID:          elem.ID,
+			Name:        elem.Name,
+			Slug:        elem.Slug,
+			Open:        state.Status == domain.QueueOpen,
+			State:       state,
+			QueueLength: len(waiting),
+		})
+	}
+
+	switch opts.Sort {
+	case SortByCreatedDesc:
+		for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+			matches[i], matches[j] = matches[j], matches[i]
+		}
+	case SortByName, SortByNameDesc, "":
+		sort.SliceStable(matches, func(i, j int) bool {
+			if opts.Sort == SortByNameDesc {
+				i, j = j, i
+			}
+			return strings.ToLower(matches[i].Name) < strings.ToLower(matches[j].Name)
+		})
 	}
 
-	return result, nil
+	total := len(matches)
+	result := []*domain.StoreSummary{}
+
+	for i := opts.Offset; i < total && len(result) < opts.Limit; i++ {
+		result = append(result, matches[i])
+	}
+
+	return result, total, nil
 }
 
 // GetStoreByID implements
-func (repo *StoreMockRepositoryImpl) GetStoreByID(id string) (*domain.Store, error) {
+func (repo *StoreMockRepositoryImpl) GetStoreByID(ctx context.Context, id string) (*domain.Store, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
 	for _, elem := range repo.mockStore.aStore {
 		if elem.ID == id {
-			return elem, nil
+			return repo.withQueue(elem), nil
 		}
 	}
-	return nil, errors.New(ErrorNotFoundStore)
+	return nil, ErrNotFoundStore
 }
 
 // GetStore implements
-func (repo *StoreMockRepositoryImpl) GetStore(name string) (*domain.Store, error) {
+func (repo *StoreMockRepositoryImpl) GetStore(ctx context.Context, name string) (*domain.Store, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
 	for _, elem := range repo.mockStore.aStore {
-		if elem.Name == name {
-			return elem, nil
+		if strings.EqualFold(elem.Name, name) {
+			return repo.withQueue(elem), nil
 		}
 	}
 
-	return nil, errors.New(ErrorNotFoundStore)
+	return nil, ErrNotFoundStore
 }
 
-// AddConsumer implements
-func (repo *StoreMockRepositoryImpl) AddConsumer(id string, consumer *domain.Consumer) error {
+// GetStoreBySlug implements
+func (repo *StoreMockRepositoryImpl) GetStoreBySlug(ctx context.Context, storeSlug string) (*domain.Store, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-	for _, elem := range repo.mockStore.aStore {
-		if elem.ID == id {
-			elem.Queue = append(elem.Queue, consumer)
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
 
-			return nil
+	if elem := repo.findStoreBySlug(storeSlug); elem != nil {
+		return repo.withQueue(elem), nil
+	}
+
+	return nil, ErrNotFoundStore
+}
+
+// withQueue returns a copy of the store with the consumers still waiting or
+// called, like the stores read from Mongo. It must be called with the lock
+// held.
+func (repo *StoreMockRepositoryImpl) withQueue(store *domain.Store) *domain.Store {
+	result := *store
+	result.Queue = nil
+	for _, consumer := range repo.storeQueue(store.ID) {
+		if consumer.Status.Active() {
+			result.Queue = append(result.Queue, consumer)
 		}
 	}
+	return &result
+}
 
-	return errors.New(ErrorNotFoundStore)
+// storeQueue must be called with the lock held
+func (repo *StoreMockRepositoryImpl) storeQueue(id string) []*domain.Consumer {
+	var queue []*domain.Consumer
+	for _, consumer := range repo.mockStore.aQueue {
+		if consumer.StoreID == id {
+			queue = append(queue, consumer)
+		}
+	}
+	return queue
 }
 
-// RemoveConsumer implements
-func (repo *StoreMockRepositoryImpl) RemoveConsumer(id string, phone string) error {
+// lineQueue returns the consumers of one queue of the store. It must be
+// called with the lock held.
+func (repo *StoreMockRepositoryImpl) lineQueue(id, queueID string) []*domain.Consumer {
+	var queue []*domain.Consumer
+	for _, consumer := range repo.storeQueue(id) {
+		if consumer.InQueue(queueID) {
+			queue = append(queue, consumer)
+		}
+	}
+	return queue
+}
 
+// findStore must be called with the lock held
+func (repo *StoreMockRepositoryImpl) findStore(id string) *domain.Store {
 	for _, elem := range repo.mockStore.aStore {
 		if elem.ID == id {
-			for i, cons := range elem.Queue {
-				if cons.Phone == phone {
-					copy(elem.Queue[i:], elem.Queue[i+1:])
-					elem.Queue[len(elem.Queue)-1] = nil
-					elem.Queue = elem.Queue[:len(elem.Queue)-1]
+			return elem
+		}
+	}
+	return nil
+}
 
-					return nil
-				}
+// slugGivenUp reports whether storeSlug is a previous slug of a store other
+// than id, unless the store with id already has it. It must be called with
+// the lock held.
+func (repo *StoreMockRepositoryImpl) slugGivenUp(id, storeSlug string) bool {
+	if store := repo.findStore(id); store != nil && store.Slug == storeSlug {
+		return false
+	}
+	for _, elem := range repo.mockStore.aStore {
+		if elem.ID == id {
+			continue
+		}
+		for _, previous := range elem.PreviousSlugs {
+			if previous == storeSlug {
+				return true
 			}
 		}
 	}
+	return false
+}
+
+// findStoreBySlug looks up the current slugs before the previous ones, and
+// the previous ones in the order the stores were created. It must be called
+// with the lock held.
+func (repo *StoreMockRepositoryImpl) findStoreBySlug(storeSlug string) *domain.Store {
+	for _, elem := range repo.mockStore.aStore {
+		if elem.Slug == storeSlug {
+			return elem
+		}
+	}
+	for _, elem := range repo.mockStore.aStore {
+		for _, previous := range elem.PreviousSlugs {
+			if previous == storeSlug {
+				return elem
+			}
+		}
+	}
+	return nil
+}
+
+// findConsumer must be called with the lock held
+func (repo *StoreMockRepositoryImpl) findConsumer(id, queueID, consumerID string) (*domain.Consumer, error) {
+	for _, consumer := range repo.lineQueue(id, queueID) {
+		if consumer.ID == consumerID {
+			return consumer, nil
+		}
+	}
+	return nil, ErrNotFoundConsumer
+}
+
+// AddConsumer implements
+func (repo *StoreMockRepositoryImpl) AddConsumer(ctx context.Context, id string, consumer *domain.Consumer, maxWaiting int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	store := repo.findStore(id)
+	if store == nil {
+		return ErrNotFoundStore
+	}
+	if store.FindQueue(consumer.JoinedQueue()) == nil {
+		return ErrNotFoundQueue
+	}
+
+	waiting := 0
+	for _, value := range repo.storeQueue(id) {
+		if value.Phone == consumer.Phone && value.Status.Active() && value.JoinedQueue() == consumer.JoinedQueue() {
+			return ErrConsumerExists
+		}
+		if value.Status == domain.StatusWaiting && value.JoinedQueue() == consumer.JoinedQueue() {
+			waiting++
+		}
+	}
+	if maxWaiting > 0 && consumer.Status == domain.StatusWaiting && waiting >= maxWaiting {
+		return ErrQueueFull
+	}
+
+	if repo.accessKeyInUse(consumer.Accesskey) {
+		return ErrAccessKeyExists
+	}
+
+	if consumer.ID == "" {
+		consumer.ID = strconv.Itoa(rand.Int())
+	}
+	consumer.StoreID = id
+
+	repo.mockStore.aQueue = append(repo.mockStore.aQueue, consumer)
+
+	return nil
+}
+
+// RemoveConsumer implements
+func (repo *StoreMockRepositoryImpl) RemoveConsumer(ctx context.Context, id, queueID, consumerID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	return errors.New(ErrorNotFoundConsumer)
+	return repo.UpdateConsumerStatus(ctx, id, queueID, consumerID, domain.StatusCancelled)
 }
 
 // GetConsumer implements
-func (repo *StoreMockRepositoryImpl) GetConsumer(id string, phone string) (int, *domain.Consumer, error) {
+func (repo *StoreMockRepositoryImpl) GetConsumer(ctx context.Context, id, queueID, consumerID string) (int, *domain.Consumer, error) {
+	if err := ctx.Err(); err != nil {
+		return -1, nil, err
+	}
 
-	for _, elem := range repo.mockStore.aStore {
-		if elem.ID == id {
-			for i, consumer := range elem.Queue {
-				if consumer.Phone == phone {
-					return i, consumer, nil
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	if repo.findStore(id) == nil {
+		return -1, nil, ErrNotFoundStore
+	}
+
+	queue := repo.lineQueue(id, queueID)
+	for i, consumer := range queue {
+		if consumer.ID == consumerID {
+			return Position(queue, i), consumer, nil
+		}
+	}
+
+	return -1, nil, ErrNotFoundConsumer
+}
+
+// GetAllConsumers implements
+func (repo *StoreMockRepositoryImpl) GetAllConsumers(ctx context.Context, id, queueID string) ([]*domain.Consumer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	if repo.findStore(id) == nil {
+		return nil, ErrNotFoundStore
+	}
+
+	return Filter(repo.lineQueue(id, queueID), func(status domain.ConsumerStatus) bool {
+		return status == domain.StatusWaiting
+	}), nil
+}
+
+// CountWaiting implements
+func (repo *StoreMockRepositoryImpl) CountWaiting(ctx context.Context, id string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return -1, err
+	}
+
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	count := 0
+	for _, consumer := range repo.mockStore.aQueue {
+		if consumer.StoreID == id && consumer.Status == domain.StatusWaiting {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// GetCallHistory implements
+func (repo *StoreMockRepositoryImpl) GetCallHistory(ctx context.Context, id, queueID string, limit int) ([]*domain.Consumer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	history := []*domain.Consumer{}
+	for _, consumer := range repo.lineQueue(id, queueID) {
+		if consumer.CalledAt != nil {
+			history = append(history, consumer)
+		}
+	}
+
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].CalledAt.After(*history[j].CalledAt)
+	})
+	if len(history) > limit {
+		history = history[:limit]
+	}
+
+	return history, nil
+}
+
+// ValidateConsumer implements
+func (repo *StoreMockRepositoryImpl) ValidateConsumer(ctx context.Context, storeSlug, accessKey string) (int, *domain.Consumer, error) {
+	if err := ctx.Err(); err != nil {
+		return -1, nil, err
+	}
+
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	if elem := repo.findStoreBySlug(storeSlug); elem != nil {
+		for _, consumer := range repo.storeQueue(elem.ID) {
+			if consumer.Accesskey != accessKey || consumer.AccessKeyExpired(time.Now()) {
+				continue
+			}
+			queue := repo.lineQueue(elem.ID, consumer.JoinedQueue())
+			for i := range queue {
+				if queue[i] == consumer {
+					return Position(queue, i), consumer, nil
 				}
 			}
 		}
 	}
 
-	return -1, nil, errors.New(ErrorNotFoundConsumer)
+	return -1, nil, ErrNotValidAccessKey
 }
 
-// GetAllConsumers implements
-func (repo *StoreMockRepositoryImpl) GetAllConsumers(id string) ([]*domain.Consumer, error) {
+// CallNext implements
+func (repo *StoreMockRepositoryImpl) CallNext(ctx context.Context, id, queueID string) (*domain.Consumer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if repo.findStore(id) == nil {
+		return nil, ErrNotFoundStore
+	}
+
+	for _, consumer := range repo.lineQueue(id, queueID) {
+		if consumer.Status == domain.StatusWaiting {
+			calledAt := time.Now().UTC()
+			consumer.Status = domain.StatusCalled
+			consumer.CalledAt = &calledAt
+
+			return consumer, nil
+		}
+	}
+
+	return nil, ErrEmptyQueue
+}
+
+// CallNextFitting implements
+func (repo *StoreMockRepositoryImpl) CallNextFitting(ctx context.Context, id, queueID string, capacity, maxSkip int) (int, *domain.Consumer, error) {
+	if err := ctx.Err(); err != nil {
+		return -1, nil, err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if repo.findStore(id) == nil {
+		return -1, nil, ErrNotFoundStore
+	}
+
+	position := 0
+	for _, consumer := range repo.lineQueue(id, queueID) {
+		if consumer.Status != domain.StatusWaiting {
+			continue
+		}
+		if maxSkip > 0 && position > maxSkip {
+			break
+		}
+		if consumer.Party() <= capacity {
+			calledAt := time.Now().UTC()
+			consumer.Status = domain.StatusCalled
+			consumer.CalledAt = &calledAt
+
+			return position, consumer, nil
+		}
+		position++
+	}
+
+	if position == 0 {
+		return -1, nil, ErrEmptyQueue
+	}
+
+	return -1, nil, ErrNoFittingParty
+}
+
+// UpdateConsumerStatus implements
+func (repo *StoreMockRepositoryImpl) UpdateConsumerStatus(ctx context.Context, id, queueID, consumerID string, status domain.ConsumerStatus) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	consumer, err := repo.findConsumer(id, queueID, consumerID)
+	if err != nil {
+		return err
+	}
+
+	next, err := consumer.Status.Transition(status)
+	if err != nil {
+		return err
+	}
+	consumer.Status = next
+	now := time.Now().UTC()
+	if next == domain.StatusServed {
+		consumer.ServedAt = &now
+	}
+	if !next.Active() {
+		expiresAt := now.Add(AccessKeyLifetime)
+		consumer.AccessKeyExpiresAt = &expiresAt
+	}
+
+	return nil
+}
+
+// SetAccessKey implements
+func (repo *StoreMockRepositoryImpl) SetAccessKey(ctx context.Context, id, queueID, consumerID, accessKey string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if repo.accessKeyInUse(accessKey) {
+		return ErrAccessKeyExists
+	}
+
+	consumer, err := repo.findConsumer(id, queueID, consumerID)
+	if err != nil {
+		return err
+	}
+
+	if !consumer.Status.Active() {
+		return ErrConsumerStatusChanged
+	}
+	consumer.Accesskey = accessKey
+	consumer.AccessKeyExpiresAt = nil
+
+	return nil
+}
+
+// RevokeAccessKey implements
+func (repo *StoreMockRepositoryImpl) RevokeAccessKey(ctx context.Context, id, queueID, consumerID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	consumer, err := repo.findConsumer(id, queueID, consumerID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	consumer.AccessKeyExpiresAt = &now
+
+	return nil
+}
+
+// accessKeyInUse must be called with the lock held
+func (repo *StoreMockRepositoryImpl) accessKeyInUse(accessKey string) bool {
+	for _, consumer := range repo.mockStore.aQueue {
+		if consumer.Accesskey == accessKey {
+			return true
+		}
+	}
+	return false
+}
+
+// SetQueueMode implements
+func (repo *StoreMockRepositoryImpl) SetQueueMode(ctx context.Context, id string, mode domain.QueueMode, until *time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
 
 	for _, elem := range repo.mockStore.aStore {
 		if elem.ID == id {
-			return elem.Queue, nil
+			elem.Mode = mode
+			elem.PausedUntil = until
+
+			return nil
 		}
 	}
 
-	return nil, errors.New(ErrorNotFoundStore)
+	return ErrNotFoundStore
 }
 
-// ValidateConsumer implements
-func (repo *StoreMockRepositoryImpl) ValidateConsumer(storeName, accessKey string) (int, *domain.Consumer, error) {
+// AddStaff implements
+func (repo *StoreMockRepositoryImpl) AddStaff(ctx context.Context, id string, userID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
 
 	for _, elem := range repo.mockStore.aStore {
-		if elem.ID == storeName {
-			for i, consumer := range elem.Queue {
-				if consumer.Accesskey == accessKey {
-					return i, consumer, nil
-				}
+		if elem.ID == id {
+			if !elem.IsManagedBy(userID) {
+				elem.Staff = append(elem.Staff, userID)
 			}
+
+			return nil
 		}
 	}
 
-	return -1, nil, errors.New(ErrorNotValidAccessKey)
+	return ErrNotFoundStore
+}
+
+// SetOwner implements
+func (repo *StoreMockRepositoryImpl) SetOwner(ctx context.Context, id string, userID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	store := repo.findStore(id)
+	if store == nil {
+		return ErrNotFoundStore
+	}
+	if store.OwnerID != "" {
+		return ErrStoreHasOwner
+	}
+
+	store.OwnerID = userID
+	store.Version++
+
+	return nil
 }
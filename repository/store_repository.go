@@ -2,13 +2,17 @@ package repository
 
 import (
 	"context"
-	"errors"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/rokoga/filas-backend/apperror"
 	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/slug"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const (
@@ -24,268 +28,1246 @@ const (
 	ErrorConsumerExists = "Consumidor já cadastrado na fila"
 	// ErrorParserID for error parsing ID string
 	ErrorParserID = "Erro ao fazer parser do ID"
+	// ErrorAccessKeyExists for access key already in use
+	ErrorAccessKeyExists = "Chave de acesso já utilizada"
+	// ErrorEmptyQueue for queue without waiting consumers
+	ErrorEmptyQueue = "Não há consumidores aguardando na fila"
+	// ErrorNoFittingParty for a table no waiting party fits
+	ErrorNoFittingParty = "Nenhum grupo aguardando cabe na mesa"
+	// ErrorQueueChanged for a queue that kept changing during a call
+	ErrorQueueChanged = "A fila mudou durante a chamada, tente novamente"
+	// ErrorStoreExists for already created store
+	ErrorStoreExists = "Estabelecimento com nome já cadastrado"
+	// ErrorSlugExists for a store address already in use
+	ErrorSlugExists = "Endereço do estabelecimento já utilizado"
+	// ErrorStoreVersionConflict for a store changed since it was read
+	ErrorStoreVersionConflict = "O estabelecimento foi alterado por outra pessoa, recarregue e tente novamente"
+	// ErrorConsumerStatusChanged for a consumer whose status changed before the update
+	ErrorConsumerStatusChanged = "O status do consumidor mudou, recarregue e tente novamente"
+	// ErrorStoreHasOwner for an owner assigned to a store that already has one
+	ErrorStoreHasOwner = "O estabelecimento já tem um dono"
+	// ErrorQueueFull for a queue that reached its limit
+	ErrorQueueFull = "A fila do estabelecimento está cheia"
+	// ErrorNotFoundQueue for a queue the store does not have
+	ErrorNotFoundQueue = "Não foi encontrada a fila do estabelecimento"
 )
 
+var (
+	// ErrNotFoundStore for store not found
+	ErrNotFoundStore = apperror.New(apperror.NotFound, "store_not_found", ErrorNotFoundStore)
+	// ErrNotFoundAllStores for store not found
+	ErrNotFoundAllStores = apperror.New(apperror.Internal, "stores_query_failed", ErrorNotFoundAllStores)
+	// ErrNotFoundConsumer for consumer not found
+	ErrNotFoundConsumer = apperror.New(apperror.NotFound, "consumer_not_found", ErrorNotFoundConsumer)
+	// ErrNotValidAccessKey for accessKey not found
+	ErrNotValidAccessKey = apperror.New(apperror.NotFound, "invalid_access_key", ErrorNotValidAccessKey)
+	// ErrConsumerExists for consumer already exists
+	ErrConsumerExists = apperror.New(apperror.AlreadyExists, "consumer_exists", ErrorConsumerExists)
+	// ErrParserID for error parsing ID string
+	ErrParserID = apperror.New(apperror.InvalidArgument, "invalid_id", ErrorParserID)
+	// ErrAccessKeyExists for access key already in use
+	ErrAccessKeyExists = apperror.New(apperror.Conflict, "access_key_exists", ErrorAccessKeyExists)
+	// ErrEmptyQueue for queue without waiting consumers
+	ErrEmptyQueue = apperror.New(apperror.NotFound, "queue_empty", ErrorEmptyQueue)
+	// ErrNoFittingParty for a table no waiting party fits
+	ErrNoFittingParty = apperror.New(apperror.NotFound, "no_fitting_party", ErrorNoFittingParty)
+	// ErrQueueChanged for a queue that kept changing during a call
+	ErrQueueChanged = apperror.New(apperror.Conflict, "queue_changed", ErrorQueueChanged)
+	// ErrStoreExists for already created store
+	ErrStoreExists = apperror.New(apperror.AlreadyExists, "store_exists", ErrorStoreExists)
+	// ErrSlugExists for a store address already in use
+	ErrSlugExists = apperror.New(apperror.Conflict, "slug_exists", ErrorSlugExists)
+	// ErrStoreVersionConflict for a store changed since it was read
+	ErrStoreVersionConflict = apperror.New(apperror.Conflict, "store_version_conflict", ErrorStoreVersionConflict)
+	// ErrConsumerStatusChanged for a consumer whose status changed before the update
+	ErrConsumerStatusChanged = apperror.New(apperror.Conflict, "consumer_status_changed", ErrorConsumerStatusChanged)
+	// ErrStoreHasOwner for an owner assigned to a store that already has one
+	ErrStoreHasOwner = apperror.New(apperror.Conflict, "store_has_owner", ErrorStoreHasOwner)
+	// ErrQueueFull for a queue that reached its limit
+	ErrQueueFull = apperror.New(apperror.Conflict, "queue_full", ErrorQueueFull)
+	// ErrNotFoundQueue for a queue the store does not have
+	ErrNotFoundQueue = apperror.New(apperror.NotFound, "queue_not_found", ErrorNotFoundQueue)
+)
+
+// maxCallAttempts bounds how many times a call for a table looks for a party
+// again after another call took the one it chose
+const maxCallAttempts = 3
+
+// AccessKeyLifetime is how long an access key stays valid after the
+// consumer leaves the queue
+const AccessKeyLifetime = 24 * time.Hour
+
 // StoreRepositoryImpl implements
 type StoreRepositoryImpl struct {
 	collection *mongo.Collection
+	queue      *mongo.Collection
+	timeout    time.Duration
 }
 
 // NewStoreRepository implements
-func NewStoreRepository(db *mongo.Collection) StoreRepository {
+// db holds the stores and queue holds one document per consumer. timeout
+// bounds every operation, on top of the caller context.
+func NewStoreRepository(db *mongo.Collection, queue *mongo.Collection, timeout time.Duration) StoreRepository {
 	return &StoreRepositoryImpl{
 		collection: db,
+		queue:      queue,
+		timeout:    timeout,
 	}
 }
 
-// Create implements
-func (repo *StoreRepositoryImpl) Create(store *domain.Store) (*domain.Store, error) {
+// queueOrder sorts queue entries in the order consumers joined
+var queueOrder = bson.D{{Key: "joinedAt", Value: 1}, {Key: "_id", Value: 1}}
+
+// inQueue matches the entries of one queue of a store. Entries added before
+// stores had several queues have no queue and belong to the default one.
+func inQueue(queueID string) bson.E {
+	if queueID == domain.DefaultQueueID {
+		return bson.E{Key: "queueId", Value: bson.D{{Key: "$in", Value: bson.A{queueID, nil}}}}
+	}
+	return bson.E{Key: "queueId", Value: queueID}
+}
+
+// nameCollation compares store names ignoring case
+var nameCollation = &options.Collation{Locale: "pt", Strength: 2}
+
+const (
+	// storeNameIndex makes store names unique ignoring case
+	storeNameIndex = "name_unique"
+	// storeSlugIndex makes store slugs unique. Stores created before slugs
+	// are left out until MigrateSlugs fills them in.
+	storeSlugIndex = "slug_unique"
+	// consumerPhoneIndex lets a phone be waiting or called once in each
+	// queue of a store. Served, cancelled and no-show entries stay in the
+	// collection and are left out so the phone can join again.
+	consumerPhoneIndex = "storeId_queueId_phone_active"
+	// legacyPhoneIndex made a phone unique in a store whatever its status
+	legacyPhoneIndex = "storeId_phone_unique"
+	// consumerAccessKeyIndex makes access keys unique across every store
+	consumerAccessKeyIndex = "accessKey_unique"
+)
+
+// EnsureIndexes implements
+// Store names and slugs are unique. A phone is active once in each store
+// queue and access keys are unique across every queue. Entries without a
+// key are left out of the index so they do not collide on a missing key.
+func (repo *StoreRepositoryImpl) EnsureIndexes(ctx context.Context) error {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	if err := dropIndex(ctx, repo.queue, legacyPhoneIndex); err != nil {
+		return err
+	}
+
+	storeIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "name", Value: 1}},
+			Options: options.Index().
+				SetName(storeNameIndex).
+				SetUnique(true).
+				SetCollation(nameCollation),
+		},
+		{
+			Keys: bson.D{{Key: "slug", Value: 1}},
+			Options: options.Index().
+				SetName(storeSlugIndex).
+				SetUnique(true).
+				SetPartialFilterExpression(bson.D{
+					{Key: "slug", Value: bson.D{{Key: "$exists", Value: true}}},
+				}),
+		},
+		{
+			Keys:    bson.D{{Key: "previousSlugs", Value: 1}},
+			Options: options.Index().SetName("previousSlugs"),
+		},
+	}
+
+	if _, err := repo.collection.Indexes().CreateMany(ctx, storeIndexes); err != nil {
+		return err
+	}
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "storeId", Value: 1},
+				{Key: "status", Value: 1},
+				{Key: "joinedAt", Value: 1},
+			},
+			Options: options.Index().SetName("storeId_status_joinedAt"),
+		},
+		{
+			Keys: bson.D{
+				{Key: "storeId", Value: 1},
+				{Key: "queueId", Value: 1},
+				{Key: "status", Value: 1},
+				{Key: "joinedAt", Value: 1},
+			},
+			Options: options.Index().SetName("storeId_queueId_status_joinedAt"),
+		},
+		{
+			Keys: bson.D{
+				{Key: "storeId", Value: 1},
+				{Key: "queueId", Value: 1},
+				{Key: "phone", Value: 1},
+			},
+			Options: options.Index().
+				SetName(consumerPhoneIndex).
+				SetUnique(true).
+				SetPartialFilterExpression(bson.D{
+					{Key: "status", Value: bson.D{{Key: "$in", Value: bson.A{domain.StatusWaiting, domain.StatusCalled}}}},
+				}),
+		},
+		{
+			Keys: bson.D{{Key: "accessKey", Value: 1}},
+			Options: options.Index().
+				SetName(consumerAccessKeyIndex).
+				SetUnique(true).
+				SetPartialFilterExpression(bson.D{
+					{Key: "accessKey", Value: bson.D{{Key: "$exists", Value: true}}},
+				}),
+		},
+		{
+			Keys: bson.D{
+				{Key: "storeId", Value: 1},
+				{Key: "calledAt", Value: -1},
+			},
+			Options: options.Index().SetName("storeId_calledAt"),
+		},
+	}
+
+	_, err := repo.queue.Indexes().CreateMany(ctx, indexes)
+	return err
+}
 
-	// fmt.Printf("store %v \n", store)
+// Create implements
+// The unique indexes reject a name already in use, ignoring case, with
+// ErrStoreExists and a slug already in use with ErrSlugExists. A slug
+// another store had before is in use too.
+func (repo *StoreRepositoryImpl) Create(ctx context.Context, store *domain.Store) (*domain.Store, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
 	defer cancel()
 
+	if store.Slug != "" {
+		givenUp, err := repo.slugGivenUp(ctx, primitive.NilObjectID, store.Slug)
+		if err != nil {
+			return nil, err
+		}
+		if givenUp {
+			return nil, ErrSlugExists
+		}
+	}
+
 	result, err := repo.collection.InsertOne(ctx, store)
 	if err != nil {
+		if isDuplicateKeyOn(err, storeSlugIndex) {
+			return nil, ErrSlugExists
+		}
+		if isDuplicateKeyError(err) {
+			return nil, ErrStoreExists
+		}
 		return nil, err
 	}
 
 	strID := result.InsertedID.(primitive.ObjectID).Hex()
 
-	storeCreated, err := repo.GetStoreByID(strID)
+	storeCreated, err := repo.GetStoreByID(ctx, strID)
 	if err != nil {
-		return nil, errors.New(ErrorNotFoundStore)
+		return nil, ErrNotFoundStore
 	}
 
-	// fmt.Printf("storeCreated GetStore %v \n", storeCreated)
-
 	return storeCreated, nil
 }
 
+// UpdateStore implements
+// The profile and settings of the store are replaced only if its version is
+// still store.Version, and the version is then incremented. A store changed
+// in the meantime is rejected with ErrStoreVersionConflict. Stores created
+// before versioning have no version field and match version 0.
+func (repo *StoreRepositoryImpl) UpdateStore(ctx context.Context, store *domain.Store) (*domain.Store, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(store.ID)
+	if err != nil {
+		return nil, ErrParserID
+	}
+
+	version := bson.E{Key: "version", Value: store.Version}
+	if store.Version == 0 {
+		version.Value = bson.D{{Key: "$in", Value: bson.A{0, nil}}}
+	}
+
+	givenUp, err := repo.slugGivenUp(ctx, oid, store.Slug)
+	if err != nil {
+		return nil, err
+	}
+	if givenUp {
+		return nil, ErrSlugExists
+	}
+
+	filter := bson.D{{Key: "_id", Value: oid}, version}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "name", Value: store.Name},
+			{Key: "slug", Value: store.Slug},
+			{Key: "urlname", Value: store.URLName},
+			{Key: "contact", Value: store.Contact},
+			{Key: "address", Value: store.Address},
+			{Key: "logoUrl", Value: store.LogoURL},
+			{Key: "openingHours", Value: store.OpeningHours},
+			{Key: "settings", Value: store.Settings},
+			{Key: "queues", Value: store.Queues},
+			{Key: "messageTemplates", Value: store.MessageTemplates},
+			{Key: "previousSlugs", Value: store.PreviousSlugs},
+		}},
+		{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var updated domain.Store
+
+	err = repo.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updated)
+	if err != nil {
+		if isDuplicateKeyOn(err, storeSlugIndex) {
+			return nil, ErrSlugExists
+		}
+		if isDuplicateKeyError(err) {
+			return nil, ErrStoreExists
+		}
+		if err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		if err := repo.storeExists(ctx, store.ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrStoreVersionConflict
+	}
+
+	return repo.loadQueue(ctx, &updated)
+}
+
+// slugGivenUp reports whether storeSlug is a previous slug of a store other
+// than the one with oid, which keeps it so the links already shared still
+// lead there. A store that had the slug before it was kept may go on using
+// it.
+func (repo *StoreRepositoryImpl) slugGivenUp(ctx context.Context, oid primitive.ObjectID, storeSlug string) (bool, error) {
+
+	count, err := repo.collection.CountDocuments(ctx, bson.D{
+		{Key: "_id", Value: bson.D{{Key: "$ne", Value: oid}}},
+		{Key: "previousSlugs", Value: storeSlug},
+	}, options.Count().SetLimit(1))
+	if err != nil || count == 0 {
+		return false, err
+	}
+
+	count, err = repo.collection.CountDocuments(ctx, bson.D{
+		{Key: "_id", Value: oid},
+		{Key: "slug", Value: storeSlug},
+	}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+
+	return count == 0, nil
+}
+
 // RemoveStore implements
-func (repo *StoreRepositoryImpl) RemoveStore(id string) error {
+// The queue entries of the store are removed with it, callers run it in a
+// transaction with the removal of the rest of the store data.
+func (repo *StoreRepositoryImpl) RemoveStore(ctx context.Context, id string) error {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
 	defer cancel()
 
 	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return errors.New(ErrorParserID)
+		return ErrParserID
 	}
 
 	filter := bson.D{{Key: "_id", Value: oid}}
 
 	result, err := repo.collection.DeleteOne(ctx, filter)
-	if err != nil || result.DeletedCount == 0 {
-		return errors.New(ErrorNotFoundStore)
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFoundStore
 	}
 
-	return nil
+	_, err = repo.queue.DeleteMany(ctx, bson.D{{Key: "storeId", Value: id}})
+	return err
+}
+
+// storeSummaryProjection reads only the fields shown in the store listing
+// and the ones its queue state depends on
+var storeSummaryProjection = bson.D{
+	{Key: "_id", Value: 1},
+	{Key: "name", Value: 1},
+	{Key: "slug", Value: 1},
+	{Key: "openingHours", Value: 1},
+	{Key: "mode", Value: 1},
+	{Key: "pausedUntil", Value: 1},
 }
 
-// GetAllStores implements
-// TODO: usar find com setProjection
-func (repo *StoreRepositoryImpl) GetAllStores() ([]string, error) {
+// ListStores implements
+// Only the listed fields are read, and the queue lengths of the page come
+// from a single aggregation on the queue collection. It also returns how
+// many stores match the search.
+func (repo *StoreRepositoryImpl) ListStores(ctx context.Context, opts StoreListOptions) ([]*domain.StoreSummary, int, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
 	defer cancel()
 
-	cursor, err := repo.collection.Find(ctx, bson.M{})
+	filter := bson.D{}
+	if opts.Search != "" {
+		search := bson.A{
+			bson.D{{Key: "name", Value: primitive.Regex{Pattern: regexp.QuoteMeta(opts.Search), Options: "i"}}},
+		}
+		if storeSlug := slug.Make(opts.Search); storeSlug != "" {
+			search = append(search, bson.D{{Key: "slug", Value: primitive.Regex{Pattern: regexp.QuoteMeta(storeSlug)}}})
+		}
+		filter = bson.D{{Key: "$or", Value: search}}
+	}
+
+	total, err := repo.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, ErrNotFoundAllStores
+	}
+
+	findOpts := options.Find().
+		SetProjection(storeSummaryProjection).
+		SetSort(storeOrder(opts.Sort)).
+		SetCollation(nameCollation).
+		SetSkip(int64(opts.Offset)).
+		SetLimit(int64(opts.Limit))
+
+	cursor, err := repo.collection.Find(ctx, filter, findOpts)
 	if err != nil {
-		return nil, errors.New(ErrorNotFoundAllStores)
+		return nil, 0, ErrNotFoundAllStores
 	}
 
 	var stores []*domain.Store
 
 	err = cursor.All(ctx, &stores)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ids := make([]string, 0, len(stores))
+	for _, store := range stores {
+		ids = append(ids, store.ID)
+	}
+
+	lengths, err := repo.queueLengths(ctx, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	now := time.Now()
+	result := make([]*domain.StoreSummary, 0, len(stores))
+
+	for _, store := range stores {
+		state := store.QueueState(now)
+		result = append(result, &domain.StoreSummary{
+			ID:          store.ID,
+			Name:        store.Name,
+			Slug:        store.Slug,
+			Open:        state.Status == domain.QueueOpen,
+			State:       state,
+			QueueLength: lengths[store.ID],
+		})
+	}
+
+	return result, int(total), nil
+}
+
+// storeOrder returns the sort document of a store listing. The store ID
+// breaks ties so pages never overlap.
+func storeOrder(sort StoreSort) bson.D {
+	switch sort {
+	case SortByNameDesc:
+		return bson.D{{Key: "name", Value: -1}, {Key: "_id", Value: -1}}
+	case SortByCreated:
+		return bson.D{{Key: "_id", Value: 1}}
+	case SortByCreatedDesc:
+		return bson.D{{Key: "_id", Value: -1}}
+	default:
+		return bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}
+	}
+}
+
+// queueLengths counts the waiting consumers of each store
+func (repo *StoreRepositoryImpl) queueLengths(ctx context.Context, ids []string) (map[string]int, error) {
+
+	lengths := make(map[string]int, len(ids))
+	if len(ids) == 0 {
+		return lengths, nil
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{
+			{Key: "storeId", Value: bson.D{{Key: "$in", Value: ids}}},
+			{Key: "status", Value: domain.StatusWaiting},
+		}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$storeId"},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+	}
+
+	cursor, err := repo.queue.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
 
-	var result []string
+	var counts []struct {
+		StoreID string `bson:"_id"`
+		Count   int    `bson:"count"`
+	}
+
+	err = cursor.All(ctx, &counts)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, value := range stores {
-		result = append(result, value.Name)
+	for _, count := range counts {
+		lengths[count.StoreID] = count.Count
 	}
 
-	return result, nil
+	return lengths, nil
 }
 
 // GetStoreByID implements
-func (repo *StoreRepositoryImpl) GetStoreByID(id string) (*domain.Store, error) {
+func (repo *StoreRepositoryImpl) GetStoreByID(ctx context.Context, id string) (*domain.Store, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrParserID
+	}
+
+	return repo.findStoreWithQueue(ctx, bson.D{{Key: "_id", Value: oid}})
+}
+
+// GetStore implements
+// Names are compared ignoring case.
+func (repo *StoreRepositoryImpl) GetStore(ctx context.Context, name string) (*domain.Store, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	opts := options.FindOne().SetCollation(nameCollation)
+
+	return repo.findStoreWithQueue(ctx, bson.D{{Key: "name", Value: name}}, opts)
+}
+
+// GetStoreBySlug implements
+// A renamed store is still found by its previous slugs.
+func (repo *StoreRepositoryImpl) GetStoreBySlug(ctx context.Context, storeSlug string) (*domain.Store, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
 	defer cancel()
 
-	var storeGotID domain.Store
+	store, err := repo.findStoreBySlug(ctx, storeSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.loadQueue(ctx, store)
+}
+
+// findStore loads a store document without its queue. Lookups by name must
+// pass the name collation to match the unique index.
+func (repo *StoreRepositoryImpl) findStore(ctx context.Context, filter bson.D, opts ...*options.FindOneOptions) (*domain.Store, error) {
+
+	var store domain.Store
+
+	err := repo.collection.FindOne(ctx, filter, opts...).Decode(&store)
+	if err != nil {
+		return nil, ErrNotFoundStore
+	}
+
+	return &store, nil
+}
+
+// findStoreBySlug looks up the current slugs first: a store that took a slug
+// before another one kept it as a previous slug goes on owning it. When
+// several stores kept the slug the oldest one wins, so the match never
+// changes.
+func (repo *StoreRepositoryImpl) findStoreBySlug(ctx context.Context, storeSlug string) (*domain.Store, error) {
+
+	store, err := repo.findStore(ctx, bson.D{{Key: "slug", Value: storeSlug}})
+	if err != ErrNotFoundStore {
+		return store, err
+	}
+
+	opts := options.FindOne().SetSort(bson.D{{Key: "_id", Value: 1}})
+
+	return repo.findStore(ctx, bson.D{{Key: "previousSlugs", Value: storeSlug}}, opts)
+}
+
+// findStoreWithQueue loads a store with the consumers still waiting or called
+func (repo *StoreRepositoryImpl) findStoreWithQueue(ctx context.Context, filter bson.D, opts ...*options.FindOneOptions) (*domain.Store, error) {
+
+	store, err := repo.findStore(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.loadQueue(ctx, store)
+}
+
+// loadQueue fills the queue of the store with the consumers still waiting
+// or called
+func (repo *StoreRepositoryImpl) loadQueue(ctx context.Context, store *domain.Store) (*domain.Store, error) {
+
+	filter := bson.D{
+		{Key: "storeId", Value: store.ID},
+		{Key: "status", Value: bson.D{{Key: "$in", Value: []domain.ConsumerStatus{domain.StatusWaiting, domain.StatusCalled}}}},
+	}
+
+	queue, err := repo.findConsumers(ctx, filter, options.Find().SetSort(queueOrder))
+	if err != nil {
+		return nil, err
+	}
+	store.Queue = queue
+
+	return store, nil
+}
+
+// storeExists returns ErrNotFoundStore unless the store exists
+func (repo *StoreRepositoryImpl) storeExists(ctx context.Context, id string) error {
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFoundStore
+	}
+
+	_, err = repo.findStore(ctx, bson.D{{Key: "_id", Value: oid}})
+	return err
+}
+
+// findConsumers returns the queue entries matching the filter, never nil
+func (repo *StoreRepositoryImpl) findConsumers(ctx context.Context, filter bson.D, opts *options.FindOptions) ([]*domain.Consumer, error) {
+
+	cursor, err := repo.queue.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	consumers := []*domain.Consumer{}
+
+	err = cursor.All(ctx, &consumers)
+	if err != nil {
+		return nil, err
+	}
+
+	return consumers, nil
+}
+
+// position counts the waiting consumers that joined the queue before the
+// given one
+func (repo *StoreRepositoryImpl) position(ctx context.Context, consumer *domain.Consumer) (int, error) {
+
+	filter := bson.D{
+		{Key: "storeId", Value: consumer.StoreID},
+		inQueue(consumer.JoinedQueue()),
+		{Key: "status", Value: domain.StatusWaiting},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "joinedAt", Value: bson.D{{Key: "$lt", Value: consumer.JoinedAt}}}},
+			bson.D{
+				{Key: "joinedAt", Value: consumer.JoinedAt},
+				{Key: "_id", Value: bson.D{{Key: "$lt", Value: consumer.ID}}},
+			},
+		}},
+	}
+
+	count, err := repo.queue.CountDocuments(ctx, filter)
+	if err != nil {
+		return -1, err
+	}
+
+	return int(count), nil
+}
+
+// AddConsumer implements
+// The unique indexes on phone and access key make the insert fail when
+// either is already in use, so concurrent joins never duplicate a consumer.
+// A phone is only in use while its entry in the queue is active.
+// A waiting consumer is refused with ErrQueueFull once maxWaiting consumers
+// wait in the queue, zero means no limit. The store is written before the
+// count, so inside a transaction concurrent joins conflict and are retried
+// instead of both passing the limit.
+// The queue must still be in the store document when it is written, so a
+// join never lands in a queue removed meanwhile: ErrNotFoundQueue otherwise.
+func (repo *StoreRepositoryImpl) AddConsumer(ctx context.Context, id string, consumer *domain.Consumer, maxWaiting int) error {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
 
 	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, errors.New(ErrorParserID)
+		return ErrNotFoundStore
 	}
 
 	filter := bson.D{{Key: "_id", Value: oid}}
+	if consumer.JoinedQueue() != domain.DefaultQueueID {
+		filter = append(filter, bson.E{Key: "queues.id", Value: consumer.JoinedQueue()})
+	}
 
-	err = repo.collection.FindOne(ctx, filter).Decode(&storeGotID)
+	touched, err := repo.collection.UpdateOne(ctx,
+		filter,
+		bson.D{{Key: "$currentDate", Value: bson.D{{Key: "lastJoinedAt", Value: true}}}},
+	)
 	if err != nil {
-		return nil, errors.New(ErrorNotFoundStore)
+		return err
+	}
+	if touched.MatchedCount == 0 {
+		if err := repo.storeExists(ctx, id); err != nil {
+			return err
+		}
+		return ErrNotFoundQueue
 	}
 
-	return &storeGotID, nil
+	if maxWaiting > 0 && consumer.Status == domain.StatusWaiting {
+		waiting, err := repo.queue.CountDocuments(ctx, bson.D{
+			{Key: "storeId", Value: id},
+			inQueue(consumer.JoinedQueue()),
+			{Key: "status", Value: domain.StatusWaiting},
+		})
+		if err != nil {
+			return err
+		}
+		if int(waiting) >= maxWaiting {
+			return ErrQueueFull
+		}
+	}
+
+	if consumer.ID == "" {
+		consumer.ID = primitive.NewObjectID().Hex()
+	}
+	consumer.StoreID = id
+
+	_, err = repo.queue.InsertOne(ctx, consumer)
+	if isDuplicateKeyOn(err, consumerPhoneIndex) {
+		return ErrConsumerExists
+	}
+	if isDuplicateKeyOn(err, consumerAccessKeyIndex) {
+		return ErrAccessKeyExists
+	}
+
+	return err
 }
 
-// GetStore implements
-func (repo *StoreRepositoryImpl) GetStore(name string) (*domain.Store, error) {
+// RemoveConsumer implements
+// The consumer is kept in the queue with status "Cancelado".
+func (repo *StoreRepositoryImpl) RemoveConsumer(ctx context.Context, id, queueID, consumerID string) error {
+	return repo.UpdateConsumerStatus(ctx, id, queueID, consumerID, domain.StatusCancelled)
+}
+
+// GetConsumer implements
+func (repo *StoreRepositoryImpl) GetConsumer(ctx context.Context, id, queueID, consumerID string) (int, *domain.Consumer, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	var consumer domain.Consumer
+
+	filter := bson.D{
+		{Key: "_id", Value: consumerID},
+		{Key: "storeId", Value: id},
+		inQueue(queueID),
+	}
+
+	err := repo.queue.FindOne(ctx, filter).Decode(&consumer)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			return -1, nil, err
+		}
+		if err := repo.storeExists(ctx, id); err != nil {
+			return -1, nil, err
+		}
+		return -1, nil, ErrNotFoundConsumer
+	}
+
+	position, err := repo.position(ctx, &consumer)
+	if err != nil {
+		return -1, nil, err
+	}
+
+	return position, &consumer, nil
+}
+
+// GetAllConsumers implements
+func (repo *StoreRepositoryImpl) GetAllConsumers(ctx context.Context, id, queueID string) ([]*domain.Consumer, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
 	defer cancel()
 
-	var storeGotName domain.Store
+	if err := repo.storeExists(ctx, id); err != nil {
+		return nil, err
+	}
+
+	filter := bson.D{
+		{Key: "storeId", Value: id},
+		inQueue(queueID),
+		{Key: "status", Value: domain.StatusWaiting},
+	}
+
+	return repo.findConsumers(ctx, filter, options.Find().SetSort(queueOrder))
+}
+
+// CountWaiting implements
+// Every queue of the store is counted.
+func (repo *StoreRepositoryImpl) CountWaiting(ctx context.Context, id string) (int, error) {
 
-	// fmt.Printf("Name %v \n", name)
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
 
-	filter := bson.D{{Key: "name", Value: name}}
+	filter := bson.D{
+		{Key: "storeId", Value: id},
+		{Key: "status", Value: domain.StatusWaiting},
+	}
 
-	err := repo.collection.FindOne(ctx, filter).Decode(&storeGotName)
+	count, err := repo.queue.CountDocuments(ctx, filter)
 	if err != nil {
-		return nil, errors.New(ErrorNotFoundStore)
+		return -1, err
 	}
 
-	// fmt.Printf("storeGotName GetStore %v \n", storeGotName)
+	return int(count), nil
+}
+
+// GetCallHistory implements
+// The most recently called consumers come first.
+func (repo *StoreRepositoryImpl) GetCallHistory(ctx context.Context, id, queueID string, limit int) ([]*domain.Consumer, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "storeId", Value: id},
+		inQueue(queueID),
+		{Key: "calledAt", Value: bson.D{{Key: "$exists", Value: true}}},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "calledAt", Value: -1}}).
+		SetLimit(int64(limit))
 
-	return &storeGotName, nil
+	return repo.findConsumers(ctx, filter, opts)
 }
 
-// AddConsumer implements
-func (repo *StoreRepositoryImpl) AddConsumer(id string, consumer *domain.Consumer) error {
+// ValidateConsumer implements
+func (repo *StoreRepositoryImpl) ValidateConsumer(ctx context.Context, storeSlug, accessKey string) (int, *domain.Consumer, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
 	defer cancel()
 
-	store, err := repo.GetStoreByID(id)
+	store, err := repo.findStoreBySlug(ctx, storeSlug)
 	if err != nil {
-		return errors.New(ErrorNotFoundStore)
+		return -1, nil, err
+	}
+
+	var consumer domain.Consumer
+
+	filter := bson.D{
+		{Key: "storeId", Value: store.ID},
+		{Key: "accessKey", Value: accessKey},
 	}
 
-	for _, value := range store.Queue {
-		if value.Phone == consumer.Phone {
-			return errors.New(ErrorConsumerExists)
+	err = repo.queue.FindOne(ctx, filter).Decode(&consumer)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			return -1, nil, err
 		}
+		return -1, nil, ErrNotValidAccessKey
 	}
 
-	store.Queue = append(store.Queue, consumer)
+	if consumer.AccessKeyExpired(time.Now()) {
+		return -1, nil, ErrNotValidAccessKey
+	}
 
-	oid, err := primitive.ObjectIDFromHex(id)
+	position, err := repo.position(ctx, &consumer)
 	if err != nil {
-		return errors.New(ErrorParserID)
+		return -1, nil, err
 	}
 
-	filter := bson.D{{Key: "_id", Value: oid}}
+	return position, &consumer, nil
+}
+
+// CallNext implements
+// The waiting consumer who joined first is flagged as "Chamado" with a
+// single find and update, so two concurrent calls never pick the same
+// consumer.
+func (repo *StoreRepositoryImpl) CallNext(ctx context.Context, id, queueID string) (*domain.Consumer, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "storeId", Value: id},
+		inQueue(queueID),
+		{Key: "status", Value: domain.StatusWaiting},
+	}
 	update := bson.D{
-		{Key: "$set", Value: bson.D{{Key: "queue", Value: store.Queue}}},
+		{Key: "$set", Value: bson.D{
+			{Key: "status", Value: domain.StatusCalled},
+			{Key: "calledAt", Value: time.Now().UTC()},
+		}},
 	}
+	opts := options.FindOneAndUpdate().
+		SetSort(queueOrder).
+		SetReturnDocument(options.After)
 
-	_, err = repo.collection.UpdateOne(ctx, filter, update)
+	var consumer domain.Consumer
+
+	err := repo.queue.FindOneAndUpdate(ctx, filter, update, opts).Decode(&consumer)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		if err := repo.storeExists(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrEmptyQueue
+	}
+
+	return &consumer, nil
+}
+
+// CallNextFitting implements
+// The first maxSkip+1 waiting consumers are read in queue order and the
+// first whose party fits capacity is called. The update only matches a
+// consumer still waiting, so when another call took them in between the
+// queue is read again. Returns how many waiting consumers were passed over.
+func (repo *StoreRepositoryImpl) CallNextFitting(ctx context.Context, id, queueID string, capacity, maxSkip int) (int, *domain.Consumer, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "storeId", Value: id},
+		inQueue(queueID),
+		{Key: "status", Value: domain.StatusWaiting},
+	}
+	opts := options.Find().
+		SetSort(queueOrder).
+		SetProjection(bson.D{{Key: "partySize", Value: 1}})
+	if maxSkip > 0 {
+		opts.SetLimit(int64(maxSkip + 1))
+	}
+
+	for attempt := 1; attempt <= maxCallAttempts; attempt++ {
+		cursor, err := repo.queue.Find(ctx, filter, opts)
+		if err != nil {
+			return -1, nil, err
+		}
+
+		var waiting []domain.Consumer
+		if err := cursor.All(ctx, &waiting); err != nil {
+			return -1, nil, err
+		}
+
+		if len(waiting) == 0 {
+			if err := repo.storeExists(ctx, id); err != nil {
+				return -1, nil, err
+			}
+			return -1, nil, ErrEmptyQueue
+		}
+
+		position := -1
+		for i := range waiting {
+			if waiting[i].Party() <= capacity {
+				position = i
+				break
+			}
+		}
+		if position < 0 {
+			return -1, nil, ErrNoFittingParty
+		}
+
+		update := bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "status", Value: domain.StatusCalled},
+				{Key: "calledAt", Value: time.Now().UTC()},
+			}},
+		}
+		chosen := bson.D{
+			{Key: "_id", Value: waiting[position].ID},
+			{Key: "storeId", Value: id},
+			{Key: "status", Value: domain.StatusWaiting},
+		}
+
+		var consumer domain.Consumer
+
+		err = repo.queue.FindOneAndUpdate(ctx, chosen, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&consumer)
+		if err == nil {
+			return position, &consumer, nil
+		}
+		if err != mongo.ErrNoDocuments {
+			return -1, nil, err
+		}
+	}
+
+	return -1, nil, ErrQueueChanged
+}
+
+// UpdateConsumerStatus implements
+// The filter only matches a consumer whose current status can change to
+// the given one, so the transition is checked and applied atomically. When
+// nothing matches, the consumer is read again only to tell a missing
+// consumer from a conflict.
+func (repo *StoreRepositoryImpl) UpdateConsumerStatus(ctx context.Context, id, queueID, consumerID string, status domain.ConsumerStatus) error {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "_id", Value: consumerID},
+		{Key: "storeId", Value: id},
+		inQueue(queueID),
+		{Key: "status", Value: bson.D{{Key: "$in", Value: domain.StatusesLeadingTo(status)}}},
+	}
+	now := time.Now().UTC()
+
+	set := bson.D{{Key: "status", Value: status}}
+	if status == domain.StatusServed {
+		set = append(set, bson.E{Key: "servedAt", Value: now})
+	}
+	if !status.Active() {
+		set = append(set, bson.E{Key: "accessKeyExpiresAt", Value: now.Add(AccessKeyLifetime)})
+	}
+	update := bson.D{{Key: "$set", Value: set}}
+
+	result, err := repo.queue.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return err
 	}
 
+	if result.MatchedCount == 0 {
+		_, consumer, err := repo.GetConsumer(ctx, id, queueID, consumerID)
+		if err != nil {
+			return err
+		}
+		if _, err := consumer.Status.Transition(status); err != nil {
+			return err
+		}
+		// Read after another change made the transition legal again
+		return ErrConsumerStatusChanged
+	}
+
 	return nil
 }
 
-// RemoveConsumer implements
-func (repo *StoreRepositoryImpl) RemoveConsumer(id string, phone string) error {
-	store, err := repo.GetStoreByID(id)
+// SetAccessKey implements
+// Only consumers still in the queue can get a new key. Keys are random
+// enough that the unique index is the only collision check needed here.
+func (repo *StoreRepositoryImpl) SetAccessKey(ctx context.Context, id, queueID, consumerID, accessKey string) error {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "_id", Value: consumerID},
+		{Key: "storeId", Value: id},
+		inQueue(queueID),
+		{Key: "status", Value: bson.D{{Key: "$in", Value: []domain.ConsumerStatus{domain.StatusWaiting, domain.StatusCalled}}}},
+	}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "accessKey", Value: accessKey}}},
+		{Key: "$unset", Value: bson.D{{Key: "accessKeyExpiresAt", Value: ""}}},
+	}
+
+	result, err := repo.queue.UpdateOne(ctx, filter, update)
 	if err != nil {
-		return errors.New(ErrorNotFoundStore)
+		if isDuplicateKeyOn(err, consumerAccessKeyIndex) {
+			return ErrAccessKeyExists
+		}
+		return err
 	}
 
-	for i, consumer := range store.Queue {
-		if consumer.Phone == phone {
-			// Remove from queue
-			copy(store.Queue[i:], store.Queue[i+1:])
-			store.Queue[len(store.Queue)-1] = nil
-			store.Queue = store.Queue[:len(store.Queue)-1]
-			// Set status to removed
-			consumer.Status = "Cancelado"
-			store.Queue = append(store.Queue, consumer)
+	if result.MatchedCount == 0 {
+		if _, _, err := repo.GetConsumer(ctx, id, queueID, consumerID); err != nil {
+			return err
+		}
+		return ErrConsumerStatusChanged
+	}
 
-			oid, err := primitive.ObjectIDFromHex(id)
-			if err != nil {
-				return errors.New(ErrorParserID)
-			}
+	return nil
+}
 
-			filter := bson.D{{Key: "_id", Value: oid}}
-			update := bson.D{
-				{Key: "$set", Value: bson.D{{Key: "queue", Value: store.Queue}}},
-			}
+// RevokeAccessKey implements
+// The key is kept so it stays unique, but expires immediately.
+func (repo *StoreRepositoryImpl) RevokeAccessKey(ctx context.Context, id, queueID, consumerID string) error {
 
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
-			_, err = repo.collection.UpdateOne(ctx, filter, update)
-			if err != nil {
-				return err
-			}
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "_id", Value: consumerID},
+		{Key: "storeId", Value: id},
+		inQueue(queueID),
+	}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "accessKeyExpiresAt", Value: time.Now().UTC()}}},
+	}
+
+	result, err := repo.queue.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
 
-			return nil
+	if result.MatchedCount == 0 {
+		if err := repo.storeExists(ctx, id); err != nil {
+			return err
 		}
+		return ErrNotFoundConsumer
 	}
 
-	return errors.New(ErrorNotFoundConsumer)
+	return nil
 }
 
-// GetConsumer implements
-func (repo *StoreRepositoryImpl) GetConsumer(id string, phone string) (int, *domain.Consumer, error) {
+// SetQueueMode implements
+// The version is left alone, so switching the queue does not reject the
+// changes of someone editing the store at the same time.
+func (repo *StoreRepositoryImpl) SetQueueMode(ctx context.Context, id string, mode domain.QueueMode, until *time.Time) error {
 
-	store, err := repo.GetStoreByID(id)
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return -1, nil, errors.New(ErrorNotFoundStore)
+		return ErrNotFoundStore
 	}
 
-	for i, consumer := range store.Queue {
-		if consumer.Phone == phone {
-			return i, consumer, nil
+	filter := bson.D{{Key: "_id", Value: oid}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "mode", Value: mode}}},
+		{Key: "$unset", Value: bson.D{{Key: "pausedUntil", Value: ""}}},
+	}
+	if until != nil {
+		update = bson.D{
+			{Key: "$set", Value: bson.D{{Key: "mode", Value: mode}, {Key: "pausedUntil", Value: until}}},
 		}
 	}
 
-	return -1, nil, errors.New(ErrorNotFoundConsumer)
+	result, err := repo.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrNotFoundStore
+	}
+
+	return nil
 }
 
-// GetAllConsumers implements
-func (repo *StoreRepositoryImpl) GetAllConsumers(id string) ([]*domain.Consumer, error) {
+// AddStaff implements
+func (repo *StoreRepositoryImpl) AddStaff(ctx context.Context, id string, userID string) error {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFoundStore
+	}
+
+	filter := bson.D{{Key: "_id", Value: oid}}
+	update := bson.D{
+		{Key: "$addToSet", Value: bson.D{{Key: "staff", Value: userID}}},
+	}
 
-	store, err := repo.GetStoreByID(id)
+	result, err := repo.collection.UpdateOne(ctx, filter, update)
 	if err != nil {
-		return nil, errors.New(ErrorNotFoundStore)
+		return err
 	}
 
-	validQueue := Filter(store.Queue, func(val string) bool {
-		return val == "Na fila"
-	})
+	if result.MatchedCount == 0 {
+		return ErrNotFoundStore
+	}
 
-	return validQueue, nil
+	return nil
 }
 
-// ValidateConsumer implements
-func (repo *StoreRepositoryImpl) ValidateConsumer(storeName, accessKey string) (int, *domain.Consumer, error) {
+// SetOwner implements
+// Only stores without an owner, created before stores had one, are changed,
+// so an owner is never replaced.
+func (repo *StoreRepositoryImpl) SetOwner(ctx context.Context, id string, userID string) error {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
 
-	store, err := repo.GetStore(storeName)
+	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return -1, nil, errors.New(ErrorNotFoundStore)
+		return ErrNotFoundStore
 	}
 
-	for i, consumer := range store.Queue {
-		if consumer.Accesskey == accessKey {
-			return i, consumer, nil
+	filter := bson.D{
+		{Key: "_id", Value: oid},
+		{Key: "ownerId", Value: bson.D{{Key: "$in", Value: bson.A{nil, ""}}}},
+	}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "ownerId", Value: userID}}},
+		{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+	}
+
+	result, err := repo.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		if err := repo.storeExists(ctx, id); err != nil {
+			return err
 		}
+		return ErrStoreHasOwner
 	}
 
-	return -1, nil, errors.New(ErrorNotValidAccessKey)
+	return nil
+}
+
+// isDuplicateKeyError reports whether err was caused by a unique index. A
+// bulk write only counts when every failed document was a duplicate.
+func isDuplicateKeyError(err error) bool {
+	const duplicateKey = 11000
+
+	switch e := err.(type) {
+	case mongo.WriteException:
+		for _, we := range e.WriteErrors {
+			if we.Code == duplicateKey {
+				return true
+			}
+		}
+	case mongo.BulkWriteException:
+		for _, we := range e.WriteErrors {
+			if we.Code != duplicateKey {
+				return false
+			}
+		}
+		return len(e.WriteErrors) > 0 && e.WriteConcernError == nil
+	case mongo.CommandError:
+		return e.Code == duplicateKey
+	}
+
+	return false
+}
+
+// isDuplicateKeyOn reports whether err was caused by the named unique index
+func isDuplicateKeyOn(err error, index string) bool {
+	if !isDuplicateKeyError(err) {
+		return false
+	}
+	return strings.Contains(err.Error(), "index: "+index+" ")
 }
 
 // Filter implements
-func Filter(arr []*domain.Consumer, cond func(string) bool) []*domain.Consumer {
+func Filter(arr []*domain.Consumer, cond func(domain.ConsumerStatus) bool) []*domain.Consumer {
 	result := []*domain.Consumer{}
 	for _, item := range arr {
 		if cond(item.Status) {
@@ -294,3 +1276,16 @@ func Filter(arr []*domain.Consumer, cond func(string) bool) []*domain.Consumer {
 	}
 	return result
 }
+
+// Position returns how many waiting consumers are ahead of queue[index].
+// Cancelled consumers stay in the queue array, so the raw index is not the
+// position in line.
+func Position(queue []*domain.Consumer, index int) int {
+	position := 0
+	for _, consumer := range queue[:index] {
+		if consumer.Status == domain.StatusWaiting {
+			position++
+		}
+	}
+	return position
+}
@@ -1,30 +1,62 @@
 package repository
 
 import (
-	"errors"
+	"context"
+	"fmt"
+	"os"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/rokoga/filas-backend/config"
 	"github.com/rokoga/filas-backend/domain"
 	"github.com/rokoga/filas-backend/infra"
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+func TestMain(m *testing.M) {
+	// The configuration files commit no secret and Load requires one
+	if os.Getenv("AUTHSECRET") == "" {
+		os.Setenv("AUTHSECRET", "segredo-dos-testes")
+	}
+	os.Exit(m.Run())
+}
+
 func TestCreate(t *testing.T) {
 
-	dbClient, dbCollection, err := infra.GetConnection("../config/tests/.env")
+	ctx := context.Background()
+	cfg, err := config.Load("../config/tests/.env")
+	if err != nil {
+		panic(err)
+	}
+
+	dbClient, dbCollection, err := infra.GetConnection(cfg.Database)
 	if err != nil {
 		panic(err)
 	}
 	defer infra.CloseConnection(dbClient)
 
-	store := NewStoreRepository(dbCollection)
+	queueCollection := dbCollection.Database().Collection(cfg.Database.QueueCollection)
+	store := NewStoreRepository(dbCollection, queueCollection, cfg.Database.Timeout)
+	assert.Nil(t, store.EnsureIndexes(ctx))
 
 	newStore := domain.Store{
 		Name:    "Test Store",
+		Slug:    "test-store",
 		URLName: "test",
 		Queue:   nil,
 	}
-	store.Create(&newStore)
+	if created, err := store.Create(ctx, &newStore); err == nil {
+		defer store.RemoveStore(ctx, created.ID)
+	}
+
+	// Names are unique ignoring case and slugs are unique
+	_, err = store.Create(ctx, &domain.Store{Name: "TEST STORE", Slug: "test-store-2"})
+	assert.Equal(t, ErrStoreExists, err)
+	_, err = store.Create(ctx, &domain.Store{Name: "Another Store", Slug: "test-store"})
+	assert.Equal(t, ErrSlugExists, err)
 
 	tests := []struct {
 		urlName    string
@@ -35,17 +67,19 @@ func TestCreate(t *testing.T) {
 	}{
 		{urlName: "outback", name: "Outback", resultURL: "outback", resultName: "Outback", err: nil},
 		{urlName: "jeronimo", name: "Jeronimo", resultURL: "jeronimo", resultName: "Jeronimo", err: nil},
-		{urlName: "", name: "", resultURL: "", resultName: "", err: errors.New(ErrorNotFoundStore)},
+		{urlName: "", name: "", resultURL: "", resultName: "", err: ErrNotFoundStore},
 	}
 
 	for _, test := range tests {
 		newStore := domain.Store{
 			Name:    test.name,
+			Slug:    test.urlName,
 			URLName: test.urlName,
 			Queue:   nil,
 		}
-		result, err := store.Create(&newStore)
+		result, err := store.Create(ctx, &newStore)
 		if err == nil {
+			defer store.RemoveStore(ctx, result.ID)
 			assert.NotNil(t, result)
 			assert.Equal(t, test.resultURL, result.URLName)
 			assert.Equal(t, test.resultName, result.Name)
@@ -57,3 +91,532 @@ func TestCreate(t *testing.T) {
 	}
 
 }
+
+func TestAddConsumerConcurrent(t *testing.T) {
+
+	ctx := context.Background()
+	cfg, err := config.Load("../config/tests/.env")
+	if err != nil {
+		panic(err)
+	}
+
+	dbClient, dbCollection, err := infra.GetConnection(cfg.Database)
+	if err != nil {
+		panic(err)
+	}
+	defer infra.CloseConnection(dbClient)
+
+	queueCollection := dbCollection.Database().Collection(cfg.Database.QueueCollection)
+	repo := NewStoreRepository(dbCollection, queueCollection, cfg.Database.Timeout)
+	assert.Nil(t, repo.EnsureIndexes(ctx))
+
+	store, err := repo.Create(ctx, &domain.Store{Name: "Concurrent Store", Slug: "concurrent", URLName: "concurrent"})
+	assert.Nil(t, err)
+	assert.NotNil(t, store)
+	defer repo.RemoveStore(ctx, store.ID)
+
+	const total = 50
+
+	var wg sync.WaitGroup
+	errs := make(chan error, total)
+
+	for i := 0; i < total; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			consumer := domain.Consumer{
+				Name:   fmt.Sprintf("Consumer %d", i),
+				Phone:  fmt.Sprintf("0119%08d", i),
+				Status: "Na fila",
+			}
+			errs <- repo.AddConsumer(ctx, store.ID, &consumer, 0)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.Nil(t, err)
+	}
+
+	consumers, err := repo.GetAllConsumers(ctx, store.ID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+	assert.Len(t, consumers, total)
+
+	// The same phone joining concurrently must be accepted only once
+	errs = make(chan error, total)
+	for i := 0; i < total; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			consumer := domain.Consumer{Name: "Duplicado", Phone: "011900000000", Status: "Na fila"}
+			errs <- repo.AddConsumer(ctx, store.ID, &consumer, 0)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	accepted := 0
+	for err := range errs {
+		if err == nil {
+			accepted++
+		} else {
+			assert.Equal(t, ErrConsumerExists, err)
+		}
+	}
+	assert.Equal(t, 1, accepted)
+}
+
+func TestQueues(t *testing.T) {
+
+	ctx := context.Background()
+	cfg, err := config.Load("../config/tests/.env")
+	if err != nil {
+		panic(err)
+	}
+
+	dbClient, dbCollection, err := infra.GetConnection(cfg.Database)
+	if err != nil {
+		panic(err)
+	}
+	defer infra.CloseConnection(dbClient)
+
+	queueCollection := dbCollection.Database().Collection(cfg.Database.QueueCollection)
+	repo := NewStoreRepository(dbCollection, queueCollection, cfg.Database.Timeout)
+	assert.Nil(t, repo.EnsureIndexes(ctx))
+
+	store, err := repo.Create(ctx, &domain.Store{Name: "Queues Store", Slug: "queues", URLName: "queues", Queues: []domain.Queue{
+		{ID: domain.DefaultQueueID, Name: domain.DefaultQueueName},
+		{ID: "caixa", Name: "Caixa"},
+	}})
+	assert.Nil(t, err)
+	defer repo.RemoveStore(ctx, store.ID)
+
+	joinedAt := time.Now().UTC()
+	join := func(name, phone, queueID string) string {
+		joinedAt = joinedAt.Add(time.Second)
+		at := joinedAt
+		consumer := domain.Consumer{Name: name, Phone: phone, QueueID: queueID, Status: domain.StatusWaiting, JoinedAt: &at}
+		assert.Nil(t, repo.AddConsumer(ctx, store.ID, &consumer, 0))
+		return consumer.ID
+	}
+
+	// Joined before the store had several queues
+	legacy := join("Fulano", "+5511999990001", "")
+	cashier := join("Ciclano", "+5511999990002", "caixa")
+	second := join("Beltrano", "+5511999990003", domain.DefaultQueueID)
+
+	consumers, err := repo.GetAllConsumers(ctx, store.ID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+	if assert.Len(t, consumers, 2) {
+		assert.Equal(t, legacy, consumers[0].ID)
+		assert.Equal(t, second, consumers[1].ID)
+	}
+
+	// The queue must still be in the store document
+	at := joinedAt.Add(time.Second)
+	err = repo.AddConsumer(ctx, store.ID, &domain.Consumer{Name: "Sicrano", Phone: "+5511999990004", QueueID: "cozinha", Status: domain.StatusWaiting, JoinedAt: &at}, 0)
+	assert.Equal(t, ErrNotFoundQueue, err)
+	err = repo.AddConsumer(ctx, primitive.NewObjectID().Hex(), &domain.Consumer{Name: "Sicrano", Phone: "+5511999990004", QueueID: "cozinha", Status: domain.StatusWaiting, JoinedAt: &at}, 0)
+	assert.Equal(t, ErrNotFoundStore, err)
+
+	// Only the access key index reports a key in use
+	err = repo.AddConsumer(ctx, store.ID, &domain.Consumer{ID: second, Name: "Repetido", Phone: "+5511999990009", Status: domain.StatusWaiting, JoinedAt: &at}, 0)
+	assert.True(t, isDuplicateKeyError(err))
+	assert.NotEqual(t, ErrAccessKeyExists, err)
+
+	// Every queue of the store is counted
+	waiting, err := repo.CountWaiting(ctx, store.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, waiting)
+
+	position, _, err := repo.GetConsumer(ctx, store.ID, domain.DefaultQueueID, second)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, position)
+
+	position, _, err = repo.GetConsumer(ctx, store.ID, "caixa", cashier)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, position)
+
+	_, _, err = repo.GetConsumer(ctx, store.ID, "caixa", legacy)
+	assert.Equal(t, ErrNotFoundConsumer, err)
+
+	called, err := repo.CallNext(ctx, store.ID, "caixa")
+	assert.Nil(t, err)
+	assert.Equal(t, cashier, called.ID)
+
+	_, err = repo.CallNext(ctx, store.ID, "caixa")
+	assert.Equal(t, ErrEmptyQueue, err)
+
+	called, err = repo.CallNext(ctx, store.ID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+	assert.Equal(t, legacy, called.ID)
+
+	// A waiting consumer cannot be served, and nothing is written
+	err = repo.UpdateConsumerStatus(ctx, store.ID, domain.DefaultQueueID, second, domain.StatusServed)
+	assert.Equal(t, &domain.TransitionError{From: domain.StatusWaiting, To: domain.StatusServed}, err)
+	_, consumer, err := repo.GetConsumer(ctx, store.ID, domain.DefaultQueueID, second)
+	assert.Nil(t, err)
+	assert.Equal(t, domain.StatusWaiting, consumer.Status)
+
+	err = repo.UpdateConsumerStatus(ctx, store.ID, "caixa", second, domain.StatusCancelled)
+	assert.Equal(t, ErrNotFoundConsumer, err)
+}
+
+func TestRejoin(t *testing.T) {
+
+	ctx := context.Background()
+	cfg, err := config.Load("../config/tests/.env")
+	if err != nil {
+		panic(err)
+	}
+
+	dbClient, dbCollection, err := infra.GetConnection(cfg.Database)
+	if err != nil {
+		panic(err)
+	}
+	defer infra.CloseConnection(dbClient)
+
+	queueCollection := dbCollection.Database().Collection(cfg.Database.QueueCollection)
+	repo := NewStoreRepository(dbCollection, queueCollection, cfg.Database.Timeout)
+	assert.Nil(t, repo.EnsureIndexes(ctx))
+
+	store, err := repo.Create(ctx, &domain.Store{Name: "Rejoin Store", Slug: "rejoin", URLName: "rejoin", Queues: []domain.Queue{
+		{ID: domain.DefaultQueueID, Name: domain.DefaultQueueName},
+		{ID: "caixa", Name: "Caixa"},
+	}})
+	assert.Nil(t, err)
+	defer repo.RemoveStore(ctx, store.ID)
+
+	join := func(queueID, accessKey string) (string, error) {
+		consumer := domain.Consumer{Name: "Fulano", Phone: "+5511999990001", QueueID: queueID, Accesskey: accessKey, Status: domain.StatusWaiting}
+		err := repo.AddConsumer(ctx, store.ID, &consumer, 0)
+		return consumer.ID, err
+	}
+
+	first, err := join(domain.DefaultQueueID, "rejoin-key-1")
+	assert.Nil(t, err)
+
+	_, err = join(domain.DefaultQueueID, "rejoin-key-2")
+	assert.Equal(t, ErrConsumerExists, err)
+
+	// The same phone may wait in another queue of the store
+	_, err = join("caixa", "rejoin-key-3")
+	assert.Nil(t, err)
+
+	// And join again once it left
+	assert.Nil(t, repo.RemoveConsumer(ctx, store.ID, domain.DefaultQueueID, first))
+	second, err := join(domain.DefaultQueueID, "rejoin-key-4")
+	assert.Nil(t, err)
+	assert.NotEqual(t, first, second)
+
+	_, err = join(domain.DefaultQueueID, "rejoin-key-1")
+	assert.Equal(t, ErrConsumerExists, err)
+	_, err = join("retirada", "rejoin-key-1")
+	assert.Equal(t, ErrAccessKeyExists, err)
+}
+
+func TestMigrateQueue(t *testing.T) {
+
+	ctx := context.Background()
+	cfg, err := config.Load("../config/tests/.env")
+	if err != nil {
+		panic(err)
+	}
+
+	dbClient, dbCollection, err := infra.GetConnection(cfg.Database)
+	if err != nil {
+		panic(err)
+	}
+	defer infra.CloseConnection(dbClient)
+
+	queueCollection := dbCollection.Database().Collection(cfg.Database.QueueCollection)
+	repo := NewStoreRepository(dbCollection, queueCollection, cfg.Database.Timeout)
+	assert.Nil(t, repo.EnsureIndexes(ctx))
+
+	// A store saved with the embedded queue layout
+	result, err := dbCollection.InsertOne(ctx, bson.M{
+		"name":    "Legacy Store",
+		"urlname": "legacy",
+		"queue": bson.A{
+			bson.M{"name": "Fulano", "phone": "+5511999990001", "status": domain.StatusCalled},
+			bson.M{"id": "legacy-id", "name": "Ciclano", "phone": "+5511999990002", "status": domain.StatusWaiting},
+			bson.M{"name": "Beltrano", "phone": "(11) 99999-0003", "status": domain.StatusWaiting},
+			// The same phone as Ciclano once normalized, it cannot be moved
+			bson.M{"name": "Ciclano de novo", "phone": "011 99999-0002", "status": domain.StatusWaiting},
+		},
+	})
+	assert.Nil(t, err)
+	storeID := result.InsertedID.(primitive.ObjectID).Hex()
+	defer repo.RemoveStore(ctx, storeID)
+
+	migrated, err := repo.MigrateQueue(ctx)
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, migrated, 3)
+
+	consumers, err := repo.GetAllConsumers(ctx, storeID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+	if !assert.Len(t, consumers, 2) {
+		return
+	}
+	assert.Equal(t, "legacy-id", consumers[0].ID)
+	assert.Equal(t, "Beltrano", consumers[1].Name)
+	assert.Equal(t, "+5511999990003", consumers[1].Phone)
+	assert.Equal(t, storeID+"-2", consumers[1].ID)
+
+	position, consumer, err := repo.GetConsumer(ctx, storeID, domain.DefaultQueueID, consumers[1].ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, position)
+	assert.Equal(t, storeID, consumer.StoreID)
+
+	// Running it again finds nothing left to move
+	migrated, err = repo.MigrateQueue(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, migrated)
+
+	count, err := dbCollection.CountDocuments(ctx, bson.M{"queue": bson.M{"$exists": true}})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestListStores(t *testing.T) {
+
+	ctx := context.Background()
+	cfg, err := config.Load("../config/tests/.env")
+	if err != nil {
+		panic(err)
+	}
+
+	dbClient, dbCollection, err := infra.GetConnection(cfg.Database)
+	if err != nil {
+		panic(err)
+	}
+	defer infra.CloseConnection(dbClient)
+
+	queueCollection := dbCollection.Database().Collection(cfg.Database.QueueCollection)
+	repo := NewStoreRepository(dbCollection, queueCollection, cfg.Database.Timeout)
+	assert.Nil(t, repo.EnsureIndexes(ctx))
+
+	store, err := repo.Create(ctx, &domain.Store{Name: "Pão de Açúcar Listagem", Slug: "pao-de-acucar-listagem"})
+	assert.Nil(t, err)
+	defer repo.RemoveStore(ctx, store.ID)
+
+	for i, status := range []domain.ConsumerStatus{domain.StatusWaiting, domain.StatusWaiting, domain.StatusCancelled} {
+		consumer := domain.Consumer{Name: "Fulano", Phone: fmt.Sprintf("+55119000000%02d", i), Status: status}
+		assert.Nil(t, repo.AddConsumer(ctx, store.ID, &consumer, 0))
+	}
+
+	stores, total, err := repo.ListStores(ctx, StoreListOptions{Search: "acucar listagem", Sort: SortByName, Limit: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, total)
+	if assert.Len(t, stores, 1) {
+		assert.Equal(t, store.ID, stores[0].ID)
+		assert.Equal(t, "pao-de-acucar-listagem", stores[0].Slug)
+		assert.Equal(t, 2, stores[0].QueueLength)
+	}
+}
+
+func TestUpdateStore(t *testing.T) {
+
+	ctx := context.Background()
+	cfg, err := config.Load("../config/tests/.env")
+	if err != nil {
+		panic(err)
+	}
+
+	dbClient, dbCollection, err := infra.GetConnection(cfg.Database)
+	if err != nil {
+		panic(err)
+	}
+	defer infra.CloseConnection(dbClient)
+
+	queueCollection := dbCollection.Database().Collection(cfg.Database.QueueCollection)
+	repo := NewStoreRepository(dbCollection, queueCollection, cfg.Database.Timeout)
+	assert.Nil(t, repo.EnsureIndexes(ctx))
+
+	store, err := repo.Create(ctx, &domain.Store{Name: "Update Store", Slug: "update-store"})
+	assert.Nil(t, err)
+	defer repo.RemoveStore(ctx, store.ID)
+
+	other, err := repo.Create(ctx, &domain.Store{Name: "Other Store", Slug: "other-store"})
+	assert.Nil(t, err)
+	defer repo.RemoveStore(ctx, other.ID)
+
+	renamed := *store
+	renamed.Name = "Renamed Store"
+	renamed.Slug = "renamed-store"
+	renamed.PreviousSlugs = []string{"update-store"}
+
+	result, err := repo.UpdateStore(ctx, &renamed)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), result.Version)
+	assert.Equal(t, "renamed-store", result.Slug)
+
+	// The second editor still holds version 0
+	_, err = repo.UpdateStore(ctx, &renamed)
+	assert.Equal(t, ErrStoreVersionConflict, err)
+
+	renamed.Version = 1
+	renamed.Slug = "other-store"
+	_, err = repo.UpdateStore(ctx, &renamed)
+	assert.Equal(t, ErrSlugExists, err)
+
+	result, err = repo.GetStoreBySlug(ctx, "update-store")
+	assert.Nil(t, err)
+	assert.Equal(t, store.ID, result.ID)
+
+	// The slug kept by the renamed store is in use for the others
+	other.Slug = "update-store"
+	_, err = repo.UpdateStore(ctx, other)
+	assert.Equal(t, ErrSlugExists, err)
+	_, err = repo.Create(ctx, &domain.Store{Name: "Another Store", Slug: "update-store"})
+	assert.Equal(t, ErrSlugExists, err)
+
+	// A store that took the slug before it was kept goes on with it, and
+	// once both kept it the oldest store still gets the links
+	legacyID := primitive.NewObjectID()
+	_, err = dbCollection.InsertOne(ctx, bson.D{
+		{Key: "_id", Value: legacyID},
+		{Key: "name", Value: "Legacy Store"},
+		{Key: "slug", Value: "update-store"},
+	})
+	assert.Nil(t, err)
+	legacy := domain.Store{ID: legacyID.Hex(), Name: "Legacy Store", Slug: "update-store"}
+	defer repo.RemoveStore(ctx, legacy.ID)
+
+	legacy.Name = "Legacy Store Renamed"
+	_, err = repo.UpdateStore(ctx, &legacy)
+	assert.Nil(t, err)
+
+	legacy.Version = 1
+	legacy.Slug = "legacy-store"
+	legacy.PreviousSlugs = []string{"update-store"}
+	_, err = repo.UpdateStore(ctx, &legacy)
+	assert.Nil(t, err)
+
+	result, err = repo.GetStoreBySlug(ctx, "update-store")
+	assert.Nil(t, err)
+	assert.Equal(t, store.ID, result.ID)
+
+	_, err = repo.UpdateStore(ctx, &domain.Store{ID: primitive.NewObjectID().Hex()})
+	assert.Equal(t, ErrNotFoundStore, err)
+}
+
+func TestRemoveStore(t *testing.T) {
+
+	ctx := context.Background()
+	cfg, err := config.Load("../config/tests/.env")
+	if err != nil {
+		panic(err)
+	}
+
+	dbClient, dbCollection, err := infra.GetConnection(cfg.Database)
+	if err != nil {
+		panic(err)
+	}
+	defer infra.CloseConnection(dbClient)
+
+	queueCollection := dbCollection.Database().Collection(cfg.Database.QueueCollection)
+	store := NewStoreRepository(dbCollection, queueCollection, cfg.Database.Timeout)
+
+	created, err := store.Create(ctx, &domain.Store{Name: "Removed Store", Slug: "removed-store"})
+	assert.Nil(t, err)
+
+	// Failures reaching the database are not reported as a missing store
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = store.RemoveStore(cancelled, created.ID)
+	assert.NotNil(t, err)
+	assert.NotEqual(t, ErrNotFoundStore, err)
+
+	assert.Nil(t, store.RemoveStore(ctx, created.ID))
+	assert.Equal(t, ErrNotFoundStore, store.RemoveStore(ctx, created.ID))
+}
+
+func TestSetOwner(t *testing.T) {
+
+	ctx := context.Background()
+	cfg, err := config.Load("../config/tests/.env")
+	if err != nil {
+		panic(err)
+	}
+
+	dbClient, dbCollection, err := infra.GetConnection(cfg.Database)
+	if err != nil {
+		panic(err)
+	}
+	defer infra.CloseConnection(dbClient)
+
+	queueCollection := dbCollection.Database().Collection(cfg.Database.QueueCollection)
+	store := NewStoreRepository(dbCollection, queueCollection, cfg.Database.Timeout)
+
+	// Created before stores had an owner
+	legacy, err := store.Create(ctx, &domain.Store{Name: "Ownerless Store", Slug: "ownerless-store"})
+	assert.Nil(t, err)
+	defer store.RemoveStore(ctx, legacy.ID)
+
+	assert.Nil(t, store.SetOwner(ctx, legacy.ID, "owner1"))
+	found, err := store.GetStoreByID(ctx, legacy.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "owner1", found.OwnerID)
+
+	assert.Equal(t, ErrStoreHasOwner, store.SetOwner(ctx, legacy.ID, "owner2"))
+	assert.Equal(t, ErrNotFoundStore, store.SetOwner(ctx, primitive.NewObjectID().Hex(), "owner1"))
+}
+
+func TestAddConsumerLimit(t *testing.T) {
+
+	ctx := context.Background()
+	cfg, err := config.Load("../config/tests/.env")
+	if err != nil {
+		panic(err)
+	}
+
+	dbClient, dbCollection, err := infra.GetConnection(cfg.Database)
+	if err != nil {
+		panic(err)
+	}
+	defer infra.CloseConnection(dbClient)
+
+	queueCollection := dbCollection.Database().Collection(cfg.Database.QueueCollection)
+	repo := NewStoreRepository(dbCollection, queueCollection, cfg.Database.Timeout)
+	assert.Nil(t, repo.EnsureIndexes(ctx))
+	transactor := NewTransactor(dbClient, true)
+
+	store, err := repo.Create(ctx, &domain.Store{Name: "Limited Store", Slug: "limited"})
+	assert.Nil(t, err)
+	defer repo.RemoveStore(ctx, store.ID)
+
+	const total, limit = 20, 5
+
+	var wg sync.WaitGroup
+	errs := make(chan error, total)
+
+	// Joins racing for the last places never go over the limit
+	for i := 0; i < total; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- transactor.WithTransaction(ctx, func(ctx context.Context) error {
+				consumer := domain.Consumer{Name: fmt.Sprintf("Consumer %d", i), Phone: fmt.Sprintf("0119%08d", i), Status: domain.StatusWaiting}
+				return repo.AddConsumer(ctx, store.ID, &consumer, limit)
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	accepted := 0
+	for err := range errs {
+		if err == nil {
+			accepted++
+		} else {
+			assert.Equal(t, ErrQueueFull, err)
+		}
+	}
+	assert.Equal(t, limit, accepted)
+
+	waiting, err := repo.CountWaiting(ctx, store.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, limit, waiting)
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// TransactorImpl implements
+type TransactorImpl struct {
+	client  *mongo.Client
+	enabled bool
+}
+
+// NewTransactor implements
+// Transactions need a replica set or a sharded cluster. When enabled is
+// false the operations run one after the other, so a failure halfway
+// leaves the first ones applied.
+func NewTransactor(client *mongo.Client, enabled bool) Transactor {
+	return &TransactorImpl{
+		client:  client,
+		enabled: enabled,
+	}
+}
+
+// WithTransaction implements
+// Repository calls made with the context given to fn take part in the
+// transaction. fn may run more than once if the transaction is retried.
+func (t *TransactorImpl) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+
+	if !t.enabled {
+		return fn(ctx)
+	}
+
+	session, err := t.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+
+	return err
+}
+
+// TransactorMockImpl implements
+type TransactorMockImpl struct{}
+
+// NewTransactorMock implements
+func NewTransactorMock() Transactor {
+	return TransactorMockImpl{}
+}
+
+// WithTransaction implements
+func (TransactorMockImpl) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/rokoga/filas-backend/domain"
+)
+
+// UserMockRepositoryImpl implements
+type UserMockRepositoryImpl struct {
+	mu     sync.RWMutex
+	users  []*domain.User
+	nextID int
+}
+
+// NewUserMockRepository implements
+func NewUserMockRepository() UserRepository {
+	return &UserMockRepositoryImpl{}
+}
+
+// EnsureIndexes implements
+func (repo *UserMockRepositoryImpl) EnsureIndexes(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CreateUser implements
+func (repo *UserMockRepositoryImpl) CreateUser(ctx context.Context, user *domain.User) (*domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for _, elem := range repo.users {
+		if elem.Email == user.Email {
+			return nil, ErrUserExists
+		}
+	}
+
+	repo.nextID++
+	created := *user
+	created.ID = "user" + strconv.Itoa(repo.nextID)
+	repo.users = append(repo.users, &created)
+
+	return &created, nil
+}
+
+// GetUserByID implements
+func (repo *UserMockRepositoryImpl) GetUserByID(ctx context.Context, id string) (*domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	for _, elem := range repo.users {
+		if elem.ID == id {
+			return elem, nil
+		}
+	}
+
+	return nil, ErrNotFoundUser
+}
+
+// GetUserByEmail implements
+func (repo *UserMockRepositoryImpl) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	for _, elem := range repo.users {
+		if elem.Email == email {
+			return elem, nil
+		}
+	}
+
+	return nil, ErrNotFoundUser
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/rokoga/filas-backend/apperror"
+	"github.com/rokoga/filas-backend/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// ErrorNotFoundUser for user not found
+	ErrorNotFoundUser = "Não foi encontrado o usuário"
+	// ErrorUserExists for email already registered
+	ErrorUserExists = "Usuário com email já cadastrado"
+)
+
+var (
+	// ErrNotFoundUser for user not found
+	ErrNotFoundUser = apperror.New(apperror.NotFound, "user_not_found", ErrorNotFoundUser)
+	// ErrUserExists for email already registered
+	ErrUserExists = apperror.New(apperror.AlreadyExists, "user_exists", ErrorUserExists)
+)
+
+// UserRepositoryImpl implements
+type UserRepositoryImpl struct {
+	collection *mongo.Collection
+	timeout    time.Duration
+}
+
+// NewUserRepository implements
+// timeout bounds every operation, on top of the caller context.
+func NewUserRepository(db *mongo.Collection, timeout time.Duration) UserRepository {
+	return &UserRepositoryImpl{
+		collection: db,
+		timeout:    timeout,
+	}
+}
+
+// EnsureIndexes implements
+func (repo *UserRepositoryImpl) EnsureIndexes(ctx context.Context) error {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetName("email_unique").SetUnique(true),
+	}
+
+	_, err := repo.collection.Indexes().CreateOne(ctx, index)
+	return err
+}
+
+// CreateUser implements
+func (repo *UserRepositoryImpl) CreateUser(ctx context.Context, user *domain.User) (*domain.User, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	result, err := repo.collection.InsertOne(ctx, user)
+	if err != nil {
+		if isDuplicateKeyError(err) {
+			return nil, ErrUserExists
+		}
+		return nil, err
+	}
+
+	created := *user
+	created.ID = result.InsertedID.(primitive.ObjectID).Hex()
+
+	return &created, nil
+}
+
+// GetUserByID implements
+func (repo *UserRepositoryImpl) GetUserByID(ctx context.Context, id string) (*domain.User, error) {
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFoundUser
+	}
+
+	return repo.findOne(ctx, bson.D{{Key: "_id", Value: oid}})
+}
+
+// GetUserByEmail implements
+func (repo *UserRepositoryImpl) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return repo.findOne(ctx, bson.D{{Key: "email", Value: email}})
+}
+
+func (repo *UserRepositoryImpl) findOne(ctx context.Context, filter bson.D) (*domain.User, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	var user domain.User
+
+	err := repo.collection.FindOne(ctx, filter).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFoundUser
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,272 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rokoga/filas-backend/domain"
+)
+
+// WebhookMockRepositoryImpl implements
+type WebhookMockRepositoryImpl struct {
+	mu         sync.Mutex
+	webhooks   []*domain.Webhook
+	deliveries []*domain.WebhookDelivery
+	lastID     int
+}
+
+// NewWebhookMockRepository implements
+func NewWebhookMockRepository() WebhookRepository {
+	return &WebhookMockRepositoryImpl{}
+}
+
+// EnsureIndexes implements
+func (repo *WebhookMockRepositoryImpl) EnsureIndexes(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// CreateWebhook implements
+func (repo *WebhookMockRepositoryImpl) CreateWebhook(ctx context.Context, webhook *domain.Webhook) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if webhook.ID == "" {
+		webhook.ID = repo.newID()
+	}
+	stored := *webhook
+	repo.webhooks = append(repo.webhooks, &stored)
+
+	return nil
+}
+
+// GetWebhook implements
+func (repo *WebhookMockRepositoryImpl) GetWebhook(ctx context.Context, storeID, id string) (*domain.Webhook, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for _, webhook := range repo.webhooks {
+		if webhook.ID == id && webhook.StoreID == storeID {
+			copied := *webhook
+			return &copied, nil
+		}
+	}
+
+	return nil, ErrNotFoundWebhook
+}
+
+// ListWebhooks implements
+func (repo *WebhookMockRepositoryImpl) ListWebhooks(ctx context.Context, storeID string) ([]*domain.Webhook, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	result := []*domain.Webhook{}
+	for _, webhook := range repo.webhooks {
+		if webhook.StoreID == storeID {
+			copied := *webhook
+			result = append(result, &copied)
+		}
+	}
+
+	return result, nil
+}
+
+// RemoveWebhook implements
+func (repo *WebhookMockRepositoryImpl) RemoveWebhook(ctx context.Context, storeID, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for i, webhook := range repo.webhooks {
+		if webhook.ID == id && webhook.StoreID == storeID {
+			repo.webhooks = append(repo.webhooks[:i], repo.webhooks[i+1:]...)
+
+			kept := repo.deliveries[:0]
+			for _, delivery := range repo.deliveries {
+				if delivery.WebhookID != id {
+					kept = append(kept, delivery)
+				}
+			}
+			repo.deliveries = kept
+
+			return nil
+		}
+	}
+
+	return ErrNotFoundWebhook
+}
+
+// RemoveByStore implements
+func (repo *WebhookMockRepositoryImpl) RemoveByStore(ctx context.Context, storeID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	webhooks := repo.webhooks[:0]
+	for _, webhook := range repo.webhooks {
+		if webhook.StoreID != storeID {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	repo.webhooks = webhooks
+
+	deliveries := repo.deliveries[:0]
+	for _, delivery := range repo.deliveries {
+		if delivery.StoreID != storeID {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	repo.deliveries = deliveries
+
+	return nil
+}
+
+// EnqueueDeliveries implements
+func (repo *WebhookMockRepositoryImpl) EnqueueDeliveries(ctx context.Context, deliveries ...*domain.WebhookDelivery) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for _, delivery := range deliveries {
+		if delivery.ID == "" {
+			delivery.ID = repo.newID()
+		}
+		stored := *delivery
+		repo.deliveries = append(repo.deliveries, &stored)
+	}
+
+	return nil
+}
+
+// ClaimDelivery implements
+func (repo *WebhookMockRepositoryImpl) ClaimDelivery(ctx context.Context, now time.Time, lease time.Duration) (*domain.WebhookDelivery, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	var due *domain.WebhookDelivery
+	for _, delivery := range repo.deliveries {
+		if delivery.Status != domain.DeliveryPending || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+		if delivery.LockedUntil != nil && delivery.LockedUntil.After(now) {
+			continue
+		}
+		if due == nil || delivery.NextAttemptAt.Before(due.NextAttemptAt) {
+			due = delivery
+		}
+	}
+
+	if due == nil {
+		return nil, ErrNoDueDeliveries
+	}
+
+	lockedUntil := now.Add(lease)
+	due.LockedUntil = &lockedUntil
+
+	claimed := *due
+	return &claimed, nil
+}
+
+// MarkDelivered implements
+func (repo *WebhookMockRepositoryImpl) MarkDelivered(ctx context.Context, id string, responseStatus int, deliveredAt time.Time) error {
+	return repo.updateDelivery(ctx, id, func(delivery *domain.WebhookDelivery) {
+		delivery.Status = domain.DeliverySent
+		delivery.ResponseStatus = responseStatus
+		delivery.DeliveredAt = &deliveredAt
+		delivery.LastError = ""
+	})
+}
+
+// MarkDeliveryFailed implements
+func (repo *WebhookMockRepositoryImpl) MarkDeliveryFailed(ctx context.Context, id string, responseStatus int, lastError string, nextAttemptAt time.Time, dead bool) error {
+	return repo.updateDelivery(ctx, id, func(delivery *domain.WebhookDelivery) {
+		delivery.Status = domain.DeliveryPending
+		if dead {
+			delivery.Status = domain.DeliveryDead
+		}
+		delivery.ResponseStatus = responseStatus
+		delivery.LastError = lastError
+		delivery.NextAttemptAt = nextAttemptAt
+	})
+}
+
+func (repo *WebhookMockRepositoryImpl) updateDelivery(ctx context.Context, id string, change func(*domain.WebhookDelivery)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for _, delivery := range repo.deliveries {
+		if delivery.ID == id {
+			change(delivery)
+			delivery.Attempts++
+			delivery.LockedUntil = nil
+			return nil
+		}
+	}
+
+	return ErrNotFoundDelivery
+}
+
+// ListDeliveries implements
+func (repo *WebhookMockRepositoryImpl) ListDeliveries(ctx context.Context, storeID, webhookID string, limit int) ([]*domain.WebhookDelivery, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	// Walked backwards so of two deliveries made at the same time the one
+	// added last comes first
+	result := []*domain.WebhookDelivery{}
+	for i := len(repo.deliveries) - 1; i >= 0; i-- {
+		delivery := repo.deliveries[i]
+		if delivery.StoreID == storeID && delivery.WebhookID == webhookID {
+			copied := *delivery
+			result = append(result, &copied)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[j].CreatedAt.Before(result[i].CreatedAt) })
+
+	if len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result, nil
+}
+
+func (repo *WebhookMockRepositoryImpl) newID() string {
+	repo.lastID++
+	return strconv.Itoa(repo.lastID)
+}
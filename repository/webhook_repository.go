@@ -0,0 +1,319 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/rokoga/filas-backend/apperror"
+	"github.com/rokoga/filas-backend/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// ErrorNotFoundWebhook for webhook not found
+	ErrorNotFoundWebhook = "Não foi encontrado o webhook"
+	// ErrorNoDueDeliveries for webhooks without deliveries to send now
+	ErrorNoDueDeliveries = "Não há entregas de webhook para enviar"
+	// ErrorNotFoundDelivery for webhook delivery not found
+	ErrorNotFoundDelivery = "Não foi encontrada a entrega do webhook"
+)
+
+var (
+	// ErrNotFoundWebhook for webhook not found
+	ErrNotFoundWebhook = apperror.New(apperror.NotFound, "webhook_not_found", ErrorNotFoundWebhook)
+	// ErrNoDueDeliveries for webhooks without deliveries to send now
+	ErrNoDueDeliveries = apperror.New(apperror.NotFound, "no_due_deliveries", ErrorNoDueDeliveries)
+	// ErrNotFoundDelivery for webhook delivery not found
+	ErrNotFoundDelivery = apperror.New(apperror.NotFound, "delivery_not_found", ErrorNotFoundDelivery)
+)
+
+// WebhookRepositoryImpl implements
+type WebhookRepositoryImpl struct {
+	webhooks   *mongo.Collection
+	deliveries *mongo.Collection
+	timeout    time.Duration
+}
+
+// NewWebhookRepository implements
+// webhooks holds the endpoints and deliveries the events sent to them. timeout
+// bounds every operation, on top of the caller context.
+func NewWebhookRepository(webhooks *mongo.Collection, deliveries *mongo.Collection, timeout time.Duration) WebhookRepository {
+	return &WebhookRepositoryImpl{
+		webhooks:   webhooks,
+		deliveries: deliveries,
+		timeout:    timeout,
+	}
+}
+
+// EnsureIndexes implements
+// Webhooks are found by store, due deliveries by status and time and the
+// log of a webhook by webhook and time.
+func (repo *WebhookRepositoryImpl) EnsureIndexes(ctx context.Context) error {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	_, err := repo.webhooks.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "storeId", Value: 1}},
+		Options: options.Index().SetName("storeId"),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = repo.deliveries.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}},
+			Options: options.Index().SetName("status_nextAttemptAt"),
+		},
+		{
+			Keys:    bson.D{{Key: "webhookId", Value: 1}, {Key: "createdAt", Value: -1}},
+			Options: options.Index().SetName("webhookId_createdAt"),
+		},
+	})
+	return err
+}
+
+// CreateWebhook implements
+func (repo *WebhookRepositoryImpl) CreateWebhook(ctx context.Context, webhook *domain.Webhook) error {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	if webhook.ID == "" {
+		webhook.ID = primitive.NewObjectID().Hex()
+	}
+
+	_, err := repo.webhooks.InsertOne(ctx, webhook)
+	return err
+}
+
+// GetWebhook implements
+// Webhooks of other stores are not found.
+func (repo *WebhookRepositoryImpl) GetWebhook(ctx context.Context, storeID, id string) (*domain.Webhook, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	var webhook domain.Webhook
+
+	err := repo.webhooks.FindOne(ctx, bson.D{{Key: "_id", Value: id}, {Key: "storeId", Value: storeID}}).Decode(&webhook)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFoundWebhook
+		}
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+// ListWebhooks implements
+// The oldest webhooks come first.
+func (repo *WebhookRepositoryImpl) ListWebhooks(ctx context.Context, storeID string) ([]*domain.Webhook, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}})
+
+	cursor, err := repo.webhooks.Find(ctx, bson.D{{Key: "storeId", Value: storeID}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := []*domain.Webhook{}
+
+	err = cursor.All(ctx, &webhooks)
+	if err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// RemoveWebhook implements
+// Its delivery log goes with it.
+func (repo *WebhookRepositoryImpl) RemoveWebhook(ctx context.Context, storeID, id string) error {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	result, err := repo.webhooks.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}, {Key: "storeId", Value: storeID}})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFoundWebhook
+	}
+
+	_, err = repo.deliveries.DeleteMany(ctx, bson.D{{Key: "webhookId", Value: id}})
+	return err
+}
+
+// RemoveByStore implements
+// The webhooks of the store go with their delivery logs, so nothing is
+// retried for a removed store.
+func (repo *WebhookRepositoryImpl) RemoveByStore(ctx context.Context, storeID string) error {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	filter := bson.D{{Key: "storeId", Value: storeID}}
+
+	if _, err := repo.webhooks.DeleteMany(ctx, filter); err != nil {
+		return err
+	}
+
+	_, err := repo.deliveries.DeleteMany(ctx, filter)
+	return err
+}
+
+// EnqueueDeliveries implements
+func (repo *WebhookRepositoryImpl) EnqueueDeliveries(ctx context.Context, deliveries ...*domain.WebhookDelivery) error {
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	docs := make([]interface{}, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		if delivery.ID == "" {
+			delivery.ID = primitive.NewObjectID().Hex()
+		}
+		docs = append(docs, delivery)
+	}
+
+	_, err := repo.deliveries.InsertMany(ctx, docs)
+	return err
+}
+
+// ClaimDelivery implements
+// Locks the pending delivery due the longest the same way Claim does for
+// the outbox.
+func (repo *WebhookRepositoryImpl) ClaimDelivery(ctx context.Context, now time.Time, lease time.Duration) (*domain.WebhookDelivery, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "status", Value: domain.DeliveryPending},
+		{Key: "nextAttemptAt", Value: bson.D{{Key: "$lte", Value: now}}},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "lockedUntil", Value: bson.D{{Key: "$exists", Value: false}}}},
+			bson.D{{Key: "lockedUntil", Value: bson.D{{Key: "$lte", Value: now}}}},
+		}},
+	}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "lockedUntil", Value: now.Add(lease)}}},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var delivery domain.WebhookDelivery
+
+	err := repo.deliveries.FindOneAndUpdate(ctx, filter, update, opts).Decode(&delivery)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNoDueDeliveries
+		}
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+// MarkDelivered implements
+func (repo *WebhookRepositoryImpl) MarkDelivered(ctx context.Context, id string, responseStatus int, deliveredAt time.Time) error {
+
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "status", Value: domain.DeliverySent},
+			{Key: "responseStatus", Value: responseStatus},
+			{Key: "deliveredAt", Value: deliveredAt},
+		}},
+		{Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}},
+		{Key: "$unset", Value: bson.D{{Key: "lockedUntil", Value: ""}, {Key: "lastError", Value: ""}}},
+	}
+
+	return repo.updateDelivery(ctx, id, update)
+}
+
+// MarkDeliveryFailed implements
+// A dead delivery is never claimed again, any other is retried at
+// nextAttemptAt.
+func (repo *WebhookRepositoryImpl) MarkDeliveryFailed(ctx context.Context, id string, responseStatus int, lastError string, nextAttemptAt time.Time, dead bool) error {
+
+	status := domain.DeliveryPending
+	if dead {
+		status = domain.DeliveryDead
+	}
+
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "status", Value: status},
+			{Key: "responseStatus", Value: responseStatus},
+			{Key: "lastError", Value: lastError},
+			{Key: "nextAttemptAt", Value: nextAttemptAt},
+		}},
+		{Key: "$inc", Value: bson.D{{Key: "attempts", Value: 1}}},
+		{Key: "$unset", Value: bson.D{{Key: "lockedUntil", Value: ""}}},
+	}
+
+	return repo.updateDelivery(ctx, id, update)
+}
+
+func (repo *WebhookRepositoryImpl) updateDelivery(ctx context.Context, id string, update bson.D) error {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	result, err := repo.deliveries.UpdateOne(ctx, bson.D{{Key: "_id", Value: id}}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrNotFoundDelivery
+	}
+
+	return nil
+}
+
+// ListDeliveries implements
+// The newest deliveries come first, at most limit of them.
+func (repo *WebhookRepositoryImpl) ListDeliveries(ctx context.Context, storeID, webhookID string, limit int) ([]*domain.WebhookDelivery, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, repo.timeout)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "webhookId", Value: webhookID},
+		{Key: "storeId", Value: storeID},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := repo.deliveries.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := []*domain.WebhookDelivery{}
+
+	err = cursor.All(ctx, &deliveries)
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rokoga/filas-backend/config"
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/infra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhook(t *testing.T) {
+
+	ctx := context.Background()
+	cfg, err := config.Load("../config/tests/.env")
+	if err != nil {
+		panic(err)
+	}
+
+	dbClient, dbCollection, err := infra.GetConnection(cfg.Database)
+	if err != nil {
+		panic(err)
+	}
+	defer infra.CloseConnection(dbClient)
+
+	webhooksCollection := dbCollection.Database().Collection(cfg.Database.WebhooksCollection)
+	deliveriesCollection := dbCollection.Database().Collection(cfg.Database.WebhookDeliveriesCollection)
+	repo := NewWebhookRepository(webhooksCollection, deliveriesCollection, cfg.Database.Timeout)
+	assert.Nil(t, repo.EnsureIndexes(ctx))
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	hook := &domain.Webhook{StoreID: "webhook-test", URL: "http://pos.local/hooks", Events: []string{"consumer.joined"}, Secret: "segredo", CreatedAt: now}
+	assert.Nil(t, repo.CreateWebhook(ctx, hook))
+	defer repo.RemoveWebhook(ctx, "webhook-test", hook.ID)
+
+	found, err := repo.GetWebhook(ctx, "webhook-test", hook.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "segredo", found.Secret)
+
+	_, err = repo.GetWebhook(ctx, "other-store", hook.ID)
+	assert.Equal(t, ErrNotFoundWebhook, err)
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, repo.EnqueueDeliveries(ctx, &domain.WebhookDelivery{
+			WebhookID:     hook.ID,
+			StoreID:       "webhook-test",
+			Event:         "consumer.joined",
+			Payload:       "{}",
+			Status:        domain.DeliveryPending,
+			CreatedAt:     now.Add(time.Duration(i) * time.Second),
+			NextAttemptAt: now,
+		}))
+	}
+
+	claimed, err := repo.ClaimDelivery(ctx, now, time.Minute)
+	assert.Nil(t, err)
+	assert.Nil(t, repo.MarkDeliveryFailed(ctx, claimed.ID, 503, "webhook respondeu 503", now.Add(time.Hour), true))
+
+	deliveries, err := repo.ListDeliveries(ctx, "webhook-test", hook.ID, 2)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 2)
+	assert.True(t, deliveries[0].CreatedAt.After(deliveries[1].CreatedAt))
+
+	assert.Nil(t, repo.RemoveWebhook(ctx, "webhook-test", hook.ID))
+	assert.Equal(t, ErrNotFoundWebhook, repo.RemoveWebhook(ctx, "webhook-test", hook.ID))
+
+	deliveries, err = repo.ListDeliveries(ctx, "webhook-test", hook.ID, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, deliveries)
+
+	// Removing the store takes every webhook and delivery of it
+	other := &domain.Webhook{StoreID: "webhook-test", URL: "http://pos.local/hooks", Events: []string{"consumer.joined"}, Secret: "segredo", CreatedAt: now}
+	assert.Nil(t, repo.CreateWebhook(ctx, other))
+	assert.Nil(t, repo.EnqueueDeliveries(ctx, &domain.WebhookDelivery{WebhookID: other.ID, StoreID: "webhook-test", Event: "consumer.joined", Payload: "{}", Status: domain.DeliveryPending, CreatedAt: now, NextAttemptAt: now}))
+
+	assert.Nil(t, repo.RemoveByStore(ctx, "webhook-test"))
+	hooks, err := repo.ListWebhooks(ctx, "webhook-test")
+	assert.Nil(t, err)
+	assert.Empty(t, hooks)
+	deliveries, err = repo.ListDeliveries(ctx, "webhook-test", other.ID, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, deliveries)
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// accessKeyBytes gives 192 bits of entropy, 32 URL-safe characters
+	accessKeyBytes = 24
+	// maxAccessKeyAttempts bounds the retries after an access key collision
+	maxAccessKeyAttempts = 3
+)
+
+// newAccessKey returns a random URL-safe token
+func newAccessKey() (string, error) {
+	b := make([]byte, accessKeyBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// newConsumerID returns a unique, time ordered consumer ID
+func newConsumerID() string {
+	return primitive.NewObjectID().Hex()
+}
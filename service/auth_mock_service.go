@@ -0,0 +1,14 @@
+package service
+
+import (
+	"github.com/rokoga/filas-backend/auth"
+	"github.com/rokoga/filas-backend/repository"
+)
+
+// NewAuthMockServiceImpl implements
+func NewAuthMockServiceImpl(tokens *auth.TokenManager) AuthService {
+	return &AuthServiceImpl{
+		userRepository: repository.NewUserMockRepository(),
+		tokens:         tokens,
+	}
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/rokoga/filas-backend/apperror"
+	"github.com/rokoga/filas-backend/auth"
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/repository"
+)
+
+const (
+	// ErrorArgumentNotValidRegister for invalid argument
+	ErrorArgumentNotValidRegister = "Nome, email e senha com ao menos 8 caracteres devem ser preenchidos"
+	// ErrorInvalidCredentials for wrong email or password
+	ErrorInvalidCredentials = "Email ou senha inválidos"
+	// ErrorUnauthenticated for requests without a valid token
+	ErrorUnauthenticated = "É necessário autenticar para acessar este recurso"
+	// ErrorForbidden for users not allowed to manage the store
+	ErrorForbidden = "Usuário sem permissão para gerenciar o estabelecimento"
+	// ErrorStoreWithoutOwner for stores nobody manages until an admin assigns an owner
+	ErrorStoreWithoutOwner = "O estabelecimento não tem dono, peça a um administrador para definir um"
+)
+
+var (
+	// ErrArgumentNotValidRegister for invalid argument
+	ErrArgumentNotValidRegister = apperror.New(apperror.InvalidArgument, "invalid_register_arguments", ErrorArgumentNotValidRegister)
+	// ErrInvalidCredentials for wrong email or password
+	ErrInvalidCredentials = apperror.New(apperror.Unauthenticated, "invalid_credentials", ErrorInvalidCredentials)
+	// ErrUnauthenticated for requests without a valid token
+	ErrUnauthenticated = apperror.New(apperror.Unauthenticated, "unauthenticated", ErrorUnauthenticated)
+	// ErrForbidden for users not allowed to manage the store
+	ErrForbidden = apperror.New(apperror.Forbidden, "forbidden", ErrorForbidden)
+	// ErrStoreWithoutOwner for stores nobody manages until an admin assigns an owner
+	ErrStoreWithoutOwner = apperror.New(apperror.Forbidden, "store_without_owner", ErrorStoreWithoutOwner)
+)
+
+// minPasswordLength for new accounts
+const minPasswordLength = 8
+
+// unknownUserHash is checked when the email is not registered, so a login
+// takes as long whether or not the account exists
+const unknownUserHash = "$2a$10$ew/Mu/4w22CMe9EGKNqXqeDH6b6wx8o4iCfB/dWz32J1owDDd3lB2"
+
+// AuthServiceImpl implements
+type AuthServiceImpl struct {
+	userRepository repository.UserRepository
+	tokens         *auth.TokenManager
+}
+
+// NewAuthServiceImpl implements
+// dbTimeout bounds every database operation.
+func NewAuthServiceImpl(db *mongo.Collection, dbTimeout time.Duration, tokens *auth.TokenManager) AuthService {
+	return &AuthServiceImpl{
+		userRepository: repository.NewUserRepository(db, dbTimeout),
+		tokens:         tokens,
+	}
+}
+
+// Register implements
+func (svc *AuthServiceImpl) Register(ctx context.Context, name, email, password string) (*domain.User, error) {
+
+	email = normalizeEmail(email)
+	if name == "" || !strings.Contains(email, "@") || len(password) < minPasswordLength {
+		return nil, ErrArgumentNotValidRegister
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := svc.userRepository.CreateUser(ctx, &domain.User{
+		Name:         name,
+		Email:        email,
+		PasswordHash: hash,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Login implements
+func (svc *AuthServiceImpl) Login(ctx context.Context, email, password string) (string, error) {
+
+	user, err := svc.userRepository.GetUserByEmail(ctx, normalizeEmail(email))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFoundUser) {
+			auth.CheckPassword(unknownUserHash, password)
+			return "", ErrInvalidCredentials
+		}
+		return "", err
+	}
+
+	if !auth.CheckPassword(user.PasswordHash, password) {
+		return "", ErrInvalidCredentials
+	}
+
+	return svc.tokens.Issue(user.ID)
+}
+
+// Authenticate implements
+func (svc *AuthServiceImpl) Authenticate(ctx context.Context, token string) (*domain.User, error) {
+
+	claims, err := svc.tokens.Verify(token)
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+
+	user, err := svc.userRepository.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFoundUser) {
+			return nil, ErrUnauthenticated
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// GetUserByEmail implements
+func (svc *AuthServiceImpl) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return svc.userRepository.GetUserByEmail(ctx, normalizeEmail(email))
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rokoga/filas-backend/auth"
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/repository"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+
+	svc := NewAuthMockServiceImpl(auth.NewTokenManager([]byte("secret"), time.Hour))
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		err      error
+	}{
+		{name: "Dono", email: " Dono@Outback.com ", password: "senha-segura", err: nil},
+		{name: "Outro", email: "dono@outback.com", password: "senha-segura", err: repository.ErrUserExists},
+		{name: "Curta", email: "curta@outback.com", password: "1234567", err: ErrArgumentNotValidRegister},
+		{name: "Sem Email", email: "outback.com", password: "senha-segura", err: ErrArgumentNotValidRegister},
+		{name: "", email: "vazio@outback.com", password: "senha-segura", err: ErrArgumentNotValidRegister},
+	}
+
+	for _, test := range tests {
+		user, err := svc.Register(context.Background(), test.name, test.email, test.password)
+		if test.err == nil {
+			assert.Nil(t, err)
+			assert.NotEmpty(t, user.ID)
+			assert.Equal(t, "dono@outback.com", user.Email)
+			assert.NotEqual(t, test.password, user.PasswordHash)
+		} else {
+			assert.Equal(t, test.err, err)
+			assert.Nil(t, user)
+		}
+	}
+
+}
+
+func TestLoginAndAuthenticate(t *testing.T) {
+
+	ctx := context.Background()
+	svc := NewAuthMockServiceImpl(auth.NewTokenManager([]byte("secret"), time.Hour))
+
+	registered, err := svc.Register(ctx, "Dono", "dono@outback.com", "senha-segura")
+	assert.Nil(t, err)
+
+	token, err := svc.Login(ctx, "DONO@outback.com", "senha-segura")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, token)
+
+	user, err := svc.Authenticate(ctx, token)
+	assert.Nil(t, err)
+	assert.Equal(t, registered.ID, user.ID)
+
+	_, err = svc.Login(ctx, "dono@outback.com", "senha-errada")
+	assert.Equal(t, ErrInvalidCredentials, err)
+
+	_, err = svc.Login(ctx, "ninguem@outback.com", "senha-segura")
+	assert.Equal(t, ErrInvalidCredentials, err)
+
+	user, err = svc.Authenticate(ctx, "token-invalido")
+	assert.Equal(t, ErrUnauthenticated, err)
+	assert.Nil(t, user)
+
+	// A token signed with another secret is rejected
+	other := NewAuthMockServiceImpl(auth.NewTokenManager([]byte("other"), time.Hour))
+	_, err = other.Authenticate(ctx, token)
+	assert.Equal(t, ErrUnauthenticated, err)
+
+}
+
+// unreachableUsers fails every lookup as a database that is down
+type unreachableUsers struct {
+	repository.UserRepository
+}
+
+func (unreachableUsers) GetUserByID(ctx context.Context, id string) (*domain.User, error) {
+	return nil, errors.New("server selection timeout")
+}
+
+func (unreachableUsers) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return nil, errors.New("server selection timeout")
+}
+
+func TestAuthenticateDatabaseDown(t *testing.T) {
+
+	ctx := context.Background()
+	tokens := auth.NewTokenManager([]byte("secret"), time.Hour)
+	svc := &AuthServiceImpl{userRepository: unreachableUsers{repository.NewUserMockRepository()}, tokens: tokens}
+
+	token, err := tokens.Issue("user1")
+	assert.Nil(t, err)
+
+	// A database failure is not a wrong token or wrong credentials
+	_, err = svc.Authenticate(ctx, token)
+	assert.NotNil(t, err)
+	assert.NotEqual(t, ErrUnauthenticated, err)
+
+	_, err = svc.Login(ctx, "dono@outback.com", "senha-segura")
+	assert.NotNil(t, err)
+	assert.NotEqual(t, ErrInvalidCredentials, err)
+}
+
+func TestUnknownUserHash(t *testing.T) {
+	// An invalid hash or a cheaper cost would make unknown emails answer faster
+	cost, err := bcrypt.Cost([]byte(unknownUserHash))
+	assert.Nil(t, err)
+	assert.Equal(t, bcrypt.DefaultCost, cost)
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"sort"
+	"time"
+
+	"github.com/rokoga/filas-backend/domain"
+)
+
+const (
+	// intervalWindow is the number of most recent service intervals averaged
+	intervalWindow = 10
+	// minBucketSamples is the number of intervals in the current hour of the
+	// day needed to prefer them over the whole history
+	minBucketSamples = 3
+	// maxInterval discards gaps between calls such as the store being closed
+	maxInterval = 2 * time.Hour
+	// callHistoryLimit is the number of most recent calls loaded to estimate
+	// the service interval
+	callHistoryLimit = 200
+)
+
+// serviceInterval returns the rolling average time between consecutive calls
+// of a store queue, preferring calls made around the same hour of the day as
+// now. It returns zero when there is no history.
+func serviceInterval(queue []*domain.Consumer, now time.Time) time.Duration {
+	var calls []time.Time
+	for _, consumer := range queue {
+		if consumer.CalledAt != nil {
+			calls = append(calls, *consumer.CalledAt)
+		}
+	}
+
+	sort.Slice(calls, func(i, j int) bool { return calls[i].Before(calls[j]) })
+
+	var all, bucket []time.Duration
+	for i := 1; i < len(calls); i++ {
+		d := calls[i].Sub(calls[i-1])
+		if d <= 0 || d > maxInterval {
+			continue
+		}
+
+		all = append(all, d)
+		if calls[i].In(now.Location()).Hour() == now.Hour() {
+			bucket = append(bucket, d)
+		}
+	}
+
+	samples := all
+	if len(bucket) >= minBucketSamples {
+		samples = bucket
+	}
+	if len(samples) == 0 {
+		return 0
+	}
+	if len(samples) > intervalWindow {
+		samples = samples[len(samples)-intervalWindow:]
+	}
+
+	var total time.Duration
+	for _, d := range samples {
+		total += d
+	}
+
+	return total / time.Duration(len(samples))
+}
+
+// setEstimatedWait fills the estimated wait of a consumer at the given
+// position, counting the consumer's own turn
+func setEstimatedWait(consumer *domain.Consumer, position int, avg time.Duration) {
+	if consumer.Status != domain.StatusWaiting {
+		consumer.EstimatedWaitSeconds = 0
+		return
+	}
+
+	consumer.EstimatedWaitSeconds = int64((time.Duration(position+1) * avg).Seconds())
+}
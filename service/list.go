@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/repository"
+)
+
+const (
+	// defaultPageSize is used when the listing does not ask for a limit
+	defaultPageSize = 20
+	// maxPageSize bounds how many stores a single page returns
+	maxPageSize = 100
+)
+
+// listStores checks the listing options, fills in the defaults and reads
+// the page
+func listStores(ctx context.Context, repo repository.StoreRepository, opts repository.StoreListOptions) (*domain.StorePage, error) {
+
+	opts.Search = strings.TrimSpace(opts.Search)
+	if opts.Limit == 0 {
+		opts.Limit = defaultPageSize
+	}
+	if opts.Sort == "" {
+		opts.Sort = repository.SortByName
+	}
+
+	if opts.Limit < 0 || opts.Limit > maxPageSize || opts.Offset < 0 {
+		return nil, ErrArgumentNotValidListStores
+	}
+
+	switch opts.Sort {
+	case repository.SortByName, repository.SortByNameDesc, repository.SortByCreated, repository.SortByCreatedDesc:
+	default:
+		return nil, ErrArgumentNotValidListStores
+	}
+
+	stores, total, err := repo.ListStores(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.StorePage{
+		Stores: stores,
+		Total:  total,
+		Limit:  opts.Limit,
+		Offset: opts.Offset,
+	}, nil
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/logging"
+	"github.com/rokoga/filas-backend/repository"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultNearFront is how many consumers are left ahead when the mock
+// service sends the near front message
+const defaultNearFront = 2
+
+// notifications writes the messages of the store to its consumers in the
+// outbox, where the outbox worker sends them from. Called within the
+// transaction of the queue change, the messages are stored with it.
+type notifications struct {
+	outbox repository.OutboxRepository
+	// nearFront is how many consumers are left ahead when the near front
+	// message is sent
+	nearFront int
+}
+
+// send renders the message of the given kind with the store templates and
+// writes it to the outbox. ahead is how many consumers wait before them. A
+// template that fails to render is logged and skipped.
+func (n *notifications) send(ctx context.Context, store *domain.Store, consumer *domain.Consumer, kind domain.NotificationKind, ahead int) error {
+	if consumer.Phone == "" {
+		return nil
+	}
+
+	log := logging.FromContext(ctx).WithFields(logrus.Fields{
+		"store_id":     store.ID,
+		"consumer_id":  consumer.ID,
+		"notification": kind,
+	})
+
+	queueName := ""
+	if queue := store.FindQueue(consumer.JoinedQueue()); queue != nil {
+		queueName = queue.Name
+	}
+
+	body, err := store.Message(kind, domain.NotificationData{
+		Store:    store.Name,
+		Queue:    queueName,
+		Name:     consumer.Name,
+		Position: ahead + 1,
+		Ahead:    ahead,
+		URL:      fmt.Sprintf("%s/%s", store.URLName, consumer.Accesskey),
+	})
+	if err != nil {
+		log.WithError(err).Warn("notification template failed")
+		return nil
+	}
+
+	now := time.Now().UTC()
+
+	return n.outbox.Enqueue(ctx, &domain.OutboxMessage{
+		StoreID:       store.ID,
+		ConsumerID:    consumer.ID,
+		Kind:          kind,
+		To:            consumer.Phone,
+		Body:          body,
+		Status:        domain.DeliveryPending,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	})
+}
+
+// sendTo loads the store and writes the message to the consumer
+func (n *notifications) sendTo(ctx context.Context, repo repository.StoreRepository, id string, consumer *domain.Consumer, kind domain.NotificationKind, ahead int) error {
+	store, err := repo.GetStoreByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return n.send(ctx, store, consumer, kind, ahead)
+}
+
+// queueMoved warns the consumer who got nearFront consumers ahead after a
+// waiting consumer at position left the queue. Consumers behind nearFront
+// leaving move nobody closer, so nobody is warned twice.
+func (n *notifications) queueMoved(ctx context.Context, repo repository.StoreRepository, id, queueID string, position int) error {
+	if position > n.nearFront {
+		return nil
+	}
+
+	waiting, err := repo.GetAllConsumers(ctx, id, queueID)
+	if err != nil {
+		return err
+	}
+	if len(waiting) <= n.nearFront {
+		return nil
+	}
+
+	return n.sendTo(ctx, repo, id, waiting[n.nearFront], domain.NotifyNearFront, n.nearFront)
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/event"
+	"github.com/rokoga/filas-backend/logging"
+	"github.com/rokoga/filas-backend/metrics"
+	"github.com/rokoga/filas-backend/repository"
+	"github.com/sirupsen/logrus"
+)
+
+// publish notifies the subscribers of the store and updates its queue
+// metrics. The change and its webhook deliveries are already stored, the
+// subscribers only get what was committed.
+func publish(ctx context.Context, hub *event.Hub, m *metrics.Metrics, repo repository.StoreRepository, e event.Event) {
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now().UTC()
+	}
+
+	log := logging.FromContext(ctx).WithFields(logrus.Fields{
+		"event":       e.Type,
+		"store_id":    e.StoreID,
+		"queue_id":    e.QueueID,
+		"consumer_id": e.ConsumerID,
+	})
+	log.Info("queue changed")
+
+	hub.Publish(e)
+	m.CountQueueEvent(e.StoreID, e.Type)
+
+	// The waiting consumers of every queue of the store are counted in the
+	// database instead of tracked so the gauge is right after a restart
+	waiting, err := repo.CountWaiting(ctx, e.StoreID)
+	if err != nil {
+		log.WithError(err).Warn("queue length not updated")
+		return
+	}
+	m.SetQueueLength(e.StoreID, waiting)
+}
+
+// observeWait records how long a called consumer waited in the queue
+func observeWait(m *metrics.Metrics, storeID string, consumer *domain.Consumer) {
+	if consumer.JoinedAt == nil || consumer.CalledAt == nil {
+		return
+	}
+
+	m.ObserveWait(storeID, consumer.CalledAt.Sub(*consumer.JoinedAt))
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/event"
+	"github.com/rokoga/filas-backend/repository"
+)
+
+// withQueueState fills in the state of the store at the given time and how
+// many consumers wait in each of its queues
+func withQueueState(store *domain.Store, now time.Time) *domain.Store {
+	state := store.QueueState(now)
+	store.State = &state
+
+	queues := []domain.Queue{}
+	for _, queue := range store.QueueList() {
+		queue.Length = len(store.Waiting(queue.ID))
+		queues = append(queues, queue)
+	}
+	store.Queues = queues
+
+	return store
+}
+
+// findQueue loads the store and checks it has the queue
+func findQueue(ctx context.Context, repo repository.StoreRepository, id, queueID string) (*domain.Store, error) {
+	store, err := repo.GetStoreByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if store.FindQueue(queueID) == nil {
+		return nil, ErrNotFoundQueue
+	}
+
+	return store, nil
+}
+
+// checkQueueOpen rejects joins while the queue is closed or paused, telling
+// when it opens again
+func checkQueueOpen(store *domain.Store, now time.Time) error {
+	state := store.QueueState(now)
+	if state.Status != domain.QueueOpen {
+		return &domain.QueueClosedError{State: state}
+	}
+	return nil
+}
+
+// stateEvent is the event published when the queue switches to status
+func stateEvent(status domain.QueueStatus) string {
+	switch status {
+	case domain.QueueOpen:
+		return event.StoreOpened
+	case domain.QueuePaused:
+		return event.StorePaused
+	}
+	return event.StoreClosed
+}
+
+// setQueueMode switches the queue by hand. Only a pause may have an end,
+// which must be in the future.
+func setQueueMode(ctx context.Context, repo repository.StoreRepository, id string, mode domain.QueueMode, until *time.Time) (*domain.Store, error) {
+
+	now := time.Now()
+
+	if id == "" || !mode.Valid() {
+		return nil, ErrArgumentNotValidQueueMode
+	}
+	if until != nil && (mode != domain.ModePaused || !until.After(now)) {
+		return nil, ErrArgumentNotValidQueueMode
+	}
+
+	if err := repo.SetQueueMode(ctx, id, mode, until); err != nil {
+		return nil, err
+	}
+
+	store, err := repo.GetStoreByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return withQueueState(store, now), nil
+}
@@ -1,17 +1,51 @@
 package service
 
-import "github.com/rokoga/filas-backend/domain"
+import (
+	"context"
+	"time"
+
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/event"
+	"github.com/rokoga/filas-backend/repository"
+)
 
 // StoreService - Provides a Store services layer
 type StoreService interface {
-	Create(name string) (*domain.Store, error)
-	RemoveStore(id string) error
-	GetAllStores() ([]string, error)
-	GetStore(name string) (*domain.Store, error)
-	GetStoreByID(id string) (*domain.Store, error)
-	AddConsumer(id, name, phone, status string) (string, error)
-	RemoveConsumer(id string, phone string) error
-	GetConsumer(id string, phone string) (int, *domain.Consumer, error)
-	GetAllConsumers(id string) ([]*domain.Consumer, error)
-	ValidateConsumer(storeName, accessKey string) (int, *domain.Consumer, error)
+	Create(ctx context.Context, name, ownerID string) (*domain.Store, error)
+	UpdateStore(ctx context.Context, id string, update domain.StoreUpdate) (*domain.Store, error)
+	RemoveStore(ctx context.Context, id string) error
+	ListStores(ctx context.Context, opts repository.StoreListOptions) (*domain.StorePage, error)
+	GetStore(ctx context.Context, name string) (*domain.Store, error)
+	GetStoreBySlug(ctx context.Context, slug string) (*domain.Store, error)
+	GetStoreByID(ctx context.Context, id string) (*domain.Store, error)
+	AddConsumer(ctx context.Context, id, queueID, name, phone string, partySize int, status domain.ConsumerStatus) (string, error)
+	RemoveConsumer(ctx context.Context, id, queueID, consumerID string) error
+	GetConsumer(ctx context.Context, id, queueID, consumerID string) (int, *domain.Consumer, error)
+	GetAllConsumers(ctx context.Context, id, queueID string) ([]*domain.Consumer, error)
+	ValidateConsumer(ctx context.Context, storeSlug, accessKey string) (int, *domain.Consumer, error)
+	CallNext(ctx context.Context, id, queueID string) (*domain.Consumer, error)
+	CallNextForTable(ctx context.Context, id, queueID string, capacity int) (*domain.Consumer, error)
+	Serve(ctx context.Context, id, queueID, consumerID string) error
+	NoShow(ctx context.Context, id, queueID, consumerID string) error
+	RotateAccessKey(ctx context.Context, id, queueID, consumerID string) (string, error)
+	RevokeAccessKey(ctx context.Context, id, queueID, consumerID string) error
+	CancelByAccessKey(ctx context.Context, storeSlug, accessKey string) error
+	SetQueueMode(ctx context.Context, id string, mode domain.QueueMode, until *time.Time) (*domain.Store, error)
+	GetNotifications(ctx context.Context, id, queueID, consumerID string) ([]*domain.OutboxMessage, error)
+	CreateWebhook(ctx context.Context, id, url string, events []string) (*domain.Webhook, error)
+	ListWebhooks(ctx context.Context, id string) ([]*domain.Webhook, error)
+	RemoveWebhook(ctx context.Context, id, webhookID string) error
+	GetWebhookDeliveries(ctx context.Context, id, webhookID string) ([]*domain.WebhookDelivery, error)
+	PingWebhook(ctx context.Context, id, webhookID string) (*domain.WebhookDelivery, error)
+	AddStaff(ctx context.Context, id, userID string) error
+	AssignOwner(ctx context.Context, id, userID string) error
+	Subscribe(id string) (<-chan event.Event, func())
+}
+
+// AuthService - Provides store owner and staff authentication
+type AuthService interface {
+	Register(ctx context.Context, name, email, password string) (*domain.User, error)
+	Login(ctx context.Context, email, password string) (string, error)
+	Authenticate(ctx context.Context, token string) (*domain.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*domain.User, error)
 }
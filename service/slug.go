@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/repository"
+	"github.com/rokoga/filas-backend/slug"
+)
+
+// createWithSlug inserts the store under the first slug of its name not yet
+// in use. The unique indexes decide, so two stores created at the same time
+// never share a name or a slug. url builds the public URL from the slug.
+func createWithSlug(ctx context.Context, repo repository.StoreRepository, name, ownerID string, url func(string) string) (*domain.Store, error) {
+
+	base := slug.Make(name)
+	if base == "" {
+		return nil, ErrArgumentNotValidAddStore
+	}
+
+	for attempt := 1; attempt <= slug.MaxAttempts; attempt++ {
+		storeSlug := slug.WithSuffix(base, attempt)
+
+		store := domain.Store{
+			Name:    name,
+			Slug:    storeSlug,
+			URLName: url(storeSlug),
+			OwnerID: ownerID,
+		}
+
+		newStore, err := repo.Create(ctx, &store)
+		if errors.Is(err, repository.ErrSlugExists) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return newStore, nil
+	}
+
+	return nil, repository.ErrSlugExists
+}
@@ -1,17 +1,20 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"math/rand"
-	"strconv"
-	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 
+	"github.com/rokoga/filas-backend/apperror"
 	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/event"
+	"github.com/rokoga/filas-backend/metrics"
+	"github.com/rokoga/filas-backend/phone"
 	"github.com/rokoga/filas-backend/repository"
+	"github.com/rokoga/filas-backend/webhook"
 )
 
 const (
@@ -29,197 +32,701 @@ const (
 	ErrorArgumentNotValidGetConsumer = "Os parametros para pesquisa de consumidor devem ser preenchidos"
 	// ErrorArgumentNotValidValidateConsumer for invalid argument
 	ErrorArgumentNotValidValidateConsumer = "Os parametros para validação de consumidor devem ser preenchidos"
+	// ErrorArgumentNotValidCallNext for invalid argument
+	ErrorArgumentNotValidCallNext = "Os parametros para chamada do próximo consumidor devem ser preenchidos"
+	// ErrorArgumentNotValidFinishCall for invalid argument
+	ErrorArgumentNotValidFinishCall = "Os parametros para finalização do atendimento devem ser preenchidos"
+	// ErrorArgumentNotValidAccessKey for invalid argument
+	ErrorArgumentNotValidAccessKey = "Os parametros para alteração da chave de acesso devem ser preenchidos"
+	// ErrorArgumentNotValidAddStaff for invalid argument
+	ErrorArgumentNotValidAddStaff = "Os parametros para inclusão de funcionário devem ser preenchidos"
+	// ErrorArgumentNotValidAssignOwner for invalid argument
+	ErrorArgumentNotValidAssignOwner = "Os parametros para definição do dono devem ser preenchidos"
+	// ErrorArgumentNotValidListStores for invalid argument
+	ErrorArgumentNotValidListStores = "Os parametros para listagem dos estabelecimentos são inválidos"
+	// ErrorArgumentNotValidUpdateStore for invalid argument
+	ErrorArgumentNotValidUpdateStore = "Os parametros para alteração do estabelecimento devem ser preenchidos"
+	// ErrorArgumentNotValidQueueMode for invalid argument
+	ErrorArgumentNotValidQueueMode = "Os parametros para alteração do estado da fila são inválidos"
+	// ErrorArgumentNotValidWebhook for invalid argument
+	ErrorArgumentNotValidWebhook = "Os parametros do webhook são inválidos"
+	// ErrorQueueFull for a queue that reached its limit
+	ErrorQueueFull = repository.ErrorQueueFull
+	// ErrorWebhookAddressNotAllowed for webhooks pointing to the server network
+	ErrorWebhookAddressNotAllowed = "O endereço do webhook não é permitido"
+	// ErrorNotFoundQueue for a queue the store does not have
+	ErrorNotFoundQueue = repository.ErrorNotFoundQueue
 	// ErrorStoreExists for already created store
-	ErrorStoreExists = "Estabelecimento com nome já cadastrado"
+	ErrorStoreExists = repository.ErrorStoreExists
+)
+
+var (
+	// ErrArgumentNotValidGetStore for invalid argument
+	ErrArgumentNotValidGetStore = apperror.New(apperror.InvalidArgument, "invalid_get_store_arguments", ErrorArgumentNotValidGetStore)
+	// ErrArgumentNotValidAddStore for invalid argument
+	ErrArgumentNotValidAddStore = apperror.New(apperror.InvalidArgument, "invalid_add_store_arguments", ErrorArgumentNotValidAddStore)
+	// ErrArgumentNotValidRemoveStore for invalid argument
+	ErrArgumentNotValidRemoveStore = apperror.New(apperror.InvalidArgument, "invalid_remove_store_arguments", ErrorArgumentNotValidRemoveStore)
+	// ErrArgumentNotValidAddConsumer for invalid argument
+	ErrArgumentNotValidAddConsumer = apperror.New(apperror.InvalidArgument, "invalid_add_consumer_arguments", ErrorArgumentNotValidAddConsumer)
+	// ErrArgumentNotValidRemoveConsumer for invalid argument
+	ErrArgumentNotValidRemoveConsumer = apperror.New(apperror.InvalidArgument, "invalid_remove_consumer_arguments", ErrorArgumentNotValidRemoveConsumer)
+	// ErrArgumentNotValidGetConsumer for invalid argument
+	ErrArgumentNotValidGetConsumer = apperror.New(apperror.InvalidArgument, "invalid_get_consumer_arguments", ErrorArgumentNotValidGetConsumer)
+	// ErrArgumentNotValidValidateConsumer for invalid argument
+	ErrArgumentNotValidValidateConsumer = apperror.New(apperror.InvalidArgument, "invalid_validate_consumer_arguments", ErrorArgumentNotValidValidateConsumer)
+	// ErrArgumentNotValidCallNext for invalid argument
+	ErrArgumentNotValidCallNext = apperror.New(apperror.InvalidArgument, "invalid_call_next_arguments", ErrorArgumentNotValidCallNext)
+	// ErrArgumentNotValidFinishCall for invalid argument
+	ErrArgumentNotValidFinishCall = apperror.New(apperror.InvalidArgument, "invalid_finish_call_arguments", ErrorArgumentNotValidFinishCall)
+	// ErrArgumentNotValidAccessKey for invalid argument
+	ErrArgumentNotValidAccessKey = apperror.New(apperror.InvalidArgument, "invalid_access_key_arguments", ErrorArgumentNotValidAccessKey)
+	// ErrArgumentNotValidAddStaff for invalid argument
+	ErrArgumentNotValidAddStaff = apperror.New(apperror.InvalidArgument, "invalid_add_staff_arguments", ErrorArgumentNotValidAddStaff)
+	// ErrArgumentNotValidAssignOwner for invalid argument
+	ErrArgumentNotValidAssignOwner = apperror.New(apperror.InvalidArgument, "invalid_assign_owner_arguments", ErrorArgumentNotValidAssignOwner)
+	// ErrArgumentNotValidListStores for invalid argument
+	ErrArgumentNotValidListStores = apperror.New(apperror.InvalidArgument, "invalid_list_stores_arguments", ErrorArgumentNotValidListStores)
+	// ErrArgumentNotValidUpdateStore for invalid argument
+	ErrArgumentNotValidUpdateStore = apperror.New(apperror.InvalidArgument, "invalid_update_store_arguments", ErrorArgumentNotValidUpdateStore)
+	// ErrArgumentNotValidQueueMode for invalid argument
+	ErrArgumentNotValidQueueMode = apperror.New(apperror.InvalidArgument, "invalid_queue_mode_arguments", ErrorArgumentNotValidQueueMode)
+	// ErrArgumentNotValidWebhook for invalid argument
+	ErrArgumentNotValidWebhook = apperror.New(apperror.InvalidArgument, "invalid_webhook_arguments", ErrorArgumentNotValidWebhook)
+	// ErrQueueFull for a queue that reached its limit
+	ErrQueueFull = repository.ErrQueueFull
+	// ErrWebhookAddressNotAllowed for webhooks pointing to the server network
+	ErrWebhookAddressNotAllowed = apperror.New(apperror.InvalidArgument, "webhook_address_not_allowed", ErrorWebhookAddressNotAllowed)
+	// ErrNotFoundQueue for a queue the store does not have
+	ErrNotFoundQueue = repository.ErrNotFoundQueue
+	// ErrStoreExists for already created store
+	ErrStoreExists = repository.ErrStoreExists
 )
 
 // StoreServiceImpl implements
 type StoreServiceImpl struct {
 	storeRepository repository.StoreRepository
+	hub             *event.Hub
+	metrics         *metrics.Metrics
+	notifications   *notifications
+	outbox          repository.OutboxRepository
+	transactor      repository.Transactor
+	webhooks        *webhooks
+	baseURL         string
 }
 
 // NewStoreServiceImpl implements
-func NewStoreServiceImpl(db *mongo.Collection) StoreService {
+// queue holds the consumers of every store, dbTimeout bounds every database
+// operation and baseURL is the public URL of the API, used in the links sent
+// to consumers. Their messages are written to outbox in the transactions of
+// transactor, the near front one when nearFront consumers are left ahead.
+// Queue events are delivered to the webhooks in hooks, pings through sender.
+func NewStoreServiceImpl(db *mongo.Collection, queue *mongo.Collection, dbTimeout time.Duration, hub *event.Hub, baseURL string, m *metrics.Metrics, outbox repository.OutboxRepository, transactor repository.Transactor, nearFront int, hooks repository.WebhookRepository, sender webhook.Sender) StoreService {
+	repo := repository.NewStoreInstrumentedRepository(repository.NewStoreRepository(db, queue, dbTimeout), m)
+
+	return newStoreService(repo, hub, baseURL, m, outbox, transactor, nearFront, hooks, sender)
+}
+
+// newStoreService builds the service over the given repositories
+func newStoreService(repo repository.StoreRepository, hub *event.Hub, baseURL string, m *metrics.Metrics, outbox repository.OutboxRepository, transactor repository.Transactor, nearFront int, hooks repository.WebhookRepository, sender webhook.Sender) *StoreServiceImpl {
 	return &StoreServiceImpl{
-		storeRepository: repository.NewStoreRepository(db),
+		storeRepository: repo,
+		hub:             hub,
+		metrics:         m,
+		baseURL:         baseURL,
+		outbox:          outbox,
+		transactor:      transactor,
+		webhooks:        &webhooks{repo: hooks, sender: sender},
+		notifications:   &notifications{outbox: outbox, nearFront: nearFront},
 	}
 }
 
 // Create implements
-func (svc *StoreServiceImpl) Create(name string) (*domain.Store, error) {
-
-	if name == "" {
-		return nil, errors.New(ErrorArgumentNotValidAddStore)
-	}
+// Names are unique ignoring case. The slug comes from the name, with a
+// numeric suffix when another name already produced it.
+func (svc *StoreServiceImpl) Create(ctx context.Context, name, ownerID string) (*domain.Store, error) {
 
-	lstore, err := svc.storeRepository.GetStore(name)
-	if err != nil {
-		if err.Error() != repository.ErrorNotFoundStore {
-			return nil, err
-		}
-	}
-
-	if lstore != nil {
-		return nil, errors.New(ErrorStoreExists)
+	if name == "" || ownerID == "" {
+		return nil, ErrArgumentNotValidAddStore
 	}
 
-	urlBase := "http://localhost:8080/mystore"
-	accessURL := fmt.Sprintf("%s/%s", urlBase, strings.ToLower(name))
-
-	store := domain.Store{
-		Name:    name,
-		URLName: accessURL,
-	}
+	return createWithSlug(ctx, svc.storeRepository, name, ownerID, func(storeSlug string) string {
+		return fmt.Sprintf("%s/mystore/%s", svc.baseURL, storeSlug)
+	})
+}
 
-	newStore, err := svc.storeRepository.Create(&store)
-	if err != nil {
-		return nil, err
-	}
+// UpdateStore implements
+// Changes are rejected with repository.ErrStoreVersionConflict when the
+// store changed after update.Version was read.
+func (svc *StoreServiceImpl) UpdateStore(ctx context.Context, id string, update domain.StoreUpdate) (*domain.Store, error) {
 
-	return newStore, nil
+	return updateStore(ctx, svc.storeRepository, svc.transactor, id, update, func(storeSlug string) string {
+		return fmt.Sprintf("%s/mystore/%s", svc.baseURL, storeSlug)
+	})
 }
 
 // RemoveStore implements
-func (svc *StoreServiceImpl) RemoveStore(id string) error {
+func (svc *StoreServiceImpl) RemoveStore(ctx context.Context, id string) error {
 
 	if id == "" {
-		return errors.New(ErrorArgumentNotValidRemoveStore)
+		return ErrArgumentNotValidRemoveStore
 	}
 
-	err := svc.storeRepository.RemoveStore(id)
+	// The messages and webhook deliveries still pending go with the store, so
+	// the workers do not keep retrying them
+	err := svc.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := svc.storeRepository.RemoveStore(ctx, id); err != nil {
+			return err
+		}
+		if err := svc.outbox.RemoveByStore(ctx, id); err != nil {
+			return err
+		}
+		return svc.webhooks.repo.RemoveByStore(ctx, id)
+	})
 	if err != nil {
 		return err
 	}
 
+	svc.metrics.RemoveStore(id)
+
 	return nil
 }
 
-// GetAllStores implements
-func (svc *StoreServiceImpl) GetAllStores() ([]string, error) {
-	stores, err := svc.storeRepository.GetAllStores()
+// ListStores implements
+func (svc *StoreServiceImpl) ListStores(ctx context.Context, opts repository.StoreListOptions) (*domain.StorePage, error) {
+	return listStores(ctx, svc.storeRepository, opts)
+}
+
+// GetStore implements
+func (svc *StoreServiceImpl) GetStore(ctx context.Context, name string) (*domain.Store, error) {
+
+	if name == "" {
+		return nil, ErrArgumentNotValidGetStore
+	}
+
+	store, err := svc.storeRepository.GetStore(ctx, name)
 	if err != nil {
 		return nil, err
 	}
 
-	return stores, nil
+	return withQueueState(store, time.Now()), nil
 }
 
-// GetStore implements
-func (svc *StoreServiceImpl) GetStore(name string) (*domain.Store, error) {
+// GetStoreBySlug implements
+func (svc *StoreServiceImpl) GetStoreBySlug(ctx context.Context, slug string) (*domain.Store, error) {
 
-	if name == "" {
-		return nil, errors.New(ErrorArgumentNotValidGetStore)
+	if slug == "" {
+		return nil, ErrArgumentNotValidGetStore
 	}
 
-	store, err := svc.storeRepository.GetStore(name)
+	store, err := svc.storeRepository.GetStoreBySlug(ctx, slug)
 	if err != nil {
 		return nil, err
 	}
 
-	return store, nil
+	return withQueueState(store, time.Now()), nil
 }
 
 // GetStoreByID implements
-func (svc *StoreServiceImpl) GetStoreByID(id string) (*domain.Store, error) {
+func (svc *StoreServiceImpl) GetStoreByID(ctx context.Context, id string) (*domain.Store, error) {
 
 	if id == "" {
-		return nil, errors.New(ErrorArgumentNotValidGetStore)
+		return nil, ErrArgumentNotValidGetStore
 	}
 
-	store, err := svc.storeRepository.GetStoreByID(id)
+	store, err := svc.storeRepository.GetStoreByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	return store, nil
+	return withQueueState(store, time.Now()), nil
 }
 
 // AddConsumer implements
-func (svc *StoreServiceImpl) AddConsumer(id, name, phone, status string) (string, error) {
+// The consumer joins the queue of the store with queueID. A party size of
+// zero means the consumer comes alone.
+func (svc *StoreServiceImpl) AddConsumer(ctx context.Context, id, queueID, name, rawPhone string, partySize int, status domain.ConsumerStatus) (string, error) {
+
+	if id == "" || queueID == "" || name == "" || rawPhone == "" || partySize < 0 || !status.Valid() {
+		return "", ErrArgumentNotValidAddConsumer
+	}
+	if partySize == 0 {
+		partySize = 1
+	}
+
+	// Normalized so the same number written differently is still a duplicate
+	normalizedPhone, err := phone.Normalize(rawPhone)
+	if err != nil {
+		return "", err
+	}
+
+	store, err := findQueue(ctx, svc.storeRepository, id, queueID)
+	if err != nil {
+		return "", err
+	}
 
-	if id == "" || name == "" || phone == "" {
-		return "", errors.New(ErrorArgumentNotValidAddConsumer)
+	if err := checkQueueOpen(store, time.Now()); err != nil {
+		return "", err
 	}
 
-	s1 := rand.NewSource(time.Now().UnixNano())
-	r1 := rand.New(s1)
+	ahead := len(store.Waiting(queueID))
+
+	joinedAt := time.Now().UTC()
 
 	consumer := domain.Consumer{
+		ID:        newConsumerID(),
+		QueueID:   queueID,
 		Name:      name,
-		Phone:     phone,
-		Accesskey: strconv.Itoa(r1.Int()),
+		Phone:     normalizedPhone,
+		PartySize: partySize,
 		Status:    status,
+		JoinedAt:  &joinedAt,
 	}
 
-	if err := svc.storeRepository.AddConsumer(id, &consumer); err != nil {
-		return "", err
-	}
+	e := event.Event{Type: event.ConsumerJoined, StoreID: id, QueueID: queueID, ConsumerID: consumer.ID, OccurredAt: joinedAt}
 
-	store, err := svc.storeRepository.GetStoreByID(id)
-	if err != nil {
-		return "", err
+	for attempt := 1; ; attempt++ {
+		accessKey, err := newAccessKey()
+		if err != nil {
+			return "", err
+		}
+		consumer.Accesskey = accessKey
+
+		// Each attempt in its own transaction, a duplicate key aborts it
+		err = svc.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+			if err := svc.storeRepository.AddConsumer(ctx, id, &consumer, store.SettingsOf(queueID).MaxWaiting); err != nil {
+				return err
+			}
+			if err := svc.notifications.send(ctx, store, &consumer, domain.NotifyJoined, ahead); err != nil {
+				return err
+			}
+			return svc.webhooks.dispatch(ctx, e)
+		})
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, repository.ErrAccessKeyExists) || attempt == maxAccessKeyAttempts {
+			return "", err
+		}
 	}
 
+	publish(ctx, svc.hub, svc.metrics, svc.storeRepository, e)
+
 	accessConsumerURL := fmt.Sprintf("%s/%s", store.URLName, consumer.Accesskey)
 
 	return accessConsumerURL, nil
 }
 
 // RemoveConsumer implements
-func (svc *StoreServiceImpl) RemoveConsumer(id, phone string) error {
+// The consumer is told they were removed.
+func (svc *StoreServiceImpl) RemoveConsumer(ctx context.Context, id, queueID, consumerID string) error {
 
-	if id == "" || phone == "" {
-		return errors.New(ErrorArgumentNotValidRemoveConsumer)
+	if id == "" || queueID == "" || consumerID == "" {
+		return ErrArgumentNotValidRemoveConsumer
 	}
 
-	if err := svc.storeRepository.RemoveConsumer(id, phone); err != nil {
+	return svc.removeConsumer(ctx, id, queueID, consumerID, true)
+}
+
+// removeConsumer cancels the consumer and warns whoever got near the front.
+// notifyRemoved tells the consumer, which is pointless when they left by
+// themselves: the page they cancelled from already confirms it.
+func (svc *StoreServiceImpl) removeConsumer(ctx context.Context, id, queueID, consumerID string, notifyRemoved bool) error {
+
+	position, consumer, err := svc.storeRepository.GetConsumer(ctx, id, queueID, consumerID)
+	if err != nil {
 		return err
 	}
+	wasWaiting := consumer.Status == domain.StatusWaiting
+
+	e := event.Event{Type: event.ConsumerCancelled, StoreID: id, QueueID: queueID, ConsumerID: consumerID, OccurredAt: time.Now().UTC()}
+
+	err = svc.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := svc.storeRepository.RemoveConsumer(ctx, id, queueID, consumerID); err != nil {
+			return err
+		}
+
+		if notifyRemoved {
+			if err := svc.notifications.sendTo(ctx, svc.storeRepository, id, consumer, domain.NotifyRemoved, position); err != nil {
+				return err
+			}
+		}
+		if wasWaiting {
+			if err := svc.notifications.queueMoved(ctx, svc.storeRepository, id, queueID, position); err != nil {
+				return err
+			}
+		}
+		return svc.webhooks.dispatch(ctx, e)
+	})
+	if err != nil {
+		return err
+	}
+
+	publish(ctx, svc.hub, svc.metrics, svc.storeRepository, e)
 
 	return nil
 }
 
 // GetConsumer implements
-func (svc *StoreServiceImpl) GetConsumer(id, phone string) (int, *domain.Consumer, error) {
+func (svc *StoreServiceImpl) GetConsumer(ctx context.Context, id, queueID, consumerID string) (int, *domain.Consumer, error) {
 
-	if id == "" || phone == "" {
-		return -1, nil, errors.New(ErrorArgumentNotValidGetConsumer)
+	if id == "" || queueID == "" || consumerID == "" {
+		return -1, nil, ErrArgumentNotValidGetConsumer
+	}
+
+	position, consumer, err := svc.storeRepository.GetConsumer(ctx, id, queueID, consumerID)
+	if err != nil {
+		return -1, nil, err
 	}
 
-	position, consumer, err := svc.storeRepository.GetConsumer(id, phone)
+	history, err := svc.storeRepository.GetCallHistory(ctx, id, queueID, callHistoryLimit)
 	if err != nil {
 		return -1, nil, err
 	}
 
+	setEstimatedWait(consumer, position, serviceInterval(history, time.Now()))
+
 	return position, consumer, nil
 }
 
 // GetAllConsumers implements
-func (svc *StoreServiceImpl) GetAllConsumers(id string) ([]*domain.Consumer, error) {
+// The consumers waiting in the queue, with the wait estimated from the calls
+// of that queue only.
+func (svc *StoreServiceImpl) GetAllConsumers(ctx context.Context, id, queueID string) ([]*domain.Consumer, error) {
 
-	if id == "" {
-		return nil, errors.New(ErrorArgumentNotValidGetConsumer)
+	if id == "" || queueID == "" {
+		return nil, ErrArgumentNotValidGetConsumer
+	}
+
+	if _, err := findQueue(ctx, svc.storeRepository, id, queueID); err != nil {
+		return nil, err
+	}
+
+	consumers, err := svc.storeRepository.GetAllConsumers(ctx, id, queueID)
+	if err != nil {
+		return nil, err
 	}
 
-	consumers, err := svc.storeRepository.GetAllConsumers(id)
+	history, err := svc.storeRepository.GetCallHistory(ctx, id, queueID, callHistoryLimit)
 	if err != nil {
 		return nil, err
 	}
 
+	avg := serviceInterval(history, time.Now())
+	for position, consumer := range consumers {
+		setEstimatedWait(consumer, position, avg)
+	}
+
 	return consumers, nil
 }
 
 // ValidateConsumer implements
-func (svc *StoreServiceImpl) ValidateConsumer(storeName, accessKey string) (int, *domain.Consumer, error) {
+// The access key tells the queue, the position is the one in that queue.
+func (svc *StoreServiceImpl) ValidateConsumer(ctx context.Context, storeSlug, accessKey string) (int, *domain.Consumer, error) {
 
-	if storeName == "" || accessKey == "" {
-		return -1, nil, errors.New(ErrorArgumentNotValidValidateConsumer)
+	if storeSlug == "" || accessKey == "" {
+		return -1, nil, ErrArgumentNotValidValidateConsumer
 	}
 
-	position, consumer, err := svc.storeRepository.ValidateConsumer(storeName, accessKey)
+	position, consumer, err := svc.storeRepository.ValidateConsumer(ctx, storeSlug, accessKey)
 	if err != nil {
 		return -1, nil, err
 	}
 
+	history, err := svc.storeRepository.GetCallHistory(ctx, consumer.StoreID, consumer.JoinedQueue(), callHistoryLimit)
+	if err != nil {
+		return -1, nil, err
+	}
+
+	setEstimatedWait(consumer, position, serviceInterval(history, time.Now()))
+
 	return position, consumer, nil
 }
+
+// CallNext implements
+func (svc *StoreServiceImpl) CallNext(ctx context.Context, id, queueID string) (*domain.Consumer, error) {
+
+	if id == "" || queueID == "" {
+		return nil, ErrArgumentNotValidCallNext
+	}
+
+	if _, err := findQueue(ctx, svc.storeRepository, id, queueID); err != nil {
+		return nil, err
+	}
+
+	return svc.call(ctx, id, queueID, func(ctx context.Context) (int, *domain.Consumer, error) {
+		consumer, err := svc.storeRepository.CallNext(ctx, id, queueID)
+		return 0, consumer, err
+	})
+}
+
+// CallNextForTable implements
+// The earliest waiting party that fits a table of capacity is called,
+// passing over at most the MaxSkip setting of the queue of bigger ones.
+func (svc *StoreServiceImpl) CallNextForTable(ctx context.Context, id, queueID string, capacity int) (*domain.Consumer, error) {
+
+	if id == "" || queueID == "" || capacity < 1 {
+		return nil, ErrArgumentNotValidCallNext
+	}
+
+	store, err := findQueue(ctx, svc.storeRepository, id, queueID)
+	if err != nil {
+		return nil, err
+	}
+	maxSkip := store.SettingsOf(queueID).MaxSkip
+
+	return svc.call(ctx, id, queueID, func(ctx context.Context) (int, *domain.Consumer, error) {
+		return svc.storeRepository.CallNextFitting(ctx, id, queueID, capacity, maxSkip)
+	})
+}
+
+// call runs next, which calls a consumer of the queue and returns the
+// position they waited at, and sends the messages of the call along with it
+func (svc *StoreServiceImpl) call(ctx context.Context, id, queueID string, next func(ctx context.Context) (int, *domain.Consumer, error)) (*domain.Consumer, error) {
+
+	var consumer *domain.Consumer
+	var e event.Event
+
+	err := svc.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		position, called, err := next(ctx)
+		if err != nil {
+			return err
+		}
+		consumer = called
+
+		if err := svc.notifications.sendTo(ctx, svc.storeRepository, id, consumer, domain.NotifyCalled, 0); err != nil {
+			return err
+		}
+		if err := svc.notifications.queueMoved(ctx, svc.storeRepository, id, queueID, position); err != nil {
+			return err
+		}
+
+		e = event.Event{Type: event.ConsumerCalled, StoreID: id, QueueID: queueID, ConsumerID: consumer.ID, OccurredAt: time.Now().UTC()}
+		return svc.webhooks.dispatch(ctx, e)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	observeWait(svc.metrics, id, consumer)
+
+	publish(ctx, svc.hub, svc.metrics, svc.storeRepository, e)
+
+	return consumer, nil
+}
+
+// Serve implements
+func (svc *StoreServiceImpl) Serve(ctx context.Context, id, queueID, consumerID string) error {
+
+	if id == "" || queueID == "" || consumerID == "" {
+		return ErrArgumentNotValidFinishCall
+	}
+
+	// The consumer is already at the counter, so nothing is sent
+	return svc.finish(ctx, id, queueID, consumerID, domain.StatusServed, event.ConsumerServed, "")
+}
+
+// NoShow implements
+func (svc *StoreServiceImpl) NoShow(ctx context.Context, id, queueID, consumerID string) error {
+
+	if id == "" || queueID == "" || consumerID == "" {
+		return ErrArgumentNotValidFinishCall
+	}
+
+	return svc.finish(ctx, id, queueID, consumerID, domain.StatusNoShow, event.ConsumerNoShow, domain.NotifyNoShow)
+}
+
+// finish moves a called consumer to status, tells them with kind unless it is
+// empty and publishes eventType
+func (svc *StoreServiceImpl) finish(ctx context.Context, id, queueID, consumerID string, status domain.ConsumerStatus, eventType string, kind domain.NotificationKind) error {
+
+	e := event.Event{Type: eventType, StoreID: id, QueueID: queueID, ConsumerID: consumerID, OccurredAt: time.Now().UTC()}
+
+	err := svc.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := svc.storeRepository.UpdateConsumerStatus(ctx, id, queueID, consumerID, status); err != nil {
+			return err
+		}
+		if kind != "" {
+			_, consumer, err := svc.storeRepository.GetConsumer(ctx, id, queueID, consumerID)
+			if err != nil {
+				return err
+			}
+			if err := svc.notifications.sendTo(ctx, svc.storeRepository, id, consumer, kind, 0); err != nil {
+				return err
+			}
+		}
+		return svc.webhooks.dispatch(ctx, e)
+	})
+	if err != nil {
+		return err
+	}
+
+	publish(ctx, svc.hub, svc.metrics, svc.storeRepository, e)
+
+	return nil
+}
+
+// Subscribe implements
+func (svc *StoreServiceImpl) Subscribe(id string) (<-chan event.Event, func()) {
+	return svc.hub.Subscribe(id)
+}
+
+// RotateAccessKey implements
+func (svc *StoreServiceImpl) RotateAccessKey(ctx context.Context, id, queueID, consumerID string) (string, error) {
+
+	if id == "" || queueID == "" || consumerID == "" {
+		return "", ErrArgumentNotValidAccessKey
+	}
+
+	for attempt := 1; ; attempt++ {
+		accessKey, err := newAccessKey()
+		if err != nil {
+			return "", err
+		}
+
+		err = svc.storeRepository.SetAccessKey(ctx, id, queueID, consumerID, accessKey)
+		if err == nil {
+			store, err := svc.storeRepository.GetStoreByID(ctx, id)
+			if err != nil {
+				return "", err
+			}
+
+			return fmt.Sprintf("%s/%s", store.URLName, accessKey), nil
+		}
+		if !errors.Is(err, repository.ErrAccessKeyExists) || attempt == maxAccessKeyAttempts {
+			return "", err
+		}
+	}
+}
+
+// RevokeAccessKey implements
+func (svc *StoreServiceImpl) RevokeAccessKey(ctx context.Context, id, queueID, consumerID string) error {
+
+	if id == "" || queueID == "" || consumerID == "" {
+		return ErrArgumentNotValidAccessKey
+	}
+
+	if err := svc.storeRepository.RevokeAccessKey(ctx, id, queueID, consumerID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CancelByAccessKey implements
+func (svc *StoreServiceImpl) CancelByAccessKey(ctx context.Context, storeSlug, accessKey string) error {
+
+	if storeSlug == "" || accessKey == "" {
+		return ErrArgumentNotValidRemoveConsumer
+	}
+
+	_, consumer, err := svc.storeRepository.ValidateConsumer(ctx, storeSlug, accessKey)
+	if err != nil {
+		return err
+	}
+
+	return svc.removeConsumer(ctx, consumer.StoreID, consumer.JoinedQueue(), consumer.ID, false)
+}
+
+// SetQueueMode implements
+// A pause with until ends by itself, any other mode lasts until changed.
+func (svc *StoreServiceImpl) SetQueueMode(ctx context.Context, id string, mode domain.QueueMode, until *time.Time) (*domain.Store, error) {
+	var store *domain.Store
+	var e event.Event
+
+	err := svc.transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		changed, err := setQueueMode(ctx, svc.storeRepository, id, mode, until)
+		if err != nil {
+			return err
+		}
+		store = changed
+
+		e = event.Event{Type: stateEvent(store.State.Status), StoreID: id, OccurredAt: time.Now().UTC()}
+		return svc.webhooks.dispatch(ctx, e)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	publish(ctx, svc.hub, svc.metrics, svc.storeRepository, e)
+
+	return store, nil
+}
+
+// GetNotifications implements
+// Every message written to the consumer, the oldest first, with its
+// delivery status.
+func (svc *StoreServiceImpl) GetNotifications(ctx context.Context, id, queueID, consumerID string) ([]*domain.OutboxMessage, error) {
+
+	if id == "" || queueID == "" || consumerID == "" {
+		return nil, ErrArgumentNotValidGetConsumer
+	}
+
+	if _, _, err := svc.storeRepository.GetConsumer(ctx, id, queueID, consumerID); err != nil {
+		return nil, err
+	}
+
+	return svc.outbox.ListByConsumer(ctx, id, consumerID)
+}
+
+// CreateWebhook implements
+// The secret that signs the payloads is only returned here.
+func (svc *StoreServiceImpl) CreateWebhook(ctx context.Context, id, url string, events []string) (*domain.Webhook, error) {
+	return svc.webhooks.create(ctx, svc.storeRepository, id, url, events)
+}
+
+// ListWebhooks implements
+func (svc *StoreServiceImpl) ListWebhooks(ctx context.Context, id string) ([]*domain.Webhook, error) {
+
+	if id == "" {
+		return nil, ErrArgumentNotValidWebhook
+	}
+
+	return svc.webhooks.repo.ListWebhooks(ctx, id)
+}
+
+// RemoveWebhook implements
+func (svc *StoreServiceImpl) RemoveWebhook(ctx context.Context, id, webhookID string) error {
+
+	if id == "" || webhookID == "" {
+		return ErrArgumentNotValidWebhook
+	}
+
+	return svc.webhooks.repo.RemoveWebhook(ctx, id, webhookID)
+}
+
+// GetWebhookDeliveries implements
+func (svc *StoreServiceImpl) GetWebhookDeliveries(ctx context.Context, id, webhookID string) ([]*domain.WebhookDelivery, error) {
+	return svc.webhooks.deliveries(ctx, id, webhookID)
+}
+
+// PingWebhook implements
+func (svc *StoreServiceImpl) PingWebhook(ctx context.Context, id, webhookID string) (*domain.WebhookDelivery, error) {
+	return svc.webhooks.ping(ctx, id, webhookID)
+}
+
+// AddStaff implements
+func (svc *StoreServiceImpl) AddStaff(ctx context.Context, id, userID string) error {
+
+	if id == "" || userID == "" {
+		return ErrArgumentNotValidAddStaff
+	}
+
+	if err := svc.storeRepository.AddStaff(ctx, id, userID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AssignOwner implements
+// Stores created before they had an owner are managed by nobody until one is
+// assigned, an owner already set is never replaced.
+func (svc *StoreServiceImpl) AssignOwner(ctx context.Context, id, userID string) error {
+
+	if id == "" || userID == "" {
+		return ErrArgumentNotValidAssignOwner
+	}
+
+	return svc.storeRepository.SetOwner(ctx, id, userID)
+}
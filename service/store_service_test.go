@@ -1,10 +1,25 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
-
+	"time"
+
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/event"
+	"github.com/rokoga/filas-backend/metrics"
+	"github.com/rokoga/filas-backend/notify"
+	"github.com/rokoga/filas-backend/outbox"
+	"github.com/rokoga/filas-backend/phone"
 	"github.com/rokoga/filas-backend/repository"
+	"github.com/rokoga/filas-backend/webhook"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -17,19 +32,25 @@ func TestCreate(t *testing.T) {
 		name       string
 		resultURL  string
 		resultName string
+		resultSlug string
 		err        error
 	}{
-		{name: "Outback", resultURL: "http://app.filas.com/outback", resultName: "Outback", err: nil},
-		{name: "Jeronimo", resultURL: "http://app.filas.com/jeronimo", resultName: "Jeronimo", err: nil},
-		{name: "", resultURL: "", resultName: "", err: errors.New(ErrorArgumentNotValidAddStore)},
+		{name: "Outback", resultURL: "http://app.filas.com/mystore/outback", resultName: "Outback", resultSlug: "outback", err: nil},
+		{name: "Jeronimo", resultURL: "http://app.filas.com/mystore/jeronimo", resultName: "Jeronimo", resultSlug: "jeronimo", err: nil},
+		{name: "Pão de Açúcar", resultURL: "http://app.filas.com/mystore/pao-de-acucar", resultName: "Pão de Açúcar", resultSlug: "pao-de-acucar", err: nil},
+		{name: "Pao de Acucar", resultURL: "http://app.filas.com/mystore/pao-de-acucar-2", resultName: "Pao de Acucar", resultSlug: "pao-de-acucar-2", err: nil},
+		{name: "OUTBACK", resultURL: "", resultName: "", resultSlug: "", err: ErrStoreExists},
+		{name: "!!!", resultURL: "", resultName: "", resultSlug: "", err: ErrArgumentNotValidAddStore},
+		{name: "", resultURL: "", resultName: "", resultSlug: "", err: ErrArgumentNotValidAddStore},
 	}
 
 	for _, test := range tests {
-		store, err := svc.Create(test.name)
+		store, err := svc.Create(context.Background(), test.name, "owner1")
 		if err == nil {
 			assert.NotNil(t, store)
 			assert.Equal(t, test.resultURL, store.URLName)
 			assert.Equal(t, test.resultName, store.Name)
+			assert.Equal(t, test.resultSlug, store.Slug)
 			assert.NotEmpty(t, store.ID)
 		} else {
 			assert.Equal(t, test.err, err)
@@ -42,11 +63,12 @@ func TestCreate(t *testing.T) {
 
 func TestRemoveStore(t *testing.T) {
 
+	ctx := context.Background()
 	svc := NewStoreMockServiceImpl()
 
 	name := "Outback"
 
-	store, err := svc.Create(name)
+	store, err := svc.Create(ctx, name, "owner1")
 
 	assert.Nil(t, err)
 	assert.NotNil(t, store)
@@ -56,13 +78,13 @@ func TestRemoveStore(t *testing.T) {
 		err error
 	}{
 		{id: store.ID, err: nil},
-		{id: store.ID, err: errors.New(repository.ErrorNotFoundStore)},
-		{id: "fakeID", err: errors.New(repository.ErrorNotFoundStore)},
-		{id: "", err: errors.New(ErrorArgumentNotValidRemoveStore)},
+		{id: store.ID, err: repository.ErrNotFoundStore},
+		{id: "fakeID", err: repository.ErrNotFoundStore},
+		{id: "", err: ErrArgumentNotValidRemoveStore},
 	}
 
 	for _, test := range tests {
-		err := svc.RemoveStore(test.id)
+		err := svc.RemoveStore(ctx, test.id)
 		assert.Equal(t, test.err, err)
 	}
 
@@ -70,11 +92,12 @@ func TestRemoveStore(t *testing.T) {
 
 func TestGetStore(t *testing.T) {
 
+	ctx := context.Background()
 	svc := NewStoreMockServiceImpl()
 
 	name := "Outback"
 
-	store, err := svc.Create(name)
+	store, err := svc.Create(ctx, name, "owner1")
 
 	assert.Nil(t, err)
 	assert.NotNil(t, store)
@@ -85,13 +108,14 @@ func TestGetStore(t *testing.T) {
 		resultName string
 		err        error
 	}{
-		{name: "Outback", resultURL: "http://app.filas.com/outback", resultName: "Outback", err: nil},
-		{name: "Jeronimo", resultURL: "", resultName: "", err: errors.New(repository.ErrorNotFoundStore)},
-		{name: "", resultURL: "", resultName: "", err: errors.New(ErrorArgumentNotValidGetStore)},
+		{name: "Outback", resultURL: "http://app.filas.com/mystore/outback", resultName: "Outback", err: nil},
+		{name: "outback", resultURL: "http://app.filas.com/mystore/outback", resultName: "Outback", err: nil},
+		{name: "Jeronimo", resultURL: "", resultName: "", err: repository.ErrNotFoundStore},
+		{name: "", resultURL: "", resultName: "", err: ErrArgumentNotValidGetStore},
 	}
 
 	for _, test := range tests {
-		store, err := svc.GetStore(test.name)
+		store, err := svc.GetStore(ctx, test.name)
 		if err == nil {
 			assert.NotNil(t, store)
 			assert.Equal(t, test.resultURL, store.URLName)
@@ -105,33 +129,330 @@ func TestGetStore(t *testing.T) {
 
 }
 
+func TestListStores(t *testing.T) {
+
+	ctx := context.Background()
+	svc := NewStoreMockServiceImpl()
+
+	ids := map[string]string{}
+	for _, name := range []string{"Outback", "Pão de Açúcar", "jeronimo", "Padaria Central"} {
+		store, err := svc.Create(ctx, name, "owner1")
+		assert.Nil(t, err)
+		ids[name] = store.ID
+	}
+	joinQueue(t, svc, ids["Outback"], "Fulano", "011998989898")
+	joinQueue(t, svc, ids["Outback"], "Ciclano", "011976767676")
+
+	names := func(page *domain.StorePage) []string {
+		var result []string
+		for _, store := range page.Stores {
+			result = append(result, store.Name)
+		}
+		return result
+	}
+
+	tests := []struct {
+		opts  repository.StoreListOptions
+		names []string
+		total int
+		err   error
+	}{
+		{opts: repository.StoreListOptions{}, names: []string{"jeronimo", "Outback", "Padaria Central", "Pão de Açúcar"}, total: 4},
+		{opts: repository.StoreListOptions{Sort: repository.SortByNameDesc, Limit: 2}, names: []string{"Pão de Açúcar", "Padaria Central"}, total: 4},
+		{opts: repository.StoreListOptions{Sort: repository.SortByCreated, Limit: 2, Offset: 1}, names: []string{"Pão de Açúcar", "jeronimo"}, total: 4},
+		{opts: repository.StoreListOptions{Sort: repository.SortByCreatedDesc, Limit: 1}, names: []string{"Padaria Central"}, total: 4},
+		{opts: repository.StoreListOptions{Search: "pa"}, names: []string{"Padaria Central", "Pão de Açúcar"}, total: 2},
+		{opts: repository.StoreListOptions{Search: "ACUCAR"}, names: []string{"Pão de Açúcar"}, total: 1},
+		{opts: repository.StoreListOptions{Search: "burger"}, names: nil, total: 0},
+		{opts: repository.StoreListOptions{Offset: 10}, names: nil, total: 4},
+		{opts: repository.StoreListOptions{Limit: 101}, err: ErrArgumentNotValidListStores},
+		{opts: repository.StoreListOptions{Offset: -1}, err: ErrArgumentNotValidListStores},
+		{opts: repository.StoreListOptions{Sort: "phone"}, err: ErrArgumentNotValidListStores},
+	}
+
+	for _, test := range tests {
+		page, err := svc.ListStores(ctx, test.opts)
+		assert.Equal(t, test.err, err, test.opts)
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, test.names, names(page), test.opts)
+		assert.Equal(t, test.total, page.Total, test.opts)
+	}
+
+	page, err := svc.ListStores(ctx, repository.StoreListOptions{Search: "outback"})
+	assert.Nil(t, err)
+	if assert.Len(t, page.Stores, 1) {
+		assert.Equal(t, ids["Outback"], page.Stores[0].ID)
+		assert.Equal(t, "outback", page.Stores[0].Slug)
+		assert.Equal(t, 2, page.Stores[0].QueueLength)
+		assert.True(t, page.Stores[0].Open)
+	}
+	assert.Equal(t, 20, page.Limit)
+}
+
+func TestGetStoreBySlug(t *testing.T) {
+
+	ctx := context.Background()
+	svc := NewStoreMockServiceImpl()
+
+	store, err := svc.Create(ctx, "Pão de Açúcar", "owner1")
+	assert.Nil(t, err)
+	assert.NotNil(t, store)
+
+	tests := []struct {
+		slug string
+		err  error
+	}{
+		{slug: "pao-de-acucar", err: nil},
+		{slug: "Pão de Açúcar", err: repository.ErrNotFoundStore},
+		{slug: "", err: ErrArgumentNotValidGetStore},
+	}
+
+	for _, test := range tests {
+		result, err := svc.GetStoreBySlug(ctx, test.slug)
+		assert.Equal(t, test.err, err, test.slug)
+		if err == nil {
+			assert.Equal(t, store.ID, result.ID)
+		}
+	}
+}
+
+func TestUpdateStore(t *testing.T) {
+
+	ctx := context.Background()
+	svc := NewStoreMockServiceImpl()
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+	assert.Nil(t, err)
+	_, err = svc.Create(ctx, "Madero", "owner1")
+	assert.Nil(t, err)
+
+	name := func(s string) *string { return &s }
+	logo := "https://cdn.filas.com/outback.png"
+
+	tests := []struct {
+		update     domain.StoreUpdate
+		resultSlug string
+		err        error
+	}{
+		{update: domain.StoreUpdate{Version: 0, LogoURL: &logo}, resultSlug: "outback", err: nil},
+		{update: domain.StoreUpdate{Version: 0, Name: name("Outback Steakhouse")}, err: repository.ErrStoreVersionConflict},
+		{update: domain.StoreUpdate{Version: 1, Name: name("Outback Steakhouse")}, resultSlug: "outback-steakhouse", err: nil},
+		{update: domain.StoreUpdate{Version: 2, Name: name("MADERO")}, err: repository.ErrStoreExists},
+		{update: domain.StoreUpdate{Version: 2, Name: name("  ")}, err: &domain.SettingsError{Field: "name", Reason: "não pode ser vazio"}},
+		{update: domain.StoreUpdate{Version: 2, Name: name("!!!")}, err: ErrArgumentNotValidUpdateStore},
+		{update: domain.StoreUpdate{Version: 2, Contact: &domain.Contact{Phone: "11 98888-7777"}}, resultSlug: "outback-steakhouse", err: nil},
+		{update: domain.StoreUpdate{Version: 3, Name: name("Outback")}, resultSlug: "outback", err: nil},
+	}
+
+	for i, test := range tests {
+		result, err := svc.UpdateStore(ctx, store.ID, test.update)
+		assert.Equal(t, test.err, err, i)
+		if err == nil {
+			assert.Equal(t, test.resultSlug, result.Slug, i)
+			assert.Equal(t, test.update.Version+1, result.Version, i)
+		}
+	}
+
+	result, err := svc.GetStoreByID(ctx, store.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "Outback", result.Name)
+	assert.Equal(t, logo, result.LogoURL)
+	assert.Equal(t, "+5511988887777", result.Contact.Phone)
+	assert.Equal(t, "http://app.filas.com/mystore/outback", result.URLName)
+	assert.Equal(t, []string{"outback-steakhouse"}, result.PreviousSlugs)
+
+	// A link shared before the rename still reaches the store
+	_, err = svc.UpdateStore(ctx, store.ID, domain.StoreUpdate{Version: 4, Name: name("Outback Grill")})
+	assert.Nil(t, err)
+	result, err = svc.GetStoreBySlug(ctx, "outback")
+	assert.Nil(t, err)
+	assert.Equal(t, store.ID, result.ID)
+
+	_, err = svc.UpdateStore(ctx, "", domain.StoreUpdate{})
+	assert.Equal(t, ErrArgumentNotValidUpdateStore, err)
+	_, err = svc.UpdateStore(ctx, "FakeID", domain.StoreUpdate{})
+	assert.Equal(t, repository.ErrNotFoundStore, err)
+}
+
+func TestPreviousSlugs(t *testing.T) {
+
+	ctx := context.Background()
+	svc := NewStoreMockServiceImpl()
+
+	name := func(s string) *string { return &s }
+
+	outback, err := svc.Create(ctx, "Outback", "owner1")
+	assert.Nil(t, err)
+	_, err = svc.UpdateStore(ctx, outback.ID, domain.StoreUpdate{Version: 0, Name: name("Outback Grill")})
+	assert.Nil(t, err)
+
+	// The slug kept by the renamed store is not given to another one
+	other, err := svc.Create(ctx, "Outback!", "owner2")
+	assert.Nil(t, err)
+	assert.Equal(t, "outback-2", other.Slug)
+
+	madero, err := svc.Create(ctx, "Madero", "owner3")
+	assert.Nil(t, err)
+	madero, err = svc.UpdateStore(ctx, madero.ID, domain.StoreUpdate{Version: 0, Name: name("Outback.")})
+	assert.Nil(t, err)
+	assert.Equal(t, "outback-3", madero.Slug)
+
+	result, err := svc.GetStoreBySlug(ctx, "outback")
+	assert.Nil(t, err)
+	assert.Equal(t, outback.ID, result.ID)
+
+	// The store that had it may take it back
+	result, err = svc.UpdateStore(ctx, outback.ID, domain.StoreUpdate{Version: 1, Name: name("Outback")})
+	assert.Nil(t, err)
+	assert.Equal(t, "outback", result.Slug)
+	assert.Equal(t, []string{"outback-grill"}, result.PreviousSlugs)
+}
+
+func TestQueueLimit(t *testing.T) {
+
+	ctx := context.Background()
+	svc := NewStoreMockServiceImpl()
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+	assert.Nil(t, err)
+
+	_, err = svc.UpdateStore(ctx, store.ID, domain.StoreUpdate{Settings: &domain.QueueSettings{MaxWaiting: 1}})
+	assert.Nil(t, err)
+
+	_, err = svc.AddConsumer(ctx, store.ID, domain.DefaultQueueID, "Fulano", "011998989898", 1, domain.StatusWaiting)
+	assert.Nil(t, err)
+	_, err = svc.AddConsumer(ctx, store.ID, domain.DefaultQueueID, "Ciclano", "011922222222", 1, domain.StatusWaiting)
+	assert.Equal(t, ErrQueueFull, err)
+
+	// A called consumer no longer counts against the limit
+	_, err = svc.CallNext(ctx, store.ID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+	_, err = svc.AddConsumer(ctx, store.ID, domain.DefaultQueueID, "Ciclano", "011922222222", 1, domain.StatusWaiting)
+	assert.Nil(t, err)
+}
+
+func TestQueueLimitConcurrent(t *testing.T) {
+
+	ctx := context.Background()
+	svc := NewStoreMockServiceImpl()
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+	assert.Nil(t, err)
+	_, err = svc.UpdateStore(ctx, store.ID, domain.StoreUpdate{Settings: &domain.QueueSettings{MaxWaiting: 5}})
+	assert.Nil(t, err)
+
+	const total = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, total)
+	for i := 0; i < total; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := svc.AddConsumer(ctx, store.ID, domain.DefaultQueueID, fmt.Sprintf("Consumer %d", i), fmt.Sprintf("0119%08d", i), 1, domain.StatusWaiting)
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	// The limit is checked when writing, not on the store read before
+	accepted := 0
+	for err := range errs {
+		if err == nil {
+			accepted++
+		} else {
+			assert.Equal(t, ErrQueueFull, err)
+		}
+	}
+	assert.Equal(t, 5, accepted)
+}
+
+func TestSetQueueMode(t *testing.T) {
+
+	ctx := context.Background()
+	svc := NewStoreMockServiceImpl()
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+	assert.Nil(t, err)
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		mode   domain.QueueMode
+		until  *time.Time
+		status domain.QueueStatus
+		join   error
+		err    error
+	}{
+		{mode: domain.ModeClosed, status: domain.QueueClosed, join: domain.ErrQueueClosed},
+		{mode: domain.ModePaused, until: &future, status: domain.QueuePaused, join: domain.ErrQueuePaused},
+		{mode: domain.ModeAuto, status: domain.QueueOpen, join: nil},
+		{mode: domain.ModePaused, until: &past, err: ErrArgumentNotValidQueueMode},
+		{mode: domain.ModeClosed, until: &future, err: ErrArgumentNotValidQueueMode},
+		{mode: "fechado", err: ErrArgumentNotValidQueueMode},
+	}
+
+	for i, test := range tests {
+		result, err := svc.SetQueueMode(ctx, store.ID, test.mode, test.until)
+		assert.Equal(t, test.err, err, i)
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, test.status, result.State.Status, i)
+
+		public, err := svc.GetStoreBySlug(ctx, "outback")
+		assert.Nil(t, err)
+		assert.Equal(t, test.status, public.State.Status, i)
+
+		_, err = svc.AddConsumer(ctx, store.ID, domain.DefaultQueueID, "Fulano", fmt.Sprintf("01199898989%d", i), 1, domain.StatusWaiting)
+		if test.join == nil {
+			assert.Nil(t, err, i)
+		} else {
+			assert.True(t, errors.Is(err, test.join), i)
+		}
+	}
+
+	_, err = svc.SetQueueMode(ctx, "FakeID", domain.ModeOpen, nil)
+	assert.Equal(t, repository.ErrNotFoundStore, err)
+}
+
 func TestAddConsumer(t *testing.T) {
 
+	ctx := context.Background()
 	svc := NewStoreMockServiceImpl()
 
 	name := "Outback"
 
-	store, err := svc.Create(name)
+	store, err := svc.Create(ctx, name, "owner1")
 
 	assert.Nil(t, err)
 	assert.NotNil(t, store)
 
 	tests := []struct {
-		id     string
-		name   string
-		phone  string
-		status string
-		err    error
+		id        string
+		name      string
+		phone     string
+		partySize int
+		status    domain.ConsumerStatus
+		err       error
 	}{
 		{id: store.ID, name: "Fulano", phone: "011998989898", status: "Na fila", err: nil},
-		{id: store.ID, name: "Ciclano", phone: "011922222222", status: "Na fila", err: nil},
-		{id: store.ID, name: "", phone: "", status: "Na fila", err: errors.New(ErrorArgumentNotValidAddConsumer)},
-		{id: "", name: "Fulaninho", phone: "011888888888", status: "Na fila", err: errors.New(ErrorArgumentNotValidAddConsumer)},
-		{id: "FakeID", name: "Fulaninho", phone: "011888888888", status: "Na fila", err: errors.New(repository.ErrorNotFoundStore)},
+		{id: store.ID, name: "Ciclano", phone: "011922222222", partySize: 4, status: "Na fila", err: nil},
+		{id: store.ID, name: "Beltrano", phone: "011933333333", partySize: -1, status: "Na fila", err: ErrArgumentNotValidAddConsumer},
+		{id: store.ID, name: "", phone: "", status: "Na fila", err: ErrArgumentNotValidAddConsumer},
+		{id: "", name: "Fulaninho", phone: "011988888888", status: "Na fila", err: ErrArgumentNotValidAddConsumer},
+		{id: "FakeID", name: "Fulaninho", phone: "011988888888", status: "Na fila", err: repository.ErrNotFoundStore},
+		{id: store.ID, name: "Beltrano", phone: "011777777777", status: "Perdido", err: ErrArgumentNotValidAddConsumer},
+		{id: store.ID, name: "Beltrano", phone: "123", status: "Na fila", err: phone.ErrInvalidPhone},
+		{id: store.ID, name: "Fulano", phone: "+55 (11) 99898-9898", status: "Na fila", err: repository.ErrConsumerExists},
 	}
 
 	for _, test := range tests {
-		accessURL, err := svc.AddConsumer(test.id, test.name, test.phone, test.status)
+		accessURL, err := svc.AddConsumer(ctx, test.id, domain.DefaultQueueID, test.name, test.phone, test.partySize, test.status)
 		if err == nil {
 			assert.NotNil(t, accessURL)
 		} else {
@@ -144,38 +465,31 @@ func TestAddConsumer(t *testing.T) {
 
 func TestRemoveConsumer(t *testing.T) {
 
+	ctx := context.Background()
 	svc := NewStoreMockServiceImpl()
 
 	name := "Outback"
 
-	store, err := svc.Create(name)
+	store, err := svc.Create(ctx, name, "owner1")
 
 	assert.Nil(t, err)
 	assert.NotNil(t, store)
 
-	consumerName := "Fulano"
-	consumerPhone := "011998989898"
-	consumerFakePhone := "011988888888"
-	status := "Na fila"
-
-	accessConsumerURL, err2 := svc.AddConsumer(store.ID, consumerName, consumerPhone, status)
-
-	assert.Nil(t, err2)
-	assert.NotNil(t, accessConsumerURL)
+	consumerID := joinQueue(t, svc, store.ID, "Fulano", "011998989898")
 
 	tests := []struct {
-		id    string
-		phone string
-		err   error
+		id         string
+		consumerID string
+		err        error
 	}{
-		{id: store.ID, phone: consumerPhone, err: nil},
-		{id: store.ID, phone: consumerFakePhone, err: errors.New(repository.ErrorNotFoundConsumer)},
-		{id: "fakeID", phone: consumerPhone, err: errors.New(repository.ErrorNotFoundConsumer)},
-		{id: "", phone: consumerPhone, err: errors.New(ErrorArgumentNotValidRemoveConsumer)},
+		{id: store.ID, consumerID: consumerID, err: nil},
+		{id: store.ID, consumerID: "fakeConsumerID", err: repository.ErrNotFoundConsumer},
+		{id: "fakeID", consumerID: consumerID, err: repository.ErrNotFoundStore},
+		{id: "", consumerID: consumerID, err: ErrArgumentNotValidRemoveConsumer},
 	}
 
 	for _, test := range tests {
-		err := svc.RemoveConsumer(test.id, test.phone)
+		err := svc.RemoveConsumer(ctx, test.id, domain.DefaultQueueID, test.consumerID)
 		assert.Equal(t, test.err, err)
 	}
 
@@ -183,43 +497,36 @@ func TestRemoveConsumer(t *testing.T) {
 
 func TestGetConsumer(t *testing.T) {
 
+	ctx := context.Background()
 	svc := NewStoreMockServiceImpl()
 
 	name := "Outback"
 
-	store, err := svc.Create(name)
+	store, err := svc.Create(ctx, name, "owner1")
 
 	assert.Nil(t, err)
 	assert.NotNil(t, store)
 
-	consumerName := "Fulano"
-	consumerPhone := "011998989898"
-	consumerFakePhone := "011988888888"
-	status := "Na fila"
-
-	accessConsumerURL, err2 := svc.AddConsumer(store.ID, consumerName, consumerPhone, status)
-
-	assert.Nil(t, err2)
-	assert.NotNil(t, accessConsumerURL)
+	consumerID := joinQueue(t, svc, store.ID, "Fulano", "011998989898")
 
 	tests := []struct {
-		id     string
-		phone  string
-		status string
-		err    error
+		id         string
+		consumerID string
+		err        error
 	}{
-		{id: store.ID, phone: consumerPhone, status: "Na fila", err: nil},
-		{id: store.ID, phone: consumerFakePhone, status: "Na fila", err: errors.New(repository.ErrorNotFoundConsumer)},
-		{id: "fakeID", phone: consumerPhone, status: "Na fila", err: errors.New(repository.ErrorNotFoundConsumer)},
-		{id: "", phone: consumerPhone, status: "Na fila", err: errors.New(ErrorArgumentNotValidGetConsumer)},
+		{id: store.ID, consumerID: consumerID, err: nil},
+		{id: store.ID, consumerID: "fakeConsumerID", err: repository.ErrNotFoundConsumer},
+		{id: "fakeID", consumerID: consumerID, err: repository.ErrNotFoundStore},
+		{id: "", consumerID: consumerID, err: ErrArgumentNotValidGetConsumer},
 	}
 
 	for _, test := range tests {
-		position, consumer, err := svc.GetConsumer(test.id, test.phone)
+		position, consumer, err := svc.GetConsumer(ctx, test.id, domain.DefaultQueueID, test.consumerID)
 		if err == nil {
 			assert.NotNil(t, consumer)
+			assert.Equal(t, consumerID, consumer.ID)
 			assert.NotEmpty(t, consumer.Name)
-			assert.NotEmpty(t, consumer.Phone)
+			assert.Equal(t, "+5511998989898", consumer.Phone)
 			assert.NotEmpty(t, consumer.Accesskey)
 			assert.NotEqual(t, position, -1)
 		} else {
@@ -232,11 +539,12 @@ func TestGetConsumer(t *testing.T) {
 
 func TestGetAllConsumers(t *testing.T) {
 
+	ctx := context.Background()
 	svc := NewStoreMockServiceImpl()
 
 	name := "Outback"
 
-	store, err := svc.Create(name)
+	store, err := svc.Create(ctx, name, "owner1")
 
 	assert.Nil(t, err)
 	assert.NotNil(t, store)
@@ -244,7 +552,7 @@ func TestGetAllConsumers(t *testing.T) {
 	consumers := []struct {
 		name   string
 		phone  string
-		status string
+		status domain.ConsumerStatus
 	}{
 		{name: "Fulano Um", phone: "011998989899", status: "Na fila"},
 		{name: "Fulano Dois", phone: "011976767676", status: "Na fila"},
@@ -252,20 +560,1080 @@ func TestGetAllConsumers(t *testing.T) {
 	}
 
 	for _, c := range consumers {
-		accessConsumerURL, err := svc.AddConsumer(store.ID, c.name, c.phone, c.status)
+		accessConsumerURL, err := svc.AddConsumer(ctx, store.ID, domain.DefaultQueueID, c.name, c.phone, 1, c.status)
 		assert.Nil(t, err)
 		assert.NotNil(t, accessConsumerURL)
 	}
 
-	result, err := svc.GetAllConsumers(store.ID)
+	result, err := svc.GetAllConsumers(ctx, store.ID, domain.DefaultQueueID)
 
 	assert.Nil(t, err)
 	assert.NotNil(t, result)
 
-	result, err2 := svc.GetAllConsumers("")
+	result, err2 := svc.GetAllConsumers(ctx, "", domain.DefaultQueueID)
 
 	assert.NotNil(t, err2)
-	assert.Equal(t, err2, errors.New(ErrorArgumentNotValidGetConsumer))
+	assert.Equal(t, err2, ErrArgumentNotValidGetConsumer)
 	assert.Nil(t, result)
 
 }
+
+func TestAddConsumerConcurrent(t *testing.T) {
+
+	ctx := context.Background()
+	svc := NewStoreMockServiceImpl()
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+
+	assert.Nil(t, err)
+	assert.NotNil(t, store)
+
+	const total = 50
+
+	var wg sync.WaitGroup
+	errs := make(chan error, total)
+
+	for i := 0; i < total; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := svc.AddConsumer(ctx, store.ID, domain.DefaultQueueID, fmt.Sprintf("Fulano %d", i), fmt.Sprintf("0119%08d", i), 1, "Na fila")
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.Nil(t, err)
+	}
+
+	consumers, err := svc.GetAllConsumers(ctx, store.ID, domain.DefaultQueueID)
+
+	assert.Nil(t, err)
+	assert.Len(t, consumers, total)
+
+}
+
+func TestCallNext(t *testing.T) {
+
+	ctx := context.Background()
+	svc := NewStoreMockServiceImpl()
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+
+	assert.Nil(t, err)
+	assert.NotNil(t, store)
+
+	_, err = svc.CallNext(ctx, store.ID, domain.DefaultQueueID)
+	assert.Equal(t, repository.ErrEmptyQueue, err)
+
+	consumers := []struct {
+		name  string
+		phone string
+		id    string
+	}{
+		{name: "Fulano Um", phone: "011998989899"},
+		{name: "Fulano Dois", phone: "011976767676"},
+	}
+
+	for i, c := range consumers {
+		consumers[i].id = joinQueue(t, svc, store.ID, c.name, c.phone)
+	}
+
+	for _, c := range consumers {
+		consumer, err := svc.CallNext(ctx, store.ID, domain.DefaultQueueID)
+		assert.Nil(t, err)
+		assert.NotNil(t, consumer)
+		assert.Equal(t, c.id, consumer.ID)
+		assert.Equal(t, domain.StatusCalled, consumer.Status)
+		assert.NotNil(t, consumer.CalledAt)
+	}
+
+	consumer, err := svc.CallNext(ctx, store.ID, domain.DefaultQueueID)
+	assert.Equal(t, repository.ErrEmptyQueue, err)
+	assert.Nil(t, consumer)
+
+	consumer, err = svc.CallNext(ctx, "fakeID", domain.DefaultQueueID)
+	assert.Equal(t, repository.ErrNotFoundStore, err)
+	assert.Nil(t, consumer)
+
+	consumer, err = svc.CallNext(ctx, "", domain.DefaultQueueID)
+	assert.Equal(t, ErrArgumentNotValidCallNext, err)
+	assert.Nil(t, consumer)
+
+}
+
+func TestCallNextForTable(t *testing.T) {
+
+	ctx := context.Background()
+	svc := NewStoreMockServiceImpl()
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+	assert.Nil(t, err)
+
+	_, err = svc.CallNextForTable(ctx, store.ID, domain.DefaultQueueID, 4)
+	assert.Equal(t, repository.ErrEmptyQueue, err)
+
+	ana := joinParty(t, svc, store.ID, "Ana", "011911111111", 6)
+	bia := joinParty(t, svc, store.ID, "Bia", "011922222222", 2)
+	caio := joinParty(t, svc, store.ID, "Caio", "011933333333", 4)
+	davi := joinParty(t, svc, store.ID, "Davi", "011944444444", 4)
+	eva := joinParty(t, svc, store.ID, "Eva", "011955555555", 2)
+
+	// Without a skip limit the first party that fits is called
+	consumer, err := svc.CallNextForTable(ctx, store.ID, domain.DefaultQueueID, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, bia, consumer.ID)
+	assert.Equal(t, domain.StatusCalled, consumer.Status)
+	assert.Equal(t, 2, consumer.PartySize)
+
+	// Davi got two parties ahead
+	messages, err := svc.GetNotifications(ctx, store.ID, domain.DefaultQueueID, davi)
+	assert.Nil(t, err)
+	assert.Len(t, messages, 2)
+	assert.Equal(t, domain.NotifyNearFront, messages[1].Kind)
+
+	_, err = svc.UpdateStore(ctx, store.ID, domain.StoreUpdate{Settings: &domain.QueueSettings{MaxSkip: 2}})
+	assert.Nil(t, err)
+
+	tests := []struct {
+		capacity int
+		id       string
+		err      error
+	}{
+		{capacity: 2, err: repository.ErrNoFittingParty},
+		{capacity: 1, err: repository.ErrNoFittingParty},
+		{capacity: 0, err: ErrArgumentNotValidCallNext},
+		{capacity: 4, id: caio},
+		{capacity: 8, id: ana},
+		{capacity: 2, id: eva},
+		{capacity: 4, id: davi},
+		{capacity: 4, err: repository.ErrEmptyQueue},
+	}
+
+	for i, test := range tests {
+		consumer, err := svc.CallNextForTable(ctx, store.ID, domain.DefaultQueueID, test.capacity)
+		assert.Equal(t, test.err, err, i)
+		if err == nil {
+			assert.Equal(t, test.id, consumer.ID, i)
+		}
+	}
+
+	_, err = svc.CallNextForTable(ctx, "", domain.DefaultQueueID, 4)
+	assert.Equal(t, ErrArgumentNotValidCallNext, err)
+	_, err = svc.CallNextForTable(ctx, "fakeID", domain.DefaultQueueID, 4)
+	assert.Equal(t, repository.ErrNotFoundStore, err)
+}
+
+func TestQueues(t *testing.T) {
+
+	ctx := context.Background()
+	svc := NewStoreMockServiceImpl()
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+	assert.Nil(t, err)
+
+	store, err = svc.UpdateStore(ctx, store.ID, domain.StoreUpdate{Queues: []domain.Queue{
+		{ID: domain.DefaultQueueID, Name: "Mesas"},
+		{Name: "Caixa", Settings: &domain.QueueSettings{MaxWaiting: 1}},
+		{Name: "Retirada"},
+	}})
+	assert.Nil(t, err)
+	assert.Len(t, store.Queues, 3)
+
+	ana := joinQueue(t, svc, store.ID, "Ana", "011911111111")
+	bia := joinNamedQueue(t, svc, store.ID, "caixa", "Bia", "011922222222", 1)
+	caio := joinQueue(t, svc, store.ID, "Caio", "011933333333")
+
+	// Positions count only the consumers of the same queue
+	position, _, err := svc.GetConsumer(ctx, store.ID, "caixa", bia)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, position)
+	position, _, err = svc.GetConsumer(ctx, store.ID, domain.DefaultQueueID, caio)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, position)
+
+	_, _, err = svc.GetConsumer(ctx, store.ID, "caixa", ana)
+	assert.Equal(t, repository.ErrNotFoundConsumer, err)
+
+	// Only the cashier queue has a limit
+	_, err = svc.AddConsumer(ctx, store.ID, "caixa", "Davi", "011944444444", 1, domain.StatusWaiting)
+	assert.Equal(t, ErrQueueFull, err)
+	joinQueue(t, svc, store.ID, "Davi", "011944444444")
+
+	_, err = svc.AddConsumer(ctx, store.ID, "cozinha", "Eva", "011955555555", 1, domain.StatusWaiting)
+	assert.Equal(t, ErrNotFoundQueue, err)
+	_, err = svc.GetAllConsumers(ctx, store.ID, "cozinha")
+	assert.Equal(t, ErrNotFoundQueue, err)
+	_, err = svc.CallNext(ctx, store.ID, "cozinha")
+	assert.Equal(t, ErrNotFoundQueue, err)
+
+	public, err := svc.GetStoreBySlug(ctx, store.Slug)
+	assert.Nil(t, err)
+	lengths := map[string]int{}
+	for _, queue := range public.Queues {
+		lengths[queue.ID] = queue.Length
+	}
+	assert.Equal(t, map[string]int{domain.DefaultQueueID: 3, "caixa": 1, "retirada": 0}, lengths)
+
+	consumer, err := svc.CallNext(ctx, store.ID, "caixa")
+	assert.Nil(t, err)
+	assert.Equal(t, bia, consumer.ID)
+	_, err = svc.CallNext(ctx, store.ID, "retirada")
+	assert.Equal(t, repository.ErrEmptyQueue, err)
+	consumer, err = svc.CallNext(ctx, store.ID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+	assert.Equal(t, ana, consumer.ID)
+
+	// The cashier queue still has Bia called
+	_, err = svc.UpdateStore(ctx, store.ID, domain.StoreUpdate{Version: store.Version, Queues: []domain.Queue{{ID: domain.DefaultQueueID, Name: "Mesas"}}})
+	assert.True(t, errors.Is(err, domain.ErrInvalidStoreSettings))
+
+	assert.Nil(t, svc.Serve(ctx, store.ID, "caixa", bia))
+	store, err = svc.UpdateStore(ctx, store.ID, domain.StoreUpdate{Version: store.Version, Queues: []domain.Queue{{ID: domain.DefaultQueueID, Name: "Mesas"}}})
+	assert.Nil(t, err)
+	assert.Len(t, store.Queues, 1)
+}
+
+func TestRejoin(t *testing.T) {
+
+	ctx := context.Background()
+	svc := NewStoreMockServiceImpl()
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+	assert.Nil(t, err)
+	store, err = svc.UpdateStore(ctx, store.ID, domain.StoreUpdate{Queues: []domain.Queue{
+		{ID: domain.DefaultQueueID, Name: "Mesas"},
+		{Name: "Caixa"},
+	}})
+	assert.Nil(t, err)
+
+	ana := joinQueue(t, svc, store.ID, "Ana", "011911111111")
+	_, err = svc.AddConsumer(ctx, store.ID, domain.DefaultQueueID, "Ana", "(11) 91111-1111", 1, domain.StatusWaiting)
+	assert.Equal(t, repository.ErrConsumerExists, err)
+
+	// The same phone may wait in another queue of the store
+	joinNamedQueue(t, svc, store.ID, "caixa", "Ana", "011911111111", 1)
+
+	// And join again once it left, was served or did not show up
+	assert.Nil(t, svc.RemoveConsumer(ctx, store.ID, domain.DefaultQueueID, ana))
+	ana = joinQueue(t, svc, store.ID, "Ana", "011911111111")
+
+	_, err = svc.CallNext(ctx, store.ID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+	_, err = svc.AddConsumer(ctx, store.ID, domain.DefaultQueueID, "Ana", "011911111111", 1, domain.StatusWaiting)
+	assert.Equal(t, repository.ErrConsumerExists, err)
+
+	assert.Nil(t, svc.Serve(ctx, store.ID, domain.DefaultQueueID, ana))
+	ana = joinQueue(t, svc, store.ID, "Ana", "011911111111")
+
+	_, err = svc.CallNext(ctx, store.ID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+	assert.Nil(t, svc.NoShow(ctx, store.ID, domain.DefaultQueueID, ana))
+	joinQueue(t, svc, store.ID, "Ana", "011911111111")
+}
+
+func TestServeAndNoShow(t *testing.T) {
+
+	ctx := context.Background()
+	svc := NewStoreMockServiceImpl()
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+
+	assert.Nil(t, err)
+	assert.NotNil(t, store)
+
+	served := joinQueue(t, svc, store.ID, "Fulano", "011998989899")
+	absent := joinQueue(t, svc, store.ID, "Ciclano", "011976767676")
+
+	assert.Equal(t, &domain.TransitionError{From: domain.StatusWaiting, To: domain.StatusServed}, svc.Serve(ctx, store.ID, domain.DefaultQueueID, served))
+
+	_, err = svc.CallNext(ctx, store.ID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+	_, err = svc.CallNext(ctx, store.ID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		id         string
+		consumerID string
+		finish     func(ctx context.Context, id, queueID, consumerID string) error
+		err        error
+	}{
+		{id: store.ID, consumerID: served, finish: svc.Serve, err: nil},
+		{id: store.ID, consumerID: absent, finish: svc.NoShow, err: nil},
+		{id: store.ID, consumerID: served, finish: svc.NoShow, err: &domain.TransitionError{From: domain.StatusServed, To: domain.StatusNoShow}},
+		{id: store.ID, consumerID: "fakeConsumerID", finish: svc.Serve, err: repository.ErrNotFoundConsumer},
+		{id: "", consumerID: served, finish: svc.Serve, err: ErrArgumentNotValidFinishCall},
+	}
+
+	for _, test := range tests {
+		err := test.finish(ctx, test.id, domain.DefaultQueueID, test.consumerID)
+		assert.Equal(t, test.err, err)
+	}
+
+	_, consumer, err := svc.GetConsumer(ctx, store.ID, domain.DefaultQueueID, served)
+	assert.Nil(t, err)
+	assert.Equal(t, domain.StatusServed, consumer.Status)
+
+	_, consumer, err = svc.GetConsumer(ctx, store.ID, domain.DefaultQueueID, absent)
+	assert.Nil(t, err)
+	assert.Equal(t, domain.StatusNoShow, consumer.Status)
+
+}
+
+func TestSubscribe(t *testing.T) {
+
+	ctx := context.Background()
+	svc := NewStoreMockServiceImpl()
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+
+	assert.Nil(t, err)
+	assert.NotNil(t, store)
+
+	events, cancel := svc.Subscribe(store.ID)
+	defer cancel()
+
+	consumerID := joinQueue(t, svc, store.ID, "Fulano", "011998989898")
+
+	_, err = svc.CallNext(ctx, store.ID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+	assert.Nil(t, svc.Serve(ctx, store.ID, domain.DefaultQueueID, consumerID))
+
+	// Failed operations must not publish
+	assert.NotNil(t, svc.RemoveConsumer(ctx, store.ID, domain.DefaultQueueID, consumerID))
+
+	for _, expected := range []string{event.ConsumerJoined, event.ConsumerCalled, event.ConsumerServed} {
+		e := <-events
+		assert.Equal(t, expected, e.Type)
+		assert.Equal(t, store.ID, e.StoreID)
+		assert.Equal(t, consumerID, e.ConsumerID)
+	}
+	assert.Len(t, events, 0)
+
+}
+
+func TestServiceInterval(t *testing.T) {
+
+	now := time.Date(2020, 12, 1, 20, 30, 0, 0, time.UTC)
+	at := func(hour, min int) *time.Time {
+		called := time.Date(2020, 12, 1, hour, min, 0, 0, time.UTC)
+		return &called
+	}
+
+	tests := []struct {
+		name  string
+		queue []*domain.Consumer
+		avg   time.Duration
+	}{
+		{name: "no history", queue: nil, avg: 0},
+		{name: "single call", queue: []*domain.Consumer{{CalledAt: at(20, 0)}}, avg: 0},
+		{
+			name: "rolling average",
+			queue: []*domain.Consumer{
+				{CalledAt: at(18, 0)}, {CalledAt: at(18, 4)}, {CalledAt: at(18, 10)}, {},
+			},
+			avg: 5 * time.Minute,
+		},
+		{
+			name: "gaps while closed are ignored",
+			queue: []*domain.Consumer{
+				{CalledAt: at(8, 0)}, {CalledAt: at(18, 0)}, {CalledAt: at(18, 2)},
+			},
+			avg: 2 * time.Minute,
+		},
+		{
+			name: "same hour of the day preferred",
+			queue: []*domain.Consumer{
+				{CalledAt: at(17, 0)}, {CalledAt: at(17, 30)}, {CalledAt: at(20, 0)},
+				{CalledAt: at(20, 3)}, {CalledAt: at(20, 6)}, {CalledAt: at(20, 9)},
+			},
+			avg: 3 * time.Minute,
+		},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.avg, serviceInterval(test.queue, now), test.name)
+	}
+
+}
+
+func TestEstimatedWait(t *testing.T) {
+
+	ctx := context.Background()
+	svc := NewStoreMockServiceImpl()
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+
+	assert.Nil(t, err)
+	assert.NotNil(t, store)
+
+	phones := []string{"011998989899", "011976767676", "011954545454", "011932323232"}
+	ids := make([]string, len(phones))
+	for i, phone := range phones {
+		ids[i] = joinQueue(t, svc, store.ID, "Fulano", phone)
+	}
+
+	// Two calls ten minutes apart
+	first, err := svc.CallNext(ctx, store.ID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+	second, err := svc.CallNext(ctx, store.ID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+	*first.CalledAt = second.CalledAt.Add(-10 * time.Minute)
+
+	consumers, err := svc.GetAllConsumers(ctx, store.ID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+	assert.Len(t, consumers, 2)
+	assert.Equal(t, int64(600), consumers[0].EstimatedWaitSeconds)
+	assert.Equal(t, int64(1200), consumers[1].EstimatedWaitSeconds)
+	assert.NotNil(t, consumers[0].JoinedAt)
+
+	position, consumer, err := svc.GetConsumer(ctx, store.ID, domain.DefaultQueueID, ids[3])
+	assert.Nil(t, err)
+	assert.Equal(t, 1, position)
+	assert.Equal(t, int64(1200), consumer.EstimatedWaitSeconds)
+
+	_, consumer, err = svc.GetConsumer(ctx, store.ID, domain.DefaultQueueID, ids[1])
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), consumer.EstimatedWaitSeconds)
+
+}
+
+func TestAccessKey(t *testing.T) {
+
+	ctx := context.Background()
+	svc := NewStoreMockServiceImpl()
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+
+	assert.Nil(t, err)
+	assert.NotNil(t, store)
+
+	accessURL, err := svc.AddConsumer(ctx, store.ID, domain.DefaultQueueID, "Fulano", "011998989898", 1, domain.StatusWaiting)
+	assert.Nil(t, err)
+
+	accessKey := accessURL[strings.LastIndex(accessURL, "/")+1:]
+	_, consumer, err := svc.ValidateConsumer(ctx, store.Slug, accessKey)
+	assert.Nil(t, err)
+	assert.Regexp(t, "^[A-Za-z0-9_-]{32}$", consumer.Accesskey)
+	assert.Equal(t, store.URLName+"/"+consumer.Accesskey, accessURL)
+
+	oldKey := consumer.Accesskey
+
+	rotatedURL, err := svc.RotateAccessKey(ctx, store.ID, domain.DefaultQueueID, consumer.ID)
+	assert.Nil(t, err)
+	assert.NotEqual(t, accessURL, rotatedURL)
+	assert.NotEqual(t, oldKey, consumer.Accesskey)
+
+	_, _, err = svc.ValidateConsumer(ctx, store.Slug, oldKey)
+	assert.Equal(t, repository.ErrNotValidAccessKey, err)
+
+	_, _, err = svc.ValidateConsumer(ctx, store.Slug, consumer.Accesskey)
+	assert.Nil(t, err)
+
+	assert.Nil(t, svc.RevokeAccessKey(ctx, store.ID, domain.DefaultQueueID, consumer.ID))
+
+	_, _, err = svc.ValidateConsumer(ctx, store.Slug, consumer.Accesskey)
+	assert.Equal(t, repository.ErrNotValidAccessKey, err)
+
+	tests := []struct {
+		id         string
+		consumerID string
+		err        error
+	}{
+		{id: store.ID, consumerID: "fakeConsumerID", err: repository.ErrNotFoundConsumer},
+		{id: "", consumerID: consumer.ID, err: ErrArgumentNotValidAccessKey},
+	}
+
+	for _, test := range tests {
+		accessURL, err := svc.RotateAccessKey(ctx, test.id, domain.DefaultQueueID, test.consumerID)
+		assert.Equal(t, test.err, err)
+		assert.Empty(t, accessURL)
+		assert.Equal(t, test.err, svc.RevokeAccessKey(ctx, test.id, domain.DefaultQueueID, test.consumerID))
+	}
+
+}
+
+func TestAccessKeyExpiresWhenLeaving(t *testing.T) {
+
+	ctx := context.Background()
+	svc := NewStoreMockServiceImpl()
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+
+	assert.Nil(t, err)
+	assert.NotNil(t, store)
+
+	consumerID := joinQueue(t, svc, store.ID, "Fulano", "011998989898")
+
+	assert.Nil(t, svc.RemoveConsumer(ctx, store.ID, domain.DefaultQueueID, consumerID))
+
+	_, consumer, err := svc.GetConsumer(ctx, store.ID, domain.DefaultQueueID, consumerID)
+	assert.Nil(t, err)
+	assert.NotNil(t, consumer.AccessKeyExpiresAt)
+	assert.False(t, consumer.AccessKeyExpired(time.Now()))
+	assert.True(t, consumer.AccessKeyExpired(time.Now().Add(repository.AccessKeyLifetime)))
+
+	// A consumer that left the queue cannot get a new key
+	_, err = svc.RotateAccessKey(ctx, store.ID, domain.DefaultQueueID, consumerID)
+	assert.Equal(t, repository.ErrConsumerStatusChanged, err)
+
+}
+
+func TestStaffAndCancelByAccessKey(t *testing.T) {
+
+	ctx := context.Background()
+	svc := NewStoreMockServiceImpl()
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "owner1", store.OwnerID)
+	assert.True(t, store.IsManagedBy("owner1"))
+	assert.False(t, store.IsManagedBy("staff1"))
+
+	assert.Nil(t, svc.AddStaff(ctx, store.ID, "staff1"))
+	assert.Equal(t, ErrArgumentNotValidAddStaff, svc.AddStaff(ctx, store.ID, ""))
+	assert.Equal(t, repository.ErrNotFoundStore, svc.AddStaff(ctx, "fakeID", "staff1"))
+
+	store, err = svc.GetStoreByID(ctx, store.ID)
+	assert.Nil(t, err)
+	assert.True(t, store.IsManagedBy("staff1"))
+
+	consumerID := joinQueue(t, svc, store.ID, "Fulano", "011998989898")
+
+	_, consumer, err := svc.GetConsumer(ctx, store.ID, domain.DefaultQueueID, consumerID)
+	assert.Nil(t, err)
+
+	assert.Equal(t, repository.ErrNotValidAccessKey, svc.CancelByAccessKey(ctx, store.Slug, "chave-errada"))
+	assert.Nil(t, svc.CancelByAccessKey(ctx, store.Slug, consumer.Accesskey))
+	assert.Equal(t, domain.StatusCancelled, consumer.Status)
+
+	// A cancelled spot cannot be cancelled again
+	assert.NotNil(t, svc.CancelByAccessKey(ctx, store.Slug, consumer.Accesskey))
+
+}
+
+func TestCancelledContext(t *testing.T) {
+
+	svc := NewStoreMockServiceImpl()
+
+	store, err := svc.Create(context.Background(), "Outback", "owner1")
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = svc.Create(ctx, "Jeronimo", "owner1")
+	assert.Equal(t, context.Canceled, err)
+
+	_, err = svc.AddConsumer(ctx, store.ID, domain.DefaultQueueID, "Fulano", "011998989898", 1, domain.StatusWaiting)
+	assert.Equal(t, context.Canceled, err)
+
+	_, err = svc.GetAllConsumers(ctx, store.ID, domain.DefaultQueueID)
+	assert.Equal(t, context.Canceled, err)
+
+	_, err = svc.CallNext(ctx, store.ID, domain.DefaultQueueID)
+	assert.Equal(t, context.Canceled, err)
+
+	consumers, err := svc.GetAllConsumers(context.Background(), store.ID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+	assert.Empty(t, consumers)
+
+}
+
+func TestNotifications(t *testing.T) {
+
+	ctx := context.Background()
+	svc := NewStoreMockServiceImpl()
+	sent := notify.NewMemory()
+	worker := outbox.NewWorker(svc.(*StoreServiceImpl).outbox, sent, outbox.Options{Backoff: time.Second, MaxBackoff: time.Minute, MaxAttempts: 3, Lease: time.Minute})
+	drain := func() []notify.Message {
+		_, err := worker.Drain(ctx)
+		assert.Nil(t, err)
+		return sent.Messages()
+	}
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+	assert.Nil(t, err)
+
+	_, err = svc.UpdateStore(ctx, store.ID, domain.StoreUpdate{MessageTemplates: map[domain.NotificationKind]string{
+		domain.NotifyCalled: "{{.Name}}, sua mesa no {{.Store}} está pronta",
+	}})
+	assert.Nil(t, err)
+
+	first := joinQueue(t, svc, store.ID, "Ana", "011911111111")
+	joinQueue(t, svc, store.ID, "Bia", "011922222222")
+	third := joinQueue(t, svc, store.ID, "Caio", "011933333333")
+	fourth := joinQueue(t, svc, store.ID, "Davi", "011944444444")
+
+	messages := drain()
+	assert.Len(t, messages, 4)
+	assert.Equal(t, "+5511944444444", messages[3].To)
+	assert.Equal(t, string(domain.NotifyJoined), messages[3].Kind)
+	assert.Contains(t, messages[3].Body, "na posição 4")
+	assert.Contains(t, messages[3].Body, "http://app.filas.com/mystore/outback/")
+
+	// Davi gets two consumers ahead once Ana is called
+	_, err = svc.CallNext(ctx, store.ID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+
+	messages = drain()[4:]
+	assert.Len(t, messages, 2)
+	assert.Equal(t, notify.Message{To: "+5511911111111", Body: "Ana, sua mesa no Outback está pronta", Kind: "called", StoreID: store.ID, ConsumerID: first}, messages[0])
+	assert.Equal(t, string(domain.NotifyNearFront), messages[1].Kind)
+	assert.Equal(t, fourth, messages[1].ConsumerID)
+
+	// Davi leaving moves nobody closer to the front
+	assert.Nil(t, svc.RemoveConsumer(ctx, store.ID, domain.DefaultQueueID, fourth))
+	messages = drain()[6:]
+	assert.Len(t, messages, 1)
+	assert.Equal(t, string(domain.NotifyRemoved), messages[0].Kind)
+	assert.Equal(t, fourth, messages[0].ConsumerID)
+
+	// Consumers leaving by themselves are not told they were removed
+	_, consumer, err := svc.GetConsumer(ctx, store.ID, domain.DefaultQueueID, third)
+	assert.Nil(t, err)
+	assert.Nil(t, svc.CancelByAccessKey(ctx, "outback", consumer.Accesskey))
+	assert.Len(t, drain(), 7)
+
+	delivered, err := svc.GetNotifications(ctx, store.ID, domain.DefaultQueueID, first)
+	assert.Nil(t, err)
+	assert.Len(t, delivered, 2)
+	assert.Equal(t, domain.NotifyJoined, delivered[0].Kind)
+	assert.Equal(t, domain.DeliverySent, delivered[1].Status)
+	assert.Equal(t, 1, delivered[1].Attempts)
+
+	_, err = svc.GetNotifications(ctx, store.ID, domain.DefaultQueueID, "unknown")
+	assert.Equal(t, repository.ErrNotFoundConsumer, err)
+
+	_, err = svc.GetNotifications(ctx, "", domain.DefaultQueueID, first)
+	assert.Equal(t, ErrArgumentNotValidGetConsumer, err)
+}
+
+func TestFinishNotifications(t *testing.T) {
+
+	ctx := context.Background()
+	svc := NewStoreMockServiceImpl()
+	sent := notify.NewMemory()
+	worker := outbox.NewWorker(svc.(*StoreServiceImpl).outbox, sent, outbox.Options{Backoff: time.Second, MaxBackoff: time.Minute, MaxAttempts: 3, Lease: time.Minute})
+	drain := func() []notify.Message {
+		_, err := worker.Drain(ctx)
+		assert.Nil(t, err)
+		return sent.Messages()
+	}
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+	assert.Nil(t, err)
+
+	served := joinQueue(t, svc, store.ID, "Ana", "011911111111")
+	missed := joinQueue(t, svc, store.ID, "Bia", "011922222222")
+	left := joinQueue(t, svc, store.ID, "Caio", "011933333333")
+	assert.Len(t, drain(), 3)
+
+	// Served consumers are at the counter and get nothing
+	_, err = svc.CallNext(ctx, store.ID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+	assert.Len(t, drain(), 4)
+	assert.Nil(t, svc.Serve(ctx, store.ID, domain.DefaultQueueID, served))
+	assert.Len(t, drain(), 4)
+
+	// Consumers who missed the call are told they lost the place
+	_, err = svc.CallNext(ctx, store.ID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+	assert.Len(t, drain(), 5)
+	assert.Nil(t, svc.NoShow(ctx, store.ID, domain.DefaultQueueID, missed))
+	messages := drain()[5:]
+	assert.Len(t, messages, 1)
+	assert.Equal(t, notify.Message{To: "+5511922222222", Body: "Bia, você não compareceu ao ser chamado e saiu da fila de Outback.", Kind: "no_show", StoreID: store.ID, ConsumerID: missed}, messages[0])
+
+	// Consumers who cancelled by themselves already saw it on their page
+	_, consumer, err := svc.GetConsumer(ctx, store.ID, domain.DefaultQueueID, left)
+	assert.Nil(t, err)
+	assert.Nil(t, svc.CancelByAccessKey(ctx, "outback", consumer.Accesskey))
+	assert.Len(t, drain(), 6)
+
+	// A failed transition sends nothing
+	assert.NotNil(t, svc.NoShow(ctx, store.ID, domain.DefaultQueueID, missed))
+	assert.Len(t, drain(), 6)
+}
+
+// joinQueue adds a waiting consumer and returns its ID
+func joinQueue(t *testing.T, svc StoreService, storeID, name, rawPhone string) string {
+	return joinParty(t, svc, storeID, name, rawPhone, 1)
+}
+
+// joinParty adds a waiting party of partySize and returns its ID
+func joinParty(t *testing.T, svc StoreService, storeID, name, rawPhone string, partySize int) string {
+	return joinNamedQueue(t, svc, storeID, domain.DefaultQueueID, name, rawPhone, partySize)
+}
+
+// joinNamedQueue adds a waiting party of partySize to the queue and returns its ID
+func joinNamedQueue(t *testing.T, svc StoreService, storeID, queueID, name, rawPhone string, partySize int) string {
+	ctx := context.Background()
+
+	accessURL, err := svc.AddConsumer(ctx, storeID, queueID, name, rawPhone, partySize, domain.StatusWaiting)
+	assert.Nil(t, err)
+
+	store, err := svc.GetStoreByID(ctx, storeID)
+	assert.Nil(t, err)
+
+	accessKey := accessURL[strings.LastIndex(accessURL, "/")+1:]
+	_, consumer, err := svc.ValidateConsumer(ctx, store.Slug, accessKey)
+	assert.Nil(t, err)
+
+	return consumer.ID
+}
+
+func TestWebhooks(t *testing.T) {
+
+	ctx := context.Background()
+	svc := NewStoreMockServiceImpl()
+
+	var pings []*http.Request
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pings = append(pings, r)
+	}))
+	defer endpoint.Close()
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+	assert.Nil(t, err)
+
+	invalid := []struct {
+		name   string
+		id     string
+		url    string
+		events []string
+	}{
+		{name: "no store", id: "", url: endpoint.URL, events: []string{event.ConsumerJoined}},
+		{name: "relative url", id: store.ID, url: "/hooks", events: []string{event.ConsumerJoined}},
+		{name: "ftp url", id: store.ID, url: "ftp://pos.local/hooks", events: []string{event.ConsumerJoined}},
+		{name: "no events", id: store.ID, url: endpoint.URL, events: nil},
+		{name: "unknown event", id: store.ID, url: endpoint.URL, events: []string{"consumer.dancing"}},
+		{name: "repeated event", id: store.ID, url: endpoint.URL, events: []string{event.ConsumerJoined, event.ConsumerJoined}},
+	}
+	for _, tt := range invalid {
+		_, err := svc.CreateWebhook(ctx, tt.id, tt.url, tt.events)
+		assert.Equal(t, ErrArgumentNotValidWebhook, err, tt.name)
+	}
+
+	_, err = svc.CreateWebhook(ctx, "unknown", endpoint.URL, []string{event.ConsumerJoined})
+	assert.Equal(t, repository.ErrNotFoundStore, err)
+
+	hook, err := svc.CreateWebhook(ctx, store.ID, endpoint.URL, []string{event.ConsumerJoined, event.StorePaused})
+	assert.Nil(t, err)
+	assert.Len(t, hook.Secret, 2*webhookSecretBytes)
+
+	consumerID := joinQueue(t, svc, store.ID, "Ana", "011911111111")
+
+	// Not subscribed to calls
+	_, err = svc.CallNext(ctx, store.ID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+
+	_, err = svc.SetQueueMode(ctx, store.ID, domain.ModePaused, nil)
+	assert.Nil(t, err)
+
+	deliveries, err := svc.GetWebhookDeliveries(ctx, store.ID, hook.ID)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 2)
+	assert.Equal(t, event.StorePaused, deliveries[0].Event)
+	assert.Equal(t, event.ConsumerJoined, deliveries[1].Event)
+	assert.Equal(t, domain.DeliveryPending, deliveries[1].Status)
+
+	var payload webhook.Payload
+	assert.Nil(t, json.Unmarshal([]byte(deliveries[1].Payload), &payload))
+	assert.Equal(t, deliveries[1].ID, payload.ID)
+	assert.Equal(t, event.ConsumerJoined, payload.Type)
+	assert.Equal(t, store.ID, payload.StoreID)
+	assert.Equal(t, consumerID, payload.ConsumerID)
+	assert.False(t, payload.OccurredAt.IsZero())
+
+	// Pings are sent right away and logged
+	ping, err := svc.PingWebhook(ctx, store.ID, hook.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, domain.DeliverySent, ping.Status)
+	assert.Equal(t, http.StatusOK, ping.ResponseStatus)
+	assert.Len(t, pings, 1)
+	assert.Equal(t, webhook.Ping, pings[0].Header.Get(webhook.HeaderEvent))
+	assert.Equal(t, ping.ID, pings[0].Header.Get(webhook.HeaderDelivery))
+
+	deliveries, err = svc.GetWebhookDeliveries(ctx, store.ID, hook.ID)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 3)
+
+	endpoint.Close()
+	ping, err = svc.PingWebhook(ctx, store.ID, hook.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, domain.DeliveryDead, ping.Status)
+	assert.Equal(t, "não foi possível conectar ao webhook", ping.LastError)
+
+	// Webhooks of other stores are not found
+	other, err := svc.Create(ctx, "Madero", "owner2")
+	assert.Nil(t, err)
+	_, err = svc.PingWebhook(ctx, other.ID, hook.ID)
+	assert.Equal(t, repository.ErrNotFoundWebhook, err)
+	assert.Equal(t, repository.ErrNotFoundWebhook, svc.RemoveWebhook(ctx, other.ID, hook.ID))
+
+	hooks, err := svc.ListWebhooks(ctx, store.ID)
+	assert.Nil(t, err)
+	assert.Len(t, hooks, 1)
+
+	assert.Nil(t, svc.RemoveWebhook(ctx, store.ID, hook.ID))
+	_, err = svc.GetWebhookDeliveries(ctx, store.ID, hook.ID)
+	assert.Equal(t, repository.ErrNotFoundWebhook, err)
+}
+
+// inTransaction marks the context of the operations run by recordingTransactor
+type inTransaction struct{}
+
+// recordingTransactor runs the operations with a marked context
+type recordingTransactor struct{}
+
+func (recordingTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(context.WithValue(ctx, inTransaction{}, true))
+}
+
+// checkedWebhookRepository fails writing deliveries outside a transaction,
+// or always when fail is set
+type checkedWebhookRepository struct {
+	repository.WebhookRepository
+	fail bool
+}
+
+func (r *checkedWebhookRepository) EnqueueDeliveries(ctx context.Context, deliveries ...*domain.WebhookDelivery) error {
+	if ctx.Value(inTransaction{}) == nil {
+		return errors.New("deliveries written outside the transaction")
+	}
+	if r.fail {
+		return errors.New("connection refused")
+	}
+	return r.WebhookRepository.EnqueueDeliveries(ctx, deliveries...)
+}
+
+// RemoveByStore fails outside a transaction, like EnqueueDeliveries
+func (r *checkedWebhookRepository) RemoveByStore(ctx context.Context, storeID string) error {
+	if ctx.Value(inTransaction{}) == nil {
+		return errors.New("webhooks removed outside the transaction")
+	}
+	return r.WebhookRepository.RemoveByStore(ctx, storeID)
+}
+
+func TestRemoveStoreCascade(t *testing.T) {
+
+	ctx := context.Background()
+	outboxRepository := repository.NewOutboxMockRepository()
+	hooks := &checkedWebhookRepository{WebhookRepository: repository.NewWebhookMockRepository()}
+	svc := newStoreService(repository.NewStoreMockRepository(), event.NewHub(), mockBaseURL, metrics.New(), outboxRepository, recordingTransactor{}, defaultNearFront, hooks, webhook.NewClient(time.Second, true))
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+	assert.Nil(t, err)
+	kept, err := svc.Create(ctx, "Madero", "owner1")
+	assert.Nil(t, err)
+
+	hook, err := svc.CreateWebhook(ctx, store.ID, "https://pos.example.com/hooks", []string{event.ConsumerJoined})
+	assert.Nil(t, err)
+	keptHook, err := svc.CreateWebhook(ctx, kept.ID, "https://pos.example.com/hooks", []string{event.ConsumerJoined})
+	assert.Nil(t, err)
+
+	consumer := joinQueue(t, svc, store.ID, "Ana", "011911111111")
+	keptConsumer := joinQueue(t, svc, kept.ID, "Bia", "011922222222")
+
+	assert.Nil(t, svc.RemoveStore(ctx, store.ID))
+
+	messages, err := outboxRepository.ListByConsumer(ctx, store.ID, consumer)
+	assert.Nil(t, err)
+	assert.Empty(t, messages)
+	_, err = hooks.GetWebhook(ctx, store.ID, hook.ID)
+	assert.Equal(t, repository.ErrNotFoundWebhook, err)
+	deliveries, err := hooks.ListDeliveries(ctx, store.ID, hook.ID, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, deliveries)
+
+	// Other stores keep theirs
+	messages, err = outboxRepository.ListByConsumer(ctx, kept.ID, keptConsumer)
+	assert.Nil(t, err)
+	assert.Len(t, messages, 1)
+	deliveries, err = hooks.ListDeliveries(ctx, kept.ID, keptHook.ID, 10)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 1)
+
+	assert.Equal(t, repository.ErrNotFoundStore, svc.RemoveStore(ctx, store.ID))
+}
+
+func TestQueueLengthMetric(t *testing.T) {
+
+	ctx := context.Background()
+	m := metrics.New()
+	svc := newStoreService(repository.NewStoreMockRepository(), event.NewHub(), mockBaseURL, m, repository.NewOutboxMockRepository(), repository.NewTransactorMock(), defaultNearFront, repository.NewWebhookMockRepository(), webhook.NewClient(time.Second, false))
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+	assert.Nil(t, err)
+	other, err := svc.Create(ctx, "Jeronimo", "owner1")
+	assert.Nil(t, err)
+
+	joinQueue(t, svc, store.ID, "Ana", "011911111111")
+	joinQueue(t, svc, store.ID, "Bia", "011922222222")
+	joinQueue(t, svc, store.ID, "Caio", "011933333333")
+	joinQueue(t, svc, other.ID, "Davi", "011944444444")
+
+	_, err = svc.CallNext(ctx, store.ID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+
+	// The gauge counts the waiting consumers of each store in the repository
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, w.Body.String(), fmt.Sprintf(`filas_queue_length{store="%s"} 2`, store.ID))
+	assert.Contains(t, w.Body.String(), fmt.Sprintf(`filas_queue_length{store="%s"} 1`, other.ID))
+}
+
+func TestAssignOwner(t *testing.T) {
+
+	ctx := context.Background()
+	repo := repository.NewStoreMockRepository()
+	svc := newStoreService(repo, event.NewHub(), mockBaseURL, metrics.New(), repository.NewOutboxMockRepository(), repository.NewTransactorMock(), defaultNearFront, repository.NewWebhookMockRepository(), webhook.NewClient(time.Second, false))
+
+	// Created before stores had an owner
+	legacy, err := repo.Create(ctx, &domain.Store{Name: "Outback", Slug: "outback"})
+	assert.Nil(t, err)
+	assert.False(t, legacy.IsManagedBy("owner1"))
+
+	assert.Equal(t, ErrArgumentNotValidAssignOwner, svc.AssignOwner(ctx, legacy.ID, ""))
+	assert.Equal(t, repository.ErrNotFoundStore, svc.AssignOwner(ctx, "unknown", "owner1"))
+
+	assert.Nil(t, svc.AssignOwner(ctx, legacy.ID, "owner1"))
+	store, err := svc.GetStoreByID(ctx, legacy.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "owner1", store.OwnerID)
+	assert.True(t, store.IsManagedBy("owner1"))
+
+	// An owner is never replaced
+	assert.Equal(t, repository.ErrStoreHasOwner, svc.AssignOwner(ctx, legacy.ID, "owner2"))
+	owned, err := svc.Create(ctx, "Jeronimo", "owner2")
+	assert.Nil(t, err)
+	assert.Equal(t, repository.ErrStoreHasOwner, svc.AssignOwner(ctx, owned.ID, "owner1"))
+}
+
+func TestWebhookAddresses(t *testing.T) {
+
+	ctx := context.Background()
+	svc := newStoreService(repository.NewStoreMockRepository(), event.NewHub(), mockBaseURL, metrics.New(), repository.NewOutboxMockRepository(), repository.NewTransactorMock(), defaultNearFront, repository.NewWebhookMockRepository(), webhook.NewClient(time.Second, false))
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+	assert.Nil(t, err)
+
+	events := []string{event.ConsumerJoined}
+	for _, url := range []string{
+		"http://127.0.0.1:8080/hooks",
+		"http://localhost/hooks",
+		"http://169.254.169.254/latest/meta-data",
+		"https://10.0.0.8/hooks",
+		"http://[::1]:9000/hooks",
+	} {
+		_, err := svc.CreateWebhook(ctx, store.ID, url, events)
+		assert.Equal(t, ErrWebhookAddressNotAllowed, err, url)
+	}
+
+	hook, err := svc.CreateWebhook(ctx, store.ID, "https://93.184.216.34/hooks", events)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, hook.ID)
+}
+
+func TestWebhookDeliveriesInTransaction(t *testing.T) {
+
+	ctx := context.Background()
+	hooks := &checkedWebhookRepository{WebhookRepository: repository.NewWebhookMockRepository()}
+	svc := newStoreService(repository.NewStoreMockRepository(), event.NewHub(), mockBaseURL, metrics.New(), repository.NewOutboxMockRepository(), recordingTransactor{}, defaultNearFront, hooks, webhook.NewClient(time.Second, true))
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+	assert.Nil(t, err)
+
+	hook, err := svc.CreateWebhook(ctx, store.ID, "https://pos.example.com/hooks", []string{
+		event.ConsumerJoined, event.ConsumerCalled, event.ConsumerServed, event.ConsumerNoShow, event.ConsumerCancelled, event.StorePaused,
+	})
+	assert.Nil(t, err)
+
+	first := joinQueue(t, svc, store.ID, "Ana", "011911111111")
+	second := joinQueue(t, svc, store.ID, "Bia", "011922222222")
+	third := joinQueue(t, svc, store.ID, "Caio", "011933333333")
+
+	_, err = svc.CallNext(ctx, store.ID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+	assert.Nil(t, svc.Serve(ctx, store.ID, domain.DefaultQueueID, first))
+	_, err = svc.CallNext(ctx, store.ID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+	assert.Nil(t, svc.NoShow(ctx, store.ID, domain.DefaultQueueID, second))
+	assert.Nil(t, svc.RemoveConsumer(ctx, store.ID, domain.DefaultQueueID, third))
+	_, err = svc.SetQueueMode(ctx, store.ID, domain.ModePaused, nil)
+	assert.Nil(t, err)
+
+	deliveries, err := svc.GetWebhookDeliveries(ctx, store.ID, hook.ID)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 9)
+
+	// A delivery that cannot be written fails the change, which is not published
+	_, err = svc.SetQueueMode(ctx, store.ID, domain.ModeAuto, nil)
+	assert.Nil(t, err)
+
+	events, cancel := svc.Subscribe(store.ID)
+	defer cancel()
+
+	hooks.fail = true
+	_, err = svc.AddConsumer(ctx, store.ID, domain.DefaultQueueID, "Davi", "011944444444", 1, domain.StatusWaiting)
+	assert.NotNil(t, err)
+	assert.Len(t, events, 0)
+}
+
+// staleStores returns the store as it was read once, like a join that read
+// it just before an update
+type staleStores struct {
+	repository.StoreRepository
+	stale *domain.Store
+}
+
+func (r *staleStores) GetStoreByID(ctx context.Context, id string) (*domain.Store, error) {
+	if r.stale != nil {
+		return r.stale, nil
+	}
+	return r.StoreRepository.GetStoreByID(ctx, id)
+}
+
+// UpdateStore fails outside a transaction, so the store is read and saved
+// together
+func (r *staleStores) UpdateStore(ctx context.Context, store *domain.Store) (*domain.Store, error) {
+	if ctx.Value(inTransaction{}) == nil {
+		return nil, errors.New("store updated outside the transaction")
+	}
+	return r.StoreRepository.UpdateStore(ctx, store)
+}
+
+func TestQueueRemovedWhileJoining(t *testing.T) {
+
+	ctx := context.Background()
+	repo := &staleStores{StoreRepository: repository.NewStoreMockRepository()}
+	svc := newStoreService(repo, event.NewHub(), mockBaseURL, metrics.New(), repository.NewOutboxMockRepository(), recordingTransactor{}, defaultNearFront, repository.NewWebhookMockRepository(), webhook.NewClient(time.Second, false))
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+	assert.Nil(t, err)
+	store, err = svc.UpdateStore(ctx, store.ID, domain.StoreUpdate{Queues: []domain.Queue{
+		{ID: domain.DefaultQueueID, Name: "Mesas"},
+		{Name: "Caixa"},
+	}})
+	assert.Nil(t, err)
+
+	stale, err := repo.GetStoreByID(ctx, store.ID)
+	assert.Nil(t, err)
+
+	_, err = svc.UpdateStore(ctx, store.ID, domain.StoreUpdate{Version: store.Version, Queues: []domain.Queue{{ID: domain.DefaultQueueID, Name: "Mesas"}}})
+	assert.Nil(t, err)
+
+	// The join read the store while it still had the cashier queue
+	repo.stale = stale
+	_, err = svc.AddConsumer(ctx, store.ID, "caixa", "Ana", "011911111111", 1, domain.StatusWaiting)
+	assert.Equal(t, ErrNotFoundQueue, err)
+	repo.stale = nil
+
+	consumers, err := repo.GetAllConsumers(ctx, store.ID, "caixa")
+	assert.Nil(t, err)
+	assert.Empty(t, consumers)
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/phone"
+	"github.com/rokoga/filas-backend/repository"
+	"github.com/rokoga/filas-backend/slug"
+)
+
+// updateStore applies the changes on top of the stored profile and saves it
+// if nobody changed the store since update.Version was read. A new name
+// gets a new slug, and the old one is kept in PreviousSlugs so links
+// already shared still reach the store. url builds the public URL from the
+// slug.
+// The store is read and saved in one transaction, so a queue is never
+// removed while a consumer joins it: the join writes the store too and one
+// of them is retried.
+func updateStore(ctx context.Context, repo repository.StoreRepository, transactor repository.Transactor, id string, update domain.StoreUpdate, url func(string) string) (*domain.Store, error) {
+
+	if id == "" {
+		return nil, ErrArgumentNotValidUpdateStore
+	}
+
+	if update.Contact != nil && update.Contact.Phone != "" {
+		contact := *update.Contact
+		normalizedPhone, err := phone.Normalize(contact.Phone)
+		if err != nil {
+			return nil, err
+		}
+		contact.Phone = normalizedPhone
+		update.Contact = &contact
+	}
+
+	// Each attempt in its own transaction, a duplicate slug aborts it
+	for attempt := 1; attempt <= slug.MaxAttempts; attempt++ {
+		var updated *domain.Store
+		var renamed bool
+
+		err := transactor.WithTransaction(ctx, func(ctx context.Context) error {
+			var err error
+			updated, renamed, err = saveUpdate(ctx, repo, id, update, url, attempt)
+			return err
+		})
+		if renamed && errors.Is(err, repository.ErrSlugExists) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return withQueueState(updated, time.Now()), nil
+	}
+
+	return nil, repository.ErrSlugExists
+}
+
+// saveUpdate reads the store, applies the update and saves it. When the
+// name changes the slug takes the suffix of attempt and renamed is true.
+func saveUpdate(ctx context.Context, repo repository.StoreRepository, id string, update domain.StoreUpdate, url func(string) string, attempt int) (updated *domain.Store, renamed bool, err error) {
+
+	current, err := repo.GetStoreByID(ctx, id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	store, err := update.Apply(*current)
+	if err != nil {
+		return nil, false, err
+	}
+	store.Version = update.Version
+
+	base := slug.Make(store.Name)
+	if base == "" {
+		return nil, false, ErrArgumentNotValidUpdateStore
+	}
+
+	if base == slug.Make(current.Name) || base == current.Slug {
+		updated, err = repo.UpdateStore(ctx, store)
+		return updated, false, err
+	}
+
+	storeSlug := slug.WithSuffix(base, attempt)
+	store.Slug = storeSlug
+	store.URLName = url(storeSlug)
+	store.PreviousSlugs = previousSlugs(current, storeSlug)
+
+	updated, err = repo.UpdateStore(ctx, store)
+	return updated, true, err
+}
+
+// previousSlugs adds the current slug of the store to the ones it had
+// before, leaving out storeSlug in case the store takes an old slug back
+func previousSlugs(store *domain.Store, storeSlug string) []string {
+	var result []string
+	for _, previous := range store.PreviousSlugs {
+		if previous != storeSlug {
+			result = append(result, previous)
+		}
+	}
+	if store.Slug != "" && store.Slug != storeSlug {
+		result = append(result, store.Slug)
+	}
+	return result
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/event"
+	"github.com/rokoga/filas-backend/repository"
+	"github.com/rokoga/filas-backend/webhook"
+)
+
+const (
+	// webhookSecretBytes gives 256 bits of entropy, 64 hex characters
+	webhookSecretBytes = 32
+	// webhookDeliveryLimit is how many deliveries the log of a webhook shows
+	webhookDeliveryLimit = 50
+)
+
+// webhooks writes a delivery of every queue event to the webhooks of the
+// store subscribed to it, where the webhook worker posts them from. Called
+// within the transaction of the queue change, the deliveries are stored with
+// it.
+type webhooks struct {
+	repo   repository.WebhookRepository
+	sender webhook.Sender
+}
+
+// dispatch writes the deliveries of the event
+func (w *webhooks) dispatch(ctx context.Context, e event.Event) error {
+	hooks, err := w.repo.ListWebhooks(ctx, e.StoreID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+
+	deliveries := []*domain.WebhookDelivery{}
+	for _, hook := range hooks {
+		if !hook.Subscribed(e.Type) {
+			continue
+		}
+
+		delivery, err := newDelivery(hook, e, now)
+		if err != nil {
+			return err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return w.repo.EnqueueDeliveries(ctx, deliveries...)
+}
+
+// create registers an endpoint of the store with a new secret. url must be
+// absolute http(s), resolve to addresses the sender may reach, and events
+// published by the service.
+func (w *webhooks) create(ctx context.Context, stores repository.StoreRepository, id, rawURL string, events []string) (*domain.Webhook, error) {
+
+	if id == "" || len(events) == 0 {
+		return nil, ErrArgumentNotValidWebhook
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return nil, ErrArgumentNotValidWebhook
+	}
+
+	// Checked again on every connection, the host may resolve elsewhere later
+	if err := w.sender.CheckHost(ctx, u.Hostname()); err != nil {
+		if errors.Is(err, webhook.ErrForbiddenAddress) {
+			return nil, ErrWebhookAddressNotAllowed
+		}
+		return nil, ErrArgumentNotValidWebhook
+	}
+
+	seen := map[string]bool{}
+	for _, eventType := range events {
+		if !event.Valid(eventType) || seen[eventType] {
+			return nil, ErrArgumentNotValidWebhook
+		}
+		seen[eventType] = true
+	}
+
+	if _, err := stores.GetStoreByID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	hook := &domain.Webhook{
+		StoreID:   id,
+		URL:       rawURL,
+		Events:    events,
+		Secret:    secret,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err := w.repo.CreateWebhook(ctx, hook); err != nil {
+		return nil, err
+	}
+
+	return hook, nil
+}
+
+// ping posts a test event to the webhook right away and logs the outcome. A
+// failed ping is not retried, it is returned dead with the reason.
+func (w *webhooks) ping(ctx context.Context, id, webhookID string) (*domain.WebhookDelivery, error) {
+
+	if id == "" || webhookID == "" {
+		return nil, ErrArgumentNotValidWebhook
+	}
+
+	hook, err := w.repo.GetWebhook(ctx, id, webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	delivery, err := newDelivery(hook, event.Event{Type: webhook.Ping, StoreID: id, OccurredAt: now}, now)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := w.sender.Send(ctx, hook, delivery)
+
+	delivery.Attempts = 1
+	delivery.ResponseStatus = status
+	if err != nil {
+		delivery.Status = domain.DeliveryDead
+		delivery.LastError = webhook.FailureReason(status, err)
+	} else {
+		delivery.Status = domain.DeliverySent
+		delivery.DeliveredAt = &now
+	}
+
+	if err := w.repo.EnqueueDeliveries(ctx, delivery); err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+// deliveries returns the log of the webhook, the newest first
+func (w *webhooks) deliveries(ctx context.Context, id, webhookID string) ([]*domain.WebhookDelivery, error) {
+
+	if id == "" || webhookID == "" {
+		return nil, ErrArgumentNotValidWebhook
+	}
+
+	if _, err := w.repo.GetWebhook(ctx, id, webhookID); err != nil {
+		return nil, err
+	}
+
+	return w.repo.ListDeliveries(ctx, id, webhookID, webhookDeliveryLimit)
+}
+
+// newDelivery renders the payload of the event for the webhook. The
+// delivery ID is part of the payload, so it is chosen here.
+func newDelivery(hook *domain.Webhook, e event.Event, now time.Time) (*domain.WebhookDelivery, error) {
+	id := primitive.NewObjectID().Hex()
+
+	payload, err := json.Marshal(webhook.Payload{
+		ID:         id,
+		Type:       e.Type,
+		StoreID:    e.StoreID,
+		QueueID:    e.QueueID,
+		ConsumerID: e.ConsumerID,
+		OccurredAt: e.OccurredAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.WebhookDelivery{
+		ID:            id,
+		WebhookID:     hook.ID,
+		StoreID:       hook.StoreID,
+		Event:         e.Type,
+		Payload:       string(payload),
+		Status:        domain.DeliveryPending,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	}, nil
+}
+
+// newWebhookSecret returns a random key to sign the payloads with
+func newWebhookSecret() (string, error) {
+	b := make([]byte, webhookSecretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
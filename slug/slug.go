@@ -0,0 +1,83 @@
+package slug
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// maxLength keeps slugs short enough for links sent by SMS
+	maxLength = 60
+	// MaxAttempts bounds the suffixes tried when a slug is already in use
+	MaxAttempts = 20
+)
+
+// transliterations spell precomposed accented letters and ligatures in ASCII
+var transliterations = map[rune]string{
+	'á': "a", 'à': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a",
+	'ç': "c",
+	'é': "e", 'è': "e", 'ê': "e", 'ë': "e",
+	'í': "i", 'ì': "i", 'î': "i", 'ï': "i",
+	'ñ': "n",
+	'ó': "o", 'ò': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o",
+	'ú': "u", 'ù': "u", 'û': "u", 'ü': "u",
+	'ý': "y", 'ÿ': "y",
+	'ß': "ss", 'æ': "ae", 'œ': "oe",
+}
+
+// symbols read as a word of their own, so they are kept apart from the
+// words around them
+var symbols = map[rune]string{
+	'&': "e",
+}
+
+// Make returns the URL-safe form of a store name, e.g. "Pão de Açúcar"
+// becomes "pao-de-acucar". Accented letters are transliterated, "&" becomes
+// the word "e" and any other character separates words. It returns "" when nothing is left.
+func Make(name string) string {
+	var b strings.Builder
+	pending := false
+
+	for _, r := range strings.ToLower(name) {
+		if symbol, ok := symbols[r]; ok {
+			if b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteString(symbol)
+			pending = true
+			continue
+		}
+
+		word := transliterations[r]
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			word = string(r)
+		}
+
+		if word == "" {
+			pending = b.Len() > 0
+			continue
+		}
+		if pending {
+			b.WriteByte('-')
+			pending = false
+		}
+		b.WriteString(word)
+	}
+
+	result := b.String()
+	if len(result) > maxLength {
+		result = strings.TrimRight(result[:maxLength], "-")
+	}
+
+	return result
+}
+
+// WithSuffix returns the candidate slug for the given attempt: the slug
+// itself on the first one and "slug-2", "slug-3"... after collisions.
+func WithSuffix(slug string, attempt int) string {
+	if attempt <= 1 {
+		return slug
+	}
+	return slug + "-" + strconv.Itoa(attempt)
+}
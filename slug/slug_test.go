@@ -0,0 +1,39 @@
+package slug
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMake(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		result string
+	}{
+		{name: "Outback", result: "outback"},
+		{name: "Pão de Açúcar", result: "pao-de-acucar"},
+		{name: "  Bar do Zé  ", result: "bar-do-ze"},
+		{name: "Café & Cia.", result: "cafe-e-cia"},
+		{name: "A&B", result: "a-e-b"},
+		{name: "&Cia", result: "e-cia"},
+		{name: "Padaria 24h -- Centro", result: "padaria-24h-centro"},
+		{name: "Straße", result: "strasse"},
+		{name: "日本", result: ""},
+		{name: "", result: ""},
+		{name: strings.Repeat("a", 59) + " b", result: strings.Repeat("a", 59)},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.result, Make(test.name), test.name)
+	}
+}
+
+func TestWithSuffix(t *testing.T) {
+
+	assert.Equal(t, "outback", WithSuffix("outback", 1))
+	assert.Equal(t, "outback-2", WithSuffix("outback", 2))
+	assert.Equal(t, "outback-10", WithSuffix("outback", 10))
+}
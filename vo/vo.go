@@ -1,13 +1,90 @@
 package vo
 
+import (
+	"time"
+
+	"github.com/rokoga/filas-backend/domain"
+)
+
 // CreateRequest struct
 type CreateRequest struct {
 	Name string `json:"name"`
 }
 
+// ListStoresRequest struct
+type ListStoresRequest struct {
+	Search string `form:"q"`
+	Sort   string `form:"sort"`
+	Limit  int    `form:"limit"`
+	Offset int    `form:"offset"`
+}
+
 // AddConsumerRequest struct
+// PartySize counts the consumer, one when left out. QueueID is the queue
+// joined, the default one when left out.
 type AddConsumerRequest struct {
-	StoreID string `json:"storeId"`
-	Name    string `json:"name"`
-	Phone   string `json:"phone"`
+	StoreID   string `json:"storeId"`
+	QueueID   string `json:"queueId"`
+	Name      string `json:"name"`
+	Phone     string `json:"phone"`
+	PartySize int    `json:"partySize"`
+}
+
+// RegisterRequest struct
+type RegisterRequest struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// LoginRequest struct
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// AddStaffRequest struct
+type AddStaffRequest struct {
+	Email string `json:"email"`
+}
+
+// AssignOwnerRequest struct
+type AssignOwnerRequest struct {
+	Email string `json:"email"`
+}
+
+// UpdateStoreRequest struct
+// Fields left out are kept as they are. Version is the version of the store
+// the changes were made on.
+type UpdateStoreRequest struct {
+	Version      int64                 `json:"version"`
+	Name         *string               `json:"name"`
+	Contact      *domain.Contact       `json:"contact"`
+	Address      *domain.Address       `json:"address"`
+	LogoURL      *string               `json:"logoUrl"`
+	OpeningHours *domain.OpeningHours  `json:"openingHours"`
+	Settings     *domain.QueueSettings `json:"settings"`
+	// Queues replace the queues of the store, new ones are sent without ID
+	Queues []domain.Queue `json:"queues"`
+	// MessageTemplates by kind, an empty template restores the default
+	MessageTemplates map[domain.NotificationKind]string `json:"messageTemplates"`
+}
+
+// SetQueueModeRequest struct
+type SetQueueModeRequest struct {
+	Mode  domain.QueueMode `json:"mode"`
+	Until *time.Time       `json:"until"`
+}
+
+// CreateWebhookRequest struct
+// Events are the event types posted to URL, such as consumer.joined.
+type CreateWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+// CallTableRequest struct
+// Capacity is how many seats the table that became free has.
+type CallTableRequest struct {
+	Capacity int `json:"capacity"`
 }
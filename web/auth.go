@@ -0,0 +1,96 @@
+package web
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/service"
+)
+
+// userKey is the gin context key holding the authenticated *domain.User
+const userKey = "user"
+
+// authenticate requires a valid staff token, sent as a bearer token or, for
+// EventSource clients that cannot set headers, as the access_token query
+func authenticate(authSvc service.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" {
+			token = c.Query("access_token")
+		}
+
+		user, err := authSvc.Authenticate(c.Request.Context(), token)
+		if err != nil {
+			c.Error(err)
+			c.Abort()
+			return
+		}
+
+		c.Set(userKey, user)
+		c.Next()
+	}
+}
+
+// authorizeStore requires the authenticated user to manage the store named by
+// the route parameter, or to own it when ownerOnly is set
+func authorizeStore(svc service.StoreService, param string, ownerOnly bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store, err := svc.GetStoreByID(c.Request.Context(), c.Param(param))
+		if err != nil {
+			c.Error(err)
+			c.Abort()
+			return
+		}
+
+		user := currentUser(c)
+		allowed := store.IsManagedBy(user.ID)
+		if ownerOnly {
+			allowed = store.OwnerID == user.ID
+		}
+
+		if !allowed {
+			if store.OwnerID == "" {
+				c.Error(service.ErrStoreWithoutOwner)
+			} else {
+				c.Error(service.ErrForbidden)
+			}
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// admin requires the authenticated user to be one of the configured admins
+func admin(adminIDs []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := currentUser(c)
+		for _, id := range adminIDs {
+			if id == user.ID {
+				c.Next()
+				return
+			}
+		}
+
+		c.Error(service.ErrForbidden)
+		c.Abort()
+	}
+}
+
+// currentUser returns the user set by authenticate
+func currentUser(c *gin.Context) *domain.User {
+	return c.MustGet(userKey).(*domain.User)
+}
+
+// publicStore hides the queue, the accounts managing a store and its message
+// templates from anonymous callers
+func publicStore(store *domain.Store) *domain.Store {
+	public := *store
+	public.Queue = nil
+	public.OwnerID = ""
+	public.Staff = nil
+	public.MessageTemplates = nil
+	return &public
+}
@@ -0,0 +1,116 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rokoga/filas-backend/auth"
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/service"
+	"github.com/stretchr/testify/assert"
+)
+
+// ownerlessStores serves the stores as created before they had an owner
+type ownerlessStores struct {
+	service.StoreService
+}
+
+func (s ownerlessStores) GetStoreByID(ctx context.Context, id string) (*domain.Store, error) {
+	store, err := s.StoreService.GetStoreByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	legacy := *store
+	legacy.OwnerID = ""
+	return &legacy, nil
+}
+
+func TestAuthorization(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+
+	ctx := context.Background()
+	svc := service.NewStoreMockServiceImpl()
+	authSvc := service.NewAuthMockServiceImpl(auth.NewTokenManager([]byte("secret"), time.Hour))
+
+	owner, err := authSvc.Register(ctx, "Dono", "dono@outback.com", "senha-segura")
+	assert.Nil(t, err)
+	root, err := authSvc.Register(ctx, "Admin", "admin@filas.com", "senha-segura")
+	assert.Nil(t, err)
+
+	store, err := svc.Create(ctx, "Outback", owner.ID)
+	assert.Nil(t, err)
+
+	ownerToken, err := authSvc.Login(ctx, "dono@outback.com", "senha-segura")
+	assert.Nil(t, err)
+	adminToken, err := authSvc.Login(ctx, "admin@filas.com", "senha-segura")
+	assert.Nil(t, err)
+
+	ok := func(c *gin.Context) {
+		c.JSON(200, nil)
+	}
+
+	router := gin.New()
+	router.Use(errorHandler())
+	router.GET("/legacy/:storeid", authenticate(authSvc), authorizeStore(ownerlessStores{svc}, "storeid", false), ok)
+	router.POST("/store/:storeid/owner", authenticate(authSvc), admin([]string{root.ID}), ok)
+
+	tests := []struct {
+		method string
+		path   string
+		token  string
+		status int
+		code   string
+	}{
+		// Nobody manages a store without an owner, not even who created it
+		{method: http.MethodGet, path: "/legacy/" + store.ID, token: ownerToken, status: http.StatusForbidden, code: "store_without_owner"},
+		{method: http.MethodPost, path: "/store/" + store.ID + "/owner", token: adminToken, status: http.StatusOK},
+		{method: http.MethodPost, path: "/store/" + store.ID + "/owner", token: ownerToken, status: http.StatusForbidden, code: "forbidden"},
+		{method: http.MethodPost, path: "/store/" + store.ID + "/owner", token: "", status: http.StatusUnauthorized, code: "unauthenticated"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		if test.token != "" {
+			req.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, test.status, w.Code, test.path)
+		if test.code != "" {
+			var body map[string]string
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, test.code, body["code"])
+		}
+	}
+}
+
+func TestPublicStore(t *testing.T) {
+
+	store := &domain.Store{
+		ID:               "1",
+		Name:             "Outback",
+		OwnerID:          "owner1",
+		Staff:            []string{"staff1"},
+		Queue:            []*domain.Consumer{{ID: "c1", Name: "Ana"}},
+		MessageTemplates: map[domain.NotificationKind]string{domain.NotifyCalled: "{{.Name}}, sua vez"},
+	}
+
+	body, err := json.Marshal(publicStore(store))
+	assert.Nil(t, err)
+	for _, hidden := range []string{"ownerId", "owner1", "staff1", "Ana", "messageTemplates"} {
+		assert.NotContains(t, string(body), hidden)
+	}
+	assert.Contains(t, string(body), "Outback")
+
+	// The store itself is left as it was
+	assert.Equal(t, "owner1", store.OwnerID)
+	assert.Len(t, store.MessageTemplates, 1)
+}
@@ -0,0 +1,88 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rokoga/filas-backend/apperror"
+	"github.com/rokoga/filas-backend/logging"
+)
+
+const (
+	// ErrorInvalidBody for request bodies that cannot be decoded
+	ErrorInvalidBody = "Corpo da requisição inválido"
+	// ErrorInvalidQuery for query strings that cannot be decoded
+	ErrorInvalidQuery = "Parâmetros da consulta inválidos"
+	// ErrorInternal for unexpected failures, whose details are not exposed
+	ErrorInternal = "Erro interno no servidor"
+)
+
+var (
+	// ErrInvalidBody for request bodies that cannot be decoded
+	ErrInvalidBody = apperror.New(apperror.InvalidArgument, "invalid_body", ErrorInvalidBody)
+	// ErrInvalidQuery for query strings that cannot be decoded
+	ErrInvalidQuery = apperror.New(apperror.InvalidArgument, "invalid_query", ErrorInvalidQuery)
+	// ErrInternal for unexpected failures, whose details are not exposed
+	ErrInternal = apperror.New(apperror.Internal, "internal", ErrorInternal)
+)
+
+var statusByKind = map[apperror.Kind]int{
+	apperror.Internal:        http.StatusInternalServerError,
+	apperror.InvalidArgument: http.StatusUnprocessableEntity,
+	apperror.NotFound:        http.StatusNotFound,
+	apperror.AlreadyExists:   http.StatusConflict,
+	apperror.Conflict:        http.StatusConflict,
+	apperror.Unauthenticated: http.StatusUnauthorized,
+	apperror.Forbidden:       http.StatusForbidden,
+}
+
+// errorHandler answers with the last error added through c.Error when the
+// handler did not write a response
+func errorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		err := c.Errors.Last().Err
+		status, body := errorResponse(err)
+		if status >= http.StatusInternalServerError {
+			// The details are hidden from the client, keep them in the log
+			logging.FromContext(c.Request.Context()).WithError(err).Error("request failed")
+		}
+
+		c.JSON(status, body)
+	}
+}
+
+// errorResponse maps an error to its HTTP status and JSON body. Errors
+// without an application code are reported as internal errors.
+func errorResponse(err error) (int, gin.H) {
+	appErr := apperror.As(err)
+	if appErr == nil {
+		appErr, err = ErrInternal, ErrInternal
+	}
+
+	body := gin.H{
+		"code":  appErr.Code,
+		"error": err.Error(),
+	}
+
+	var detailed detailedError
+	if errors.As(err, &detailed) {
+		for key, value := range detailed.Details() {
+			body[key] = value
+		}
+	}
+
+	return statusByKind[appErr.Kind], body
+}
+
+// detailedError is implemented by errors carrying fields the client can act
+// on, such as when a closed queue opens again
+type detailedError interface {
+	Details() map[string]interface{}
+}
@@ -0,0 +1,123 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rokoga/filas-backend/auth"
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/repository"
+	"github.com/rokoga/filas-backend/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorResponse(t *testing.T) {
+
+	tests := []struct {
+		err     error
+		status  int
+		code    string
+		message string
+	}{
+		{err: service.ErrArgumentNotValidAddStore, status: http.StatusUnprocessableEntity, code: "invalid_add_store_arguments", message: service.ErrorArgumentNotValidAddStore},
+		{err: repository.ErrNotFoundStore, status: http.StatusNotFound, code: "store_not_found", message: repository.ErrorNotFoundStore},
+		{err: fmt.Errorf("GetStore: %w", repository.ErrNotFoundStore), status: http.StatusNotFound, code: "store_not_found", message: "GetStore: " + repository.ErrorNotFoundStore},
+		{err: service.ErrStoreExists, status: http.StatusConflict, code: "store_exists", message: service.ErrorStoreExists},
+		{err: &domain.TransitionError{From: domain.StatusServed, To: domain.StatusCancelled}, status: http.StatusConflict, code: "illegal_status_transition", message: (&domain.TransitionError{From: domain.StatusServed, To: domain.StatusCancelled}).Error()},
+		{err: repository.ErrConsumerStatusChanged, status: http.StatusConflict, code: "consumer_status_changed", message: repository.ErrorConsumerStatusChanged},
+		{err: service.ErrUnauthenticated, status: http.StatusUnauthorized, code: "unauthenticated", message: service.ErrorUnauthenticated},
+		{err: service.ErrForbidden, status: http.StatusForbidden, code: "forbidden", message: service.ErrorForbidden},
+		{err: errors.New("server selection error: context deadline exceeded"), status: http.StatusInternalServerError, code: "internal", message: ErrorInternal},
+	}
+
+	for _, test := range tests {
+		status, body := errorResponse(test.err)
+		assert.Equal(t, test.status, status)
+		assert.Equal(t, gin.H{"code": test.code, "error": test.message}, body)
+	}
+
+	next := time.Date(2024, time.January, 8, 9, 0, 0, 0, time.UTC)
+	closed := &domain.QueueClosedError{State: domain.QueueState{Status: domain.QueueClosed, NextOpening: &next}}
+
+	status, body := errorResponse(closed)
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, gin.H{"code": "queue_closed", "error": closed.Error(), "status": domain.QueueClosed, "nextOpening": &next}, body)
+
+}
+
+func TestErrorHandler(t *testing.T) {
+
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	svc := service.NewStoreMockServiceImpl()
+	authSvc := service.NewAuthMockServiceImpl(auth.NewTokenManager([]byte("secret"), time.Hour))
+
+	owner, err := authSvc.Register(ctx, "Dono", "dono@outback.com", "senha-segura")
+	assert.Nil(t, err)
+	_, err = authSvc.Register(ctx, "Outro", "outro@outback.com", "senha-segura")
+	assert.Nil(t, err)
+
+	store, err := svc.Create(ctx, "Outback", owner.ID)
+	assert.Nil(t, err)
+
+	ownerToken, err := authSvc.Login(ctx, "dono@outback.com", "senha-segura")
+	assert.Nil(t, err)
+	otherToken, err := authSvc.Login(ctx, "outro@outback.com", "senha-segura")
+	assert.Nil(t, err)
+
+	router := gin.New()
+	router.Use(errorHandler())
+	router.GET("/consumers/:storeid", authenticate(authSvc), authorizeStore(svc, "storeid", false), func(c *gin.Context) {
+		consumers, err := svc.GetAllConsumers(ctx, c.Param("storeid"), queueParam(c))
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(200, consumers)
+	})
+	router.GET("/fail", func(c *gin.Context) {
+		c.Error(errors.New("connection refused"))
+	})
+
+	tests := []struct {
+		path   string
+		token  string
+		status int
+		code   string
+	}{
+		{path: "/consumers/" + store.ID, token: ownerToken, status: http.StatusOK},
+		{path: "/consumers/" + store.ID, token: "", status: http.StatusUnauthorized, code: "unauthenticated"},
+		{path: "/consumers/" + store.ID, token: otherToken, status: http.StatusForbidden, code: "forbidden"},
+		{path: "/consumers/fakeID", token: ownerToken, status: http.StatusNotFound, code: "store_not_found"},
+		{path: "/consumers/" + store.ID + "?queue=" + domain.DefaultQueueID, token: ownerToken, status: http.StatusOK},
+		{path: "/consumers/" + store.ID + "?queue=cozinha", token: ownerToken, status: http.StatusNotFound, code: "queue_not_found"},
+		{path: "/fail", status: http.StatusInternalServerError, code: "internal"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		if test.token != "" {
+			req.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, test.status, w.Code, test.path)
+		if test.code != "" {
+			var body map[string]string
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, test.code, body["code"])
+			assert.NotEmpty(t, body["error"])
+		}
+	}
+
+}
@@ -0,0 +1,74 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rokoga/filas-backend/logging"
+)
+
+// Version of the build, set with
+// -ldflags "-X github.com/rokoga/filas-backend/web.Version=<version>"
+var Version = "dev"
+
+// health answers the liveness and readiness probes of the orchestrator
+type health struct {
+	started  time.Time
+	ping     func(ctx context.Context) error
+	timeout  time.Duration
+	draining int32
+}
+
+// newHealth uses ping to check the database, bounded by timeout
+func newHealth(ping func(ctx context.Context) error, timeout time.Duration) *health {
+	return &health{
+		started: time.Now(),
+		ping:    ping,
+		timeout: timeout,
+	}
+}
+
+// drain makes readiness fail so no new traffic is routed to the server
+func (h *health) drain() {
+	atomic.StoreInt32(&h.draining, 1)
+}
+
+func (h *health) isDraining() bool {
+	return atomic.LoadInt32(&h.draining) == 1
+}
+
+func (h *health) info(status string) gin.H {
+	return gin.H{
+		"status":  status,
+		"version": Version,
+		"uptime":  time.Since(h.started).Round(time.Second).String(),
+	}
+}
+
+// live answers while the process is able to serve requests
+func (h *health) live(c *gin.Context) {
+	c.JSON(http.StatusOK, h.info("ok"))
+}
+
+// ready answers when the database is reachable and the server is not draining
+func (h *health) ready(c *gin.Context) {
+	if h.isDraining() {
+		c.JSON(http.StatusServiceUnavailable, h.info("draining"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeout)
+	defer cancel()
+
+	// The driver error names hosts and topology, it is only logged
+	if err := h.ping(ctx); err != nil {
+		logging.FromContext(c.Request.Context()).WithError(err).Warn("database not ready")
+		c.JSON(http.StatusServiceUnavailable, h.info("unavailable"))
+		return
+	}
+
+	c.JSON(http.StatusOK, h.info("ok"))
+}
@@ -0,0 +1,108 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		path     string
+		ping     error
+		draining bool
+		status   int
+		result   string
+	}{
+		{name: "live", path: "/healthz", status: http.StatusOK, result: "ok"},
+		{name: "live while draining", path: "/healthz", draining: true, status: http.StatusOK, result: "ok"},
+		{name: "ready", path: "/readyz", status: http.StatusOK, result: "ok"},
+		{name: "database down", path: "/readyz", ping: errors.New("server selection timeout"), status: http.StatusServiceUnavailable, result: "unavailable"},
+		{name: "draining", path: "/readyz", draining: true, status: http.StatusServiceUnavailable, result: "draining"},
+	}
+
+	for _, test := range tests {
+		pingErr := test.ping
+		h := newHealth(func(ctx context.Context) error { return pingErr }, time.Second)
+		if test.draining {
+			h.drain()
+		}
+
+		router := gin.New()
+		router.GET("/healthz", h.live)
+		router.GET("/readyz", h.ready)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+		body := map[string]string{}
+		json.Unmarshal(w.Body.Bytes(), &body)
+
+		assert.Equal(t, test.status, w.Code, test.name)
+		assert.Equal(t, test.result, body["status"], test.name)
+		assert.Equal(t, Version, body["version"], test.name)
+		assert.NotEmpty(t, body["uptime"], test.name)
+	}
+
+}
+
+func TestReadyTimeout(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+
+	h := newHealth(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, 10*time.Millisecond)
+
+	router := gin.New()
+	router.GET("/readyz", h.ready)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestReadyHidesError(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+
+	logger, hook := logtest.NewNullLogger()
+	h := newHealth(func(ctx context.Context) error {
+		return errors.New("server selection error: mongo-0.internal:27017, Type: ReplicaSetNoPrimary")
+	}, time.Second)
+
+	router := gin.New()
+	router.Use(requestLogger(logger))
+	router.GET("/readyz", h.ready)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotContains(t, w.Body.String(), "mongo-0.internal")
+	assert.NotContains(t, w.Body.String(), "error")
+
+	logged := false
+	for _, entry := range hook.AllEntries() {
+		if err, ok := entry.Data[logrus.ErrorKey].(error); ok && strings.Contains(err.Error(), "mongo-0.internal") {
+			logged = true
+		}
+	}
+	assert.True(t, logged)
+}
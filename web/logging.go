@@ -0,0 +1,59 @@
+package web
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rokoga/filas-backend/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// requestIDHeader carries the correlation ID of a request
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID accepts IDs set by a proxy without letting clients forge log lines
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestLogger puts a logger carrying the request ID in the request context
+// and writes one access log line per request. Only the route template is
+// logged, since paths carry access keys.
+func requestLogger(logger *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.GetHeader(requestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = logging.NewRequestID()
+		}
+		c.Header(requestIDHeader, requestID)
+
+		entry := logger.WithField(logging.FieldRequestID, requestID)
+		c.Request = c.Request.WithContext(logging.NewContext(c.Request.Context(), entry))
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		status := c.Writer.Status()
+		fields := logrus.Fields{
+			"method":     c.Request.Method,
+			"route":      route,
+			"status":     status,
+			"latency_ms": time.Since(start).Milliseconds(),
+			"client_ip":  c.ClientIP(),
+		}
+
+		switch {
+		case status >= 500:
+			entry.WithFields(fields).Error("request")
+		case status >= 400:
+			entry.WithFields(fields).Warn("request")
+		default:
+			entry.WithFields(fields).Info("request")
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rokoga/filas-backend/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestLogger(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name      string
+		requestID string
+		reused    bool
+	}{
+		{name: "generated", requestID: ""},
+		{name: "from proxy", requestID: "edge-42", reused: true},
+		{name: "forged", requestID: "a\nlevel=error"},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		logger, _ := logging.New(&out, "info")
+
+		var handlerRequestID string
+		router := gin.New()
+		router.Use(requestLogger(logger))
+		router.GET("/mystore/:storeName/:accessKey", func(c *gin.Context) {
+			handlerRequestID = logging.RequestID(c.Request.Context())
+			c.JSON(http.StatusOK, nil)
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/mystore/outback/Zm9vYmFyYmF6cXV4", nil)
+		if test.requestID != "" {
+			req.Header.Set(requestIDHeader, test.requestID)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		requestID := w.Header().Get(requestIDHeader)
+		assert.Equal(t, requestID, handlerRequestID, test.name)
+		if test.reused {
+			assert.Equal(t, test.requestID, requestID, test.name)
+		} else {
+			assert.Len(t, requestID, 16, test.name)
+		}
+
+		line := map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal(out.Bytes(), &line), test.name)
+		assert.Equal(t, requestID, line[logging.FieldRequestID], test.name)
+		assert.Equal(t, "/mystore/:storeName/:accessKey", line["route"], test.name)
+		assert.Equal(t, float64(http.StatusOK), line["status"], test.name)
+		assert.False(t, strings.Contains(out.String(), "Zm9vYmFyYmF6cXV4"), test.name)
+	}
+
+}
@@ -0,0 +1,43 @@
+package web
+
+import (
+	"crypto/subtle"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rokoga/filas-backend/metrics"
+	"github.com/rokoga/filas-backend/service"
+)
+
+// instrument records the latency and status of every request by route
+// template, so path parameters do not multiply the series
+func instrument(m *metrics.Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		m.ObserveRequest(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+	}
+}
+
+// scraper requires the metrics token as a bearer token. The metrics are
+// labelled by store, so they are not public.
+func scraper(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sent := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+			c.Error(service.ErrUnauthenticated)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
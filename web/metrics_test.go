@@ -0,0 +1,67 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rokoga/filas-backend/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrument(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+
+	m := metrics.New()
+
+	router := gin.New()
+	router.Use(instrument(m))
+	router.GET("/store/id/:id", func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, nil)
+	})
+	router.GET("/metrics", gin.WrapH(m.Handler()))
+
+	for _, path := range []string{"/store/id/1", "/store/id/2", "/nope"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := w.Body.String()
+	assert.True(t, strings.Contains(body, `filas_http_request_duration_seconds_count{method="GET",route="/store/id/:id",status="404"} 2`))
+	assert.True(t, strings.Contains(body, `filas_http_request_duration_seconds_count{method="GET",route="unmatched",status="404"} 1`))
+}
+
+func TestScraper(t *testing.T) {
+
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(errorHandler())
+	router.GET("/metrics", scraper("s3cret"), gin.WrapH(metrics.New().Handler()))
+
+	tests := []struct {
+		header string
+		status int
+	}{
+		{header: "", status: http.StatusUnauthorized},
+		{header: "Bearer wrong", status: http.StatusUnauthorized},
+		{header: "s3cret-and-more", status: http.StatusUnauthorized},
+		{header: "Bearer s3cret", status: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if test.header != "" {
+			req.Header.Set("Authorization", test.header)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, test.status, w.Code, test.header)
+	}
+}
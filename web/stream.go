@@ -0,0 +1,160 @@
+package web
+
+import (
+	"io"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/logging"
+	"github.com/rokoga/filas-backend/service"
+)
+
+// keepAliveInterval keeps idle streams open through proxies
+const keepAliveInterval = 15 * time.Second
+
+// streamStore pushes the waiting consumers of a queue of the store every
+// time the queue changes
+func streamStore(svc service.StoreService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		storeid := c.Param("storeid")
+		queueID := queueParam(c)
+
+		// Subscribe before reading the queue so no change is missed in between
+		events, cancel := svc.Subscribe(storeid)
+		defer cancel()
+
+		consumers, err := svc.GetAllConsumers(c.Request.Context(), storeid, queueID)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		startStream(c)
+		c.SSEvent("queue", consumers)
+		// Sent at once, c.Stream only flushes after the next change
+		c.Writer.Flush()
+
+		keepAlive := time.NewTicker(keepAliveInterval)
+		defer keepAlive.Stop()
+
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case e, ok := <-events:
+				if !ok {
+					return false
+				}
+				if e.QueueID != "" && e.QueueID != queueID {
+					return true
+				}
+
+				consumers, err := svc.GetAllConsumers(c.Request.Context(), storeid, queueID)
+				if err != nil {
+					_, body := errorResponse(err)
+					c.SSEvent("error", body)
+					return false
+				}
+
+				c.SSEvent("queue", consumers)
+				return true
+			case <-keepAlive.C:
+				c.SSEvent("ping", nil)
+				return true
+			case <-c.Request.Context().Done():
+				return false
+			}
+		})
+	}
+}
+
+// streamConsumer pushes the position and status of the access key holder
+// every time the queue changes, until the consumer leaves the queue
+func streamConsumer(svc service.StoreService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accessKey := c.Param("accessKey")
+		storeSlug := c.Param("slug")
+
+		store, err := svc.GetStoreBySlug(c.Request.Context(), storeSlug)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		events, cancel := svc.Subscribe(store.ID)
+		defer cancel()
+
+		position, consumer, err := svc.ValidateConsumer(c.Request.Context(), storeSlug, accessKey)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		startStream(c)
+		c.SSEvent("position", publicConsumerResponse(position, consumer))
+		c.Writer.Flush()
+		if !consumer.Status.Active() {
+			return
+		}
+		queueID := consumer.JoinedQueue()
+
+		keepAlive := time.NewTicker(keepAliveInterval)
+		defer keepAlive.Stop()
+
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case e, ok := <-events:
+				if !ok {
+					return false
+				}
+				// Other queues moving leave the position as it is
+				if e.QueueID != "" && e.QueueID != queueID {
+					return true
+				}
+
+				position, consumer, err := svc.ValidateConsumer(c.Request.Context(), storeSlug, accessKey)
+				if err != nil {
+					_, body := errorResponse(err)
+					c.SSEvent("error", body)
+					return false
+				}
+
+				c.SSEvent("position", publicConsumerResponse(position, consumer))
+				return consumer.Status.Active()
+			case <-keepAlive.C:
+				c.SSEvent("ping", nil)
+				return true
+			case <-c.Request.Context().Done():
+				return false
+			}
+		})
+	}
+}
+
+func startStream(c *gin.Context) {
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+}
+
+func consumerResponse(position int, consumer *domain.Consumer) gin.H {
+	return gin.H{
+		"position":  position,
+		"queueId":   consumer.JoinedQueue(),
+		"name":      consumer.Name,
+		"phone":     consumer.Phone,
+		"partySize": consumer.Party(),
+		"accessKey": consumer.Accesskey,
+		"status":    consumer.Status,
+		// Estimated wait in seconds, zero while there is no service history
+		"estimatedWaitSeconds": consumer.EstimatedWaitSeconds,
+	}
+}
+
+// publicConsumerResponse is consumerResponse for whoever holds the access key,
+// which travels in links and must not reveal the full phone
+func publicConsumerResponse(position int, consumer *domain.Consumer) gin.H {
+	response := consumerResponse(position, consumer)
+	response["phone"] = logging.RedactPhone(consumer.Phone)
+
+	return response
+}
@@ -0,0 +1,240 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/event"
+	"github.com/rokoga/filas-backend/service"
+	"github.com/stretchr/testify/assert"
+)
+
+// trackedSubscriptions reports every subscription cancelled by a stream
+type trackedSubscriptions struct {
+	service.StoreService
+	cancelled chan string
+}
+
+func (s trackedSubscriptions) Subscribe(id string) (<-chan event.Event, func()) {
+	events, cancel := s.StoreService.Subscribe(id)
+	return events, func() {
+		cancel()
+		s.cancelled <- id
+	}
+}
+
+// sseEvent is one frame of a Server-Sent Events stream
+type sseEvent struct {
+	name string
+	data string
+}
+
+// readEvent reads the next frame that is not a keep alive
+func readEvent(r *bufio.Reader) (sseEvent, bool) {
+	var e sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return e, false
+		}
+		line = strings.TrimRight(line, "\n")
+
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			e.name = strings.TrimPrefix(line, "event:")
+		case strings.HasPrefix(line, "data:"):
+			e.data = strings.TrimPrefix(line, "data:")
+		case line == "" && e.name != "":
+			if e.name != "ping" {
+				return e, true
+			}
+			e = sseEvent{}
+		}
+	}
+}
+
+// openStream starts a stream and fails the test unless it is accepted
+func openStream(t *testing.T, url string) (*http.Response, *bufio.Reader, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	assert.Nil(t, err)
+
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.Nil(t, err) {
+		cancel()
+		t.FailNow()
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	return resp, bufio.NewReader(resp.Body), cancel
+}
+
+func newStreamServer(svc service.StoreService) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(errorHandler())
+	router.GET("/stream/store/:storeid", streamStore(svc))
+	router.GET("/stream/mystore/:slug/:accessKey", streamConsumer(svc))
+
+	return httptest.NewServer(router)
+}
+
+// join adds a waiting consumer and returns its access key
+func join(t *testing.T, svc service.StoreService, storeID, name, rawPhone string) string {
+	accessURL, err := svc.AddConsumer(context.Background(), storeID, domain.DefaultQueueID, name, rawPhone, 1, domain.StatusWaiting)
+	assert.Nil(t, err)
+	return accessURL[strings.LastIndex(accessURL, "/")+1:]
+}
+
+func TestStreamStore(t *testing.T) {
+
+	ctx := context.Background()
+	svc := trackedSubscriptions{StoreService: service.NewStoreMockServiceImpl(), cancelled: make(chan string, 1)}
+	server := newStreamServer(svc)
+	defer server.Close()
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+	assert.Nil(t, err)
+
+	resp, frames, disconnect := openStream(t, server.URL+"/stream/store/"+store.ID)
+	defer resp.Body.Close()
+
+	waiting := func() []string {
+		e, ok := readEvent(frames)
+		assert.True(t, ok)
+		assert.Equal(t, "queue", e.name)
+
+		var consumers []*domain.Consumer
+		assert.Nil(t, json.Unmarshal([]byte(e.data), &consumers))
+		names := []string{}
+		for _, consumer := range consumers {
+			names = append(names, consumer.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{}, waiting())
+
+	join(t, svc, store.ID, "Ana", "011911111111")
+	assert.Equal(t, []string{"Ana"}, waiting())
+
+	bia := join(t, svc, store.ID, "Bia", "011922222222")
+	assert.Equal(t, []string{"Ana", "Bia"}, waiting())
+
+	assert.Nil(t, svc.CancelByAccessKey(ctx, "outback", bia))
+	assert.Equal(t, []string{"Ana"}, waiting())
+
+	_, err = svc.CallNext(ctx, store.ID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{}, waiting())
+
+	// The subscription goes away with the client
+	disconnect()
+	select {
+	case id := <-svc.cancelled:
+		assert.Equal(t, store.ID, id)
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription kept after the client disconnected")
+	}
+}
+
+func TestStreamConsumer(t *testing.T) {
+
+	ctx := context.Background()
+	svc := trackedSubscriptions{StoreService: service.NewStoreMockServiceImpl(), cancelled: make(chan string, 1)}
+	server := newStreamServer(svc)
+	defer server.Close()
+
+	store, err := svc.Create(ctx, "Outback", "owner1")
+	assert.Nil(t, err)
+
+	ana := join(t, svc, store.ID, "Ana", "011911111111")
+	bia := join(t, svc, store.ID, "Bia", "011922222222")
+
+	resp, frames, disconnect := openStream(t, server.URL+"/stream/mystore/outback/"+bia)
+	defer disconnect()
+	defer resp.Body.Close()
+
+	position := func() gin.H {
+		e, ok := readEvent(frames)
+		assert.True(t, ok)
+		assert.Equal(t, "position", e.name)
+
+		var body gin.H
+		assert.Nil(t, json.Unmarshal([]byte(e.data), &body))
+		return body
+	}
+
+	first := position()
+	assert.Equal(t, float64(1), first["position"])
+	assert.Equal(t, string(domain.StatusWaiting), first["status"])
+	assert.Equal(t, "**********2222", first["phone"])
+
+	// Ana leaving moves Bia to the front
+	assert.Nil(t, svc.CancelByAccessKey(ctx, "outback", ana))
+	assert.Equal(t, float64(0), position()["position"])
+
+	called, err := svc.CallNext(ctx, store.ID, domain.DefaultQueueID)
+	assert.Nil(t, err)
+	assert.Equal(t, string(domain.StatusCalled), position()["status"])
+
+	// The stream ends once the consumer leaves the queue
+	assert.Nil(t, svc.Serve(ctx, store.ID, domain.DefaultQueueID, called.ID))
+	assert.Equal(t, string(domain.StatusServed), position()["status"])
+	_, ok := readEvent(frames)
+	assert.False(t, ok)
+
+	select {
+	case id := <-svc.cancelled:
+		assert.Equal(t, store.ID, id)
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription kept after the stream ended")
+	}
+}
+
+func TestStreamConsumerInvalidAccessKey(t *testing.T) {
+
+	ctx := context.Background()
+	svc := trackedSubscriptions{StoreService: service.NewStoreMockServiceImpl(), cancelled: make(chan string, 1)}
+	server := newStreamServer(svc)
+	defer server.Close()
+
+	_, err := svc.Create(ctx, "Outback", "owner1")
+	assert.Nil(t, err)
+
+	resp, err := http.Get(server.URL + "/stream/mystore/outback/chave-invalida")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	var body map[string]string
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "invalid_access_key", body["code"])
+
+	// Rejected streams do not keep their subscription either
+	select {
+	case <-svc.cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription kept after the access key was rejected")
+	}
+}
+
+func TestPublicConsumerResponse(t *testing.T) {
+
+	consumer := &domain.Consumer{ID: "1", Name: "Ana", Phone: "+5511911111111", Accesskey: "key", Status: domain.StatusWaiting}
+
+	assert.Equal(t, "**********1111", publicConsumerResponse(1, consumer)["phone"])
+	assert.Equal(t, "Ana", publicConsumerResponse(1, consumer)["name"])
+	// Staff still see the full phone to reach the consumer
+	assert.Equal(t, "+5511911111111", consumerResponse(1, consumer)["phone"])
+}
@@ -1,52 +1,388 @@
 package web
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/gin-contrib/cors"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rokoga/filas-backend/auth"
+	"github.com/rokoga/filas-backend/config"
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/event"
 	"github.com/rokoga/filas-backend/infra"
+	"github.com/rokoga/filas-backend/logging"
+	"github.com/rokoga/filas-backend/metrics"
+	"github.com/rokoga/filas-backend/notify"
+	"github.com/rokoga/filas-backend/outbox"
+	"github.com/rokoga/filas-backend/repository"
 	"github.com/rokoga/filas-backend/service"
 	"github.com/rokoga/filas-backend/vo"
+	"github.com/rokoga/filas-backend/webhook"
+	"github.com/sirupsen/logrus"
 )
 
+// outboxLeaseMargin is how much longer than the notifier or webhook timeout
+// a message or delivery stays locked while a worker sends it
+const outboxLeaseMargin = 30 * time.Second
+
 // Run implements the main function of web API
-func Run(done chan string) {
-	const PORT = ":8080"
-	router := gin.Default()
+// It serves until ctx is cancelled, then drains in-flight requests and
+// streams within cfg.Server.ShutdownTimeout and disconnects from the database.
+func Run(ctx context.Context, cfg *config.Config, logger *logrus.Logger) error {
+	appMetrics := metrics.New()
+
+	router := gin.New()
+	router.Use(requestLogger(logger))
+	router.Use(gin.RecoveryWithWriter(logger.WriterLevel(logrus.ErrorLevel)))
+	router.Use(instrument(appMetrics))
 	router.Use(cors.Default())
+	router.Use(errorHandler())
+
+	dbClient, dbCollection, err := infra.GetConnection(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := infra.CloseConnection(dbClient); err != nil {
+			logger.WithError(err).Error("database disconnect failed")
+		}
+	}()
+
+	usersCollection := dbCollection.Database().Collection(cfg.Database.UsersCollection)
+	queueCollection := dbCollection.Database().Collection(cfg.Database.QueueCollection)
+	outboxCollection := dbCollection.Database().Collection(cfg.Database.OutboxCollection)
+	webhooksCollection := dbCollection.Database().Collection(cfg.Database.WebhooksCollection)
+	deliveriesCollection := dbCollection.Database().Collection(cfg.Database.WebhookDeliveriesCollection)
+
+	storeRepository := repository.NewStoreRepository(dbCollection, queueCollection, cfg.Database.Timeout)
+	if err := storeRepository.EnsureIndexes(ctx); err != nil {
+		return err
+	}
+	slugs, err := storeRepository.MigrateSlugs(ctx)
+	if err != nil {
+		return err
+	}
+	if slugs > 0 {
+		logger.WithField("stores", slugs).Info("slugs added to stores")
+	}
+	migrated, err := storeRepository.MigrateQueue(logging.NewContext(ctx, logrus.NewEntry(logger)))
+	if err != nil {
+		return err
+	}
+	if migrated > 0 {
+		logger.WithField("consumers", migrated).Info("queue moved to its own collection")
+	}
+	if err := repository.NewUserRepository(usersCollection, cfg.Database.Timeout).EnsureIndexes(ctx); err != nil {
+		return err
+	}
+	outboxRepository := repository.NewOutboxRepository(outboxCollection, cfg.Database.Timeout)
+	if err := outboxRepository.EnsureIndexes(ctx); err != nil {
+		return err
+	}
+	webhookRepository := repository.NewWebhookRepository(webhooksCollection, deliveriesCollection, cfg.Database.Timeout)
+	if err := webhookRepository.EnsureIndexes(ctx); err != nil {
+		return err
+	}
+
+	transactions, err := infra.SupportsTransactions(ctx, dbClient)
+	if err != nil {
+		return err
+	}
+	if !transactions {
+		if !cfg.Database.AllowStandalone {
+			return errors.New("O banco não suporta transações: use um replica set ou configure dballowstandalone")
+		}
+		logger.Warn("database does not support transactions, queue changes and their notifications are written one after the other")
+	}
+
+	hub := event.NewHub()
+
+	health := newHealth(func(ctx context.Context) error {
+		return infra.Ping(ctx, dbClient)
+	}, cfg.Database.Timeout)
 
-	dbClient, dbCollection, err := infra.GetConnection("config/dev/.env")
+	router.GET("/healthz", health.live)
+	router.GET("/readyz", health.ready)
+	if cfg.Server.MetricsToken != "" {
+		router.GET("/metrics", scraper(cfg.Server.MetricsToken), gin.WrapH(appMetrics.Handler()))
+	}
+
+	notifier, err := notify.New(cfg.Notify)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if closer, ok := notifier.(io.Closer); ok {
+		defer closer.Close()
 	}
-	defer infra.CloseConnection(dbClient)
 
-	svc := service.NewStoreServiceImpl(dbCollection)
+	// Stopped before the notifier is closed, a message being sent when it
+	// stops is sent again once its lease expires
+	worker := outbox.NewWorker(outboxRepository, notifier, outbox.Options{
+		PollInterval: cfg.Notify.PollInterval,
+		Backoff:      cfg.Notify.Backoff,
+		MaxBackoff:   cfg.Notify.MaxBackoff,
+		MaxAttempts:  cfg.Notify.MaxAttempts,
+		Lease:        cfg.Notify.Timeout + outboxLeaseMargin,
+	})
+	workerCtx, stopWorker := context.WithCancel(logging.NewContext(context.Background(), logrus.NewEntry(logger)))
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		worker.Run(workerCtx)
+	}()
+	defer func() {
+		stopWorker()
+		<-workerDone
+	}()
+
+	webhookClient := webhook.NewClient(cfg.Webhook.Timeout, cfg.Webhook.AllowPrivate)
+	webhookWorker := webhook.NewWorker(webhookRepository, webhookClient, outbox.Options{
+		PollInterval: cfg.Webhook.PollInterval,
+		Backoff:      cfg.Webhook.Backoff,
+		MaxBackoff:   cfg.Webhook.MaxBackoff,
+		MaxAttempts:  cfg.Webhook.MaxAttempts,
+		Lease:        cfg.Webhook.Timeout + outboxLeaseMargin,
+	})
+	webhookDone := make(chan struct{})
+	go func() {
+		defer close(webhookDone)
+		webhookWorker.Run(workerCtx)
+	}()
+	defer func() {
+		stopWorker()
+		<-webhookDone
+	}()
+
+	svc := service.NewStoreServiceImpl(dbCollection, queueCollection, cfg.Database.Timeout, hub, cfg.Server.BaseURL, appMetrics, outboxRepository, repository.NewTransactor(dbClient, transactions), cfg.Notify.NearFront, webhookRepository, webhookClient)
+
+	tokens := auth.NewTokenManager([]byte(cfg.Auth.Secret), cfg.Auth.TokenTTL)
+	authSvc := service.NewAuthServiceImpl(usersCollection, cfg.Database.Timeout, tokens)
+
+	staff := authenticate(authSvc)
+
+	if cfg.Features.Registration {
+		router.POST("/auth/register", func(c *gin.Context) {
+			registerRequest := vo.RegisterRequest{}
+			if err := c.ShouldBindJSON(&registerRequest); err != nil {
+				c.Error(ErrInvalidBody)
+				return
+			}
+
+			user, err := authSvc.Register(c.Request.Context(), registerRequest.Name, registerRequest.Email, registerRequest.Password)
+			if err != nil {
+				c.Error(err)
+				return
+			}
+
+			c.JSON(200, user)
+		})
+	}
 
-	router.PUT("/store", func(c *gin.Context) {
+	router.POST("/auth/login", func(c *gin.Context) {
+		loginRequest := vo.LoginRequest{}
+		if err := c.ShouldBindJSON(&loginRequest); err != nil {
+			c.Error(ErrInvalidBody)
+			return
+		}
+
+		token, err := authSvc.Login(c.Request.Context(), loginRequest.Email, loginRequest.Password)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(200, gin.H{"token": token})
+	})
+
+	router.PUT("/store", staff, func(c *gin.Context) {
 		createRequest := vo.CreateRequest{}
-		c.BindJSON(&createRequest)
+		if err := c.ShouldBindJSON(&createRequest); err != nil {
+			c.Error(ErrInvalidBody)
+			return
+		}
 
-		store, err := svc.Create(createRequest.Name)
+		store, err := svc.Create(c.Request.Context(), createRequest.Name, currentUser(c).ID)
 		if err != nil {
 			c.Error(err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
 		c.JSON(200, store)
 	})
 
-	router.DELETE("/store/:storeid", func(c *gin.Context) {
+	router.POST("/store/:storeid/staff", staff, authorizeStore(svc, "storeid", true), func(c *gin.Context) {
+		storeid := c.Param("storeid")
+		addStaffRequest := vo.AddStaffRequest{}
+		if err := c.ShouldBindJSON(&addStaffRequest); err != nil {
+			c.Error(ErrInvalidBody)
+			return
+		}
+
+		user, err := authSvc.GetUserByEmail(c.Request.Context(), addStaffRequest.Email)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		if err := svc.AddStaff(c.Request.Context(), storeid, user.ID); err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(200, nil)
+	})
+
+	// Stores created before they had an owner are managed by nobody, an
+	// admin assigns them one
+	router.POST("/store/:storeid/owner", staff, admin(cfg.Auth.Admins), func(c *gin.Context) {
+		storeid := c.Param("storeid")
+		assignOwnerRequest := vo.AssignOwnerRequest{}
+		if err := c.ShouldBindJSON(&assignOwnerRequest); err != nil {
+			c.Error(ErrInvalidBody)
+			return
+		}
+
+		user, err := authSvc.GetUserByEmail(c.Request.Context(), assignOwnerRequest.Email)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		if err := svc.AssignOwner(c.Request.Context(), storeid, user.ID); err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(200, nil)
+	})
+
+	router.PATCH("/store/:storeid", staff, authorizeStore(svc, "storeid", false), func(c *gin.Context) {
 		id := c.Param("storeid")
+		updateRequest := vo.UpdateStoreRequest{}
+		if err := c.ShouldBindJSON(&updateRequest); err != nil {
+			c.Error(ErrInvalidBody)
+			return
+		}
+
+		store, err := svc.UpdateStore(c.Request.Context(), id, domain.StoreUpdate{
+			Version:          updateRequest.Version,
+			Name:             updateRequest.Name,
+			Contact:          updateRequest.Contact,
+			Address:          updateRequest.Address,
+			LogoURL:          updateRequest.LogoURL,
+			OpeningHours:     updateRequest.OpeningHours,
+			Settings:         updateRequest.Settings,
+			Queues:           updateRequest.Queues,
+			MessageTemplates: updateRequest.MessageTemplates,
+		})
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(200, store)
+	})
+
+	router.POST("/store/:storeid/mode", staff, authorizeStore(svc, "storeid", false), func(c *gin.Context) {
+		id := c.Param("storeid")
+		modeRequest := vo.SetQueueModeRequest{}
+		if err := c.ShouldBindJSON(&modeRequest); err != nil {
+			c.Error(ErrInvalidBody)
+			return
+		}
+
+		store, err := svc.SetQueueMode(c.Request.Context(), id, modeRequest.Mode, modeRequest.Until)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(200, store)
+	})
+
+	router.POST("/store/:storeid/webhooks", staff, authorizeStore(svc, "storeid", true), func(c *gin.Context) {
+		storeid := c.Param("storeid")
+		webhookRequest := vo.CreateWebhookRequest{}
+		if err := c.ShouldBindJSON(&webhookRequest); err != nil {
+			c.Error(ErrInvalidBody)
+			return
+		}
+
+		hook, err := svc.CreateWebhook(c.Request.Context(), storeid, webhookRequest.URL, webhookRequest.Events)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		// The secret is hidden everywhere else
+		c.JSON(200, struct {
+			*domain.Webhook
+			Secret string `json:"secret"`
+		}{hook, hook.Secret})
+	})
+
+	router.GET("/store/:storeid/webhooks", staff, authorizeStore(svc, "storeid", false), func(c *gin.Context) {
+		storeid := c.Param("storeid")
 
-		err := svc.RemoveStore(id)
+		hooks, err := svc.ListWebhooks(c.Request.Context(), storeid)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(200, hooks)
+	})
+
+	router.DELETE("/store/:storeid/webhooks/:webhookid", staff, authorizeStore(svc, "storeid", true), func(c *gin.Context) {
+		storeid := c.Param("storeid")
+		webhookid := c.Param("webhookid")
+
+		if err := svc.RemoveWebhook(c.Request.Context(), storeid, webhookid); err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(200, nil)
+	})
+
+	router.GET("/store/:storeid/webhooks/:webhookid/deliveries", staff, authorizeStore(svc, "storeid", false), func(c *gin.Context) {
+		storeid := c.Param("storeid")
+		webhookid := c.Param("webhookid")
+
+		deliveries, err := svc.GetWebhookDeliveries(c.Request.Context(), storeid, webhookid)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(200, deliveries)
+	})
+
+	router.POST("/store/:storeid/webhooks/:webhookid/ping", staff, authorizeStore(svc, "storeid", false), func(c *gin.Context) {
+		storeid := c.Param("storeid")
+		webhookid := c.Param("webhookid")
+
+		delivery, err := svc.PingWebhook(c.Request.Context(), storeid, webhookid)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(200, delivery)
+	})
+
+	router.DELETE("/store/:storeid", staff, authorizeStore(svc, "storeid", true), func(c *gin.Context) {
+		id := c.Param("storeid")
+
+		err := svc.RemoveStore(c.Request.Context(), id)
 		if err != nil {
 			c.Error(err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
@@ -54,37 +390,56 @@ func Run(done chan string) {
 	})
 
 	router.GET("/stores", func(c *gin.Context) {
+		listRequest := vo.ListStoresRequest{}
+		if err := c.ShouldBindQuery(&listRequest); err != nil {
+			c.Error(ErrInvalidQuery)
+			return
+		}
 
-		stores, err := svc.GetAllStores()
+		page, err := svc.ListStores(c.Request.Context(), repository.StoreListOptions{
+			Search: listRequest.Search,
+			Sort:   repository.StoreSort(listRequest.Sort),
+			Limit:  listRequest.Limit,
+			Offset: listRequest.Offset,
+		})
 		if err != nil {
 			c.Error(err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(200, stores)
+		c.JSON(200, page)
 	})
 
 	router.GET("/store/name/:name", func(c *gin.Context) {
 		name := c.Param("name")
 
-		domainStore, err := svc.GetStore(name)
+		domainStore, err := svc.GetStore(c.Request.Context(), name)
 		if err != nil {
 			c.Error(err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(200, domainStore)
+		c.JSON(200, publicStore(domainStore))
+	})
+
+	router.GET("/store/slug/:slug", func(c *gin.Context) {
+		storeSlug := c.Param("slug")
+
+		domainStore, err := svc.GetStoreBySlug(c.Request.Context(), storeSlug)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(200, publicStore(domainStore))
 	})
 
-	router.GET("/store/id/:id", func(c *gin.Context) {
+	router.GET("/store/id/:id", staff, authorizeStore(svc, "id", false), func(c *gin.Context) {
 		id := c.Param("id")
 
-		domainStore, err := svc.GetStoreByID(id)
+		domainStore, err := svc.GetStoreByID(c.Request.Context(), id)
 		if err != nil {
 			c.Error(err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
@@ -93,92 +448,235 @@ func Run(done chan string) {
 
 	router.PUT("/consumer", func(c *gin.Context) {
 		addConsumerRequest := vo.AddConsumerRequest{}
-		c.BindJSON(&addConsumerRequest)
+		if err := c.ShouldBindJSON(&addConsumerRequest); err != nil {
+			c.Error(ErrInvalidBody)
+			return
+		}
+
+		queueID := addConsumerRequest.QueueID
+		if queueID == "" {
+			queueID = domain.DefaultQueueID
+		}
 
-		status := "Na fila"
-		accessURL, err := svc.AddConsumer(addConsumerRequest.StoreID, addConsumerRequest.Name, addConsumerRequest.Phone, status)
+		accessURL, err := svc.AddConsumer(c.Request.Context(), addConsumerRequest.StoreID, queueID, addConsumerRequest.Name, addConsumerRequest.Phone, addConsumerRequest.PartySize, domain.StatusWaiting)
 		if err != nil {
 			c.Error(err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
 		c.JSON(200, accessURL)
 	})
 
-	router.DELETE("/consumer/:storeid/:number", func(c *gin.Context) {
+	router.DELETE("/consumer/:storeid/:consumerid", staff, authorizeStore(svc, "storeid", false), func(c *gin.Context) {
 		storeid := c.Param("storeid")
-		number := c.Param("number")
+		consumerid := c.Param("consumerid")
 
-		err := svc.RemoveConsumer(storeid, number)
+		err := svc.RemoveConsumer(c.Request.Context(), storeid, queueParam(c), consumerid)
 		if err != nil {
 			c.Error(err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
 		c.JSON(200, nil)
 	})
 
-	router.GET("/consumer/:storeid/:number", func(c *gin.Context) {
+	router.GET("/consumer/:storeid/:consumerid", staff, authorizeStore(svc, "storeid", false), func(c *gin.Context) {
 		storeid := c.Param("storeid")
-		number := c.Param("number")
+		consumerid := c.Param("consumerid")
 
-		position, consumer, err := svc.GetConsumer(storeid, number)
+		position, consumer, err := svc.GetConsumer(c.Request.Context(), storeid, queueParam(c), consumerid)
 		if err != nil {
 			c.Error(err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		response := gin.H{
-			"position":  position,
-			"name":      consumer.Name,
-			"phone":     consumer.Phone,
-			"accessKey": consumer.Accesskey,
-			"status":    consumer.Status,
+		c.JSON(200, consumerResponse(position, consumer))
+	})
+
+	router.GET("/consumer/:storeid/:consumerid/notifications", staff, authorizeStore(svc, "storeid", false), func(c *gin.Context) {
+		storeid := c.Param("storeid")
+		consumerid := c.Param("consumerid")
+
+		notifications, err := svc.GetNotifications(c.Request.Context(), storeid, queueParam(c), consumerid)
+		if err != nil {
+			c.Error(err)
+			return
 		}
 
-		c.JSON(200, response)
+		c.JSON(200, notifications)
 	})
 
-	router.GET("/consumers/:storeid", func(c *gin.Context) {
+	router.GET("/consumers/:storeid", staff, authorizeStore(svc, "storeid", false), func(c *gin.Context) {
 		storeid := c.Param("storeid")
 
-		allConsumers, err := svc.GetAllConsumers(storeid)
+		allConsumers, err := svc.GetAllConsumers(c.Request.Context(), storeid, queueParam(c))
 		if err != nil {
 			c.Error(err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
 		c.JSON(200, allConsumers)
 	})
 
-	router.GET("/mystore/:storeName/:accessKey", func(c *gin.Context) {
+	router.GET("/mystore/:slug/:accessKey", func(c *gin.Context) {
 		accessKey := c.Param("accessKey")
-		storeName := c.Param("storeName")
+		storeSlug := c.Param("slug")
+
+		position, consumer, err := svc.ValidateConsumer(c.Request.Context(), storeSlug, accessKey)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(200, publicConsumerResponse(position, consumer))
+	})
+
+	router.DELETE("/mystore/:slug/:accessKey", func(c *gin.Context) {
+		accessKey := c.Param("accessKey")
+		storeSlug := c.Param("slug")
+
+		err := svc.CancelByAccessKey(c.Request.Context(), storeSlug, accessKey)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(200, nil)
+	})
+
+	router.POST("/queue/:storeid/next", staff, authorizeStore(svc, "storeid", false), func(c *gin.Context) {
+		storeid := c.Param("storeid")
+
+		consumer, err := svc.CallNext(c.Request.Context(), storeid, queueParam(c))
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(200, consumer)
+	})
+
+	router.POST("/queue/:storeid/next/table", staff, authorizeStore(svc, "storeid", false), func(c *gin.Context) {
+		storeid := c.Param("storeid")
+		tableRequest := vo.CallTableRequest{}
+		if err := c.ShouldBindJSON(&tableRequest); err != nil {
+			c.Error(ErrInvalidBody)
+			return
+		}
+
+		consumer, err := svc.CallNextForTable(c.Request.Context(), storeid, queueParam(c), tableRequest.Capacity)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(200, consumer)
+	})
+
+	router.POST("/consumer/:storeid/:consumerid/served", staff, authorizeStore(svc, "storeid", false), func(c *gin.Context) {
+		storeid := c.Param("storeid")
+		consumerid := c.Param("consumerid")
+
+		err := svc.Serve(c.Request.Context(), storeid, queueParam(c), consumerid)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(200, nil)
+	})
+
+	router.POST("/consumer/:storeid/:consumerid/noshow", staff, authorizeStore(svc, "storeid", false), func(c *gin.Context) {
+		storeid := c.Param("storeid")
+		consumerid := c.Param("consumerid")
+
+		err := svc.NoShow(c.Request.Context(), storeid, queueParam(c), consumerid)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		c.JSON(200, nil)
+	})
+
+	router.POST("/consumer/:storeid/:consumerid/accesskey", staff, authorizeStore(svc, "storeid", false), func(c *gin.Context) {
+		storeid := c.Param("storeid")
+		consumerid := c.Param("consumerid")
 
-		position, consumer, err := svc.ValidateConsumer(storeName, accessKey)
+		accessURL, err := svc.RotateAccessKey(c.Request.Context(), storeid, queueParam(c), consumerid)
 		if err != nil {
 			c.Error(err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		response := gin.H{
-			"position":  position,
-			"name":      consumer.Name,
-			"phone":     consumer.Phone,
-			"accessKey": consumer.Accesskey,
-			"status":    consumer.Status,
+		c.JSON(200, accessURL)
+	})
+
+	router.DELETE("/consumer/:storeid/:consumerid/accesskey", staff, authorizeStore(svc, "storeid", false), func(c *gin.Context) {
+		storeid := c.Param("storeid")
+		consumerid := c.Param("consumerid")
+
+		err := svc.RevokeAccessKey(c.Request.Context(), storeid, queueParam(c), consumerid)
+		if err != nil {
+			c.Error(err)
+			return
 		}
 
-		c.JSON(200, response)
+		c.JSON(200, nil)
 	})
 
-	fmt.Printf("Server is listening at %s", PORT)
-	router.Run(PORT)
+	if cfg.Features.Streaming {
+		router.GET("/stream/store/:storeid", staff, authorizeStore(svc, "storeid", false), streamStore(svc))
+
+		router.GET("/stream/mystore/:slug/:accessKey", streamConsumer(svc))
+	}
+
+	server := &http.Server{
+		Addr:         cfg.Server.Address,
+		Handler:      router,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+	}
+
+	// Streams only end when their subscription is closed, so closing the hub
+	// lets Shutdown drain them instead of waiting for the deadline
+	server.RegisterOnShutdown(hub.Close)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.WithField("address", cfg.Server.Address).Info("server is listening")
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		hub.Close()
+		return fmt.Errorf("Erro ao iniciar o servidor: %v", err)
+	case <-ctx.Done():
+	}
+
+	logger.Info("server is shutting down")
+
+	// Fail readiness first so the orchestrator stops routing new requests
+	health.drain()
+	time.Sleep(cfg.Server.DrainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		server.Close()
+		return fmt.Errorf("Erro ao encerrar o servidor: %v", err)
+	}
+
+	logger.Info("server shutdown")
+
+	return nil
+}
 
-	done <- "Server shutdown"
+// queueParam returns the queue of the store a consumer route acts on, given
+// by the queue query parameter. Clients written before stores had several
+// queues leave it out and get the default queue.
+func queueParam(c *gin.Context) string {
+	return c.DefaultQuery("queue", domain.DefaultQueueID)
 }
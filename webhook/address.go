@@ -0,0 +1,105 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ErrForbiddenAddress for endpoints on loopback, private or link-local
+// addresses, which store owners must not reach through the server
+var ErrForbiddenAddress = errors.New("O endereço do webhook não é permitido")
+
+// forbiddenNetworks are the ranges besides loopback, link-local, multicast
+// and unspecified addresses that webhooks cannot point to
+var forbiddenNetworks = parseNetworks(
+	"0.0.0.0/8",     // this network
+	"10.0.0.0/8",    // private
+	"100.64.0.0/10", // carrier-grade NAT
+	"172.16.0.0/12", // private
+	"192.0.0.0/24",  // protocol assignments
+	"192.168.0.0/16",
+	"198.18.0.0/15", // benchmarking
+	"fc00::/7",      // unique local
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// forbiddenIP reports whether ip is an address webhooks cannot point to
+func forbiddenIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, network := range forbiddenNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvePublic returns the addresses of host, failing with
+// ErrForbiddenAddress when any of them is forbidden
+func resolvePublic(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		if forbiddenIP(ip) {
+			return nil, ErrForbiddenAddress
+		}
+		return []net.IP{ip}, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("nenhum endereço encontrado para %s", host)
+	}
+
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		if forbiddenIP(addr.IP) {
+			return nil, ErrForbiddenAddress
+		}
+		ips = append(ips, addr.IP)
+	}
+	return ips, nil
+}
+
+// dialPublic returns a DialContext that only connects to the addresses of
+// the host resolvePublic allows. The address checked is the one dialed, so
+// a DNS change after the check does not get through.
+func dialPublic(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		ips, err := resolvePublic(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var lastErr error
+		for _, ip := range ips {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
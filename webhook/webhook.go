@@ -0,0 +1,171 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rokoga/filas-backend/domain"
+)
+
+const (
+	// HeaderEvent carries the event type of the payload
+	HeaderEvent = "X-Filas-Event"
+	// HeaderDelivery carries the delivery ID, the same on every attempt
+	HeaderDelivery = "X-Filas-Delivery"
+	// HeaderTimestamp carries the Unix time the attempt was signed at
+	HeaderTimestamp = "X-Filas-Timestamp"
+	// HeaderSignature carries the signature of the timestamp and the body
+	HeaderSignature = "X-Filas-Signature"
+)
+
+// Ping is the event type of the test sent to check an endpoint
+const Ping = "webhook.ping"
+
+// Payload - Body posted to a webhook
+type Payload struct {
+	// ID is the delivery ID, receivers use it to drop repeated attempts
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	StoreID    string    `json:"storeId"`
+	QueueID    string    `json:"queueId,omitempty"`
+	ConsumerID string    `json:"consumerId,omitempty"`
+	OccurredAt time.Time `json:"occurredAt"`
+}
+
+// Sign returns the signature of a payload sent at timestamp: the hex HMAC
+// SHA-256 of the timestamp, a dot and the body, keyed with the webhook
+// secret and prefixed with "sha256=". Signing the timestamp lets receivers
+// reject replayed requests.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature was made with secret for the timestamp
+// and body received
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal([]byte(Sign(secret, ts, body)), []byte(signature))
+}
+
+// Sender - Posts deliveries to webhooks
+type Sender interface {
+	// Send returns the status the endpoint answered with, zero when it
+	// could not be reached
+	Send(ctx context.Context, hook *domain.Webhook, delivery *domain.WebhookDelivery) (int, error)
+	// CheckHost fails with ErrForbiddenAddress when host is an address
+	// deliveries cannot be sent to
+	CheckHost(ctx context.Context, host string) error
+}
+
+// Client posts deliveries to webhooks over HTTP
+type Client struct {
+	client       *http.Client
+	allowPrivate bool
+	now          func() time.Time
+}
+
+// NewClient implements
+// timeout bounds each request, redirects and proxies are not followed.
+// Unless allowPrivate is set, endpoints on loopback, private or link-local
+// addresses are refused when connecting.
+func NewClient(timeout time.Duration, allowPrivate bool) *Client {
+	dialer := &net.Dialer{Timeout: timeout}
+
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: timeout,
+	}
+	if !allowPrivate {
+		transport.DialContext = dialPublic(dialer)
+	}
+
+	return &Client{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		allowPrivate: allowPrivate,
+		now:          time.Now,
+	}
+}
+
+// CheckHost implements
+func (c *Client) CheckHost(ctx context.Context, host string) error {
+	if c.allowPrivate {
+		return nil
+	}
+
+	_, err := resolvePublic(ctx, host)
+	return err
+}
+
+// FailureReason describes a failed attempt to the store owner. Network
+// errors are summed up, their text tells about the network of the server.
+func FailureReason(status int, err error) string {
+	var netErr net.Error
+
+	switch {
+	case status != 0:
+		return fmt.Sprintf("webhook respondeu %d", status)
+	case errors.Is(err, ErrForbiddenAddress):
+		return ErrForbiddenAddress.Error()
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		return "webhook não respondeu a tempo"
+	}
+	return "não foi possível conectar ao webhook"
+}
+
+// Send implements
+// Any status other than 2xx is an error.
+func (c *Client) Send(ctx context.Context, hook *domain.Webhook, delivery *domain.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := c.now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, timestamp, body))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// Drained so the connection is reused
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook respondeu %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,247 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/outbox"
+	"github.com/rokoga/filas-backend/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSign(t *testing.T) {
+
+	body := []byte(`{"id":"d1","type":"consumer.joined"}`)
+	signature := Sign("segredo", 1614600000, body)
+
+	assert.Equal(t, "sha256=", signature[:7])
+	assert.Len(t, signature, 7+64)
+	assert.True(t, Verify("segredo", "1614600000", body, signature))
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      []byte
+	}{
+		{name: "secret", secret: "outro", timestamp: "1614600000", body: body},
+		{name: "timestamp", secret: "segredo", timestamp: "1614600001", body: body},
+		{name: "body", secret: "segredo", timestamp: "1614600000", body: []byte(`{}`)},
+		{name: "invalid timestamp", secret: "segredo", timestamp: "ontem", body: body},
+	}
+
+	for _, tt := range tests {
+		assert.False(t, Verify(tt.secret, tt.timestamp, tt.body, signature), tt.name)
+	}
+}
+
+// receiver records the requests of a local endpoint answering status
+type receiver struct {
+	server   *httptest.Server
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newReceiver() *receiver {
+	r := &receiver{status: http.StatusOK}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, body)
+		w.WriteHeader(r.status)
+	}))
+	return r
+}
+
+func TestClientSend(t *testing.T) {
+
+	ctx := context.Background()
+	endpoint := newReceiver()
+	defer endpoint.server.Close()
+
+	client := NewClient(time.Second, true)
+	client.now = func() time.Time { return time.Unix(1614600000, 0) }
+
+	hook := &domain.Webhook{ID: "w1", URL: endpoint.server.URL, Secret: "segredo"}
+	delivery := &domain.WebhookDelivery{ID: "d1", Event: "consumer.called", Payload: `{"id":"d1"}`}
+
+	status, err := client.Send(ctx, hook, delivery)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, status)
+
+	req := endpoint.requests[0]
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	assert.Equal(t, "consumer.called", req.Header.Get(HeaderEvent))
+	assert.Equal(t, "d1", req.Header.Get(HeaderDelivery))
+	assert.Equal(t, "1614600000", req.Header.Get(HeaderTimestamp))
+	assert.Equal(t, `{"id":"d1"}`, string(endpoint.bodies[0]))
+	assert.True(t, Verify("segredo", req.Header.Get(HeaderTimestamp), endpoint.bodies[0], req.Header.Get(HeaderSignature)))
+
+	endpoint.status = http.StatusInternalServerError
+	status, err = client.Send(ctx, hook, delivery)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusInternalServerError, status)
+
+	// Redirects are not followed
+	endpoint.status = http.StatusFound
+	status, err = client.Send(ctx, hook, delivery)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusFound, status)
+}
+
+func TestClientForbiddenAddresses(t *testing.T) {
+
+	ctx := context.Background()
+	endpoint := newReceiver()
+	defer endpoint.server.Close()
+
+	client := NewClient(time.Second, false)
+
+	hosts := []struct {
+		host      string
+		forbidden bool
+	}{
+		{host: "127.0.0.1", forbidden: true},
+		{host: "localhost", forbidden: true},
+		{host: "::1", forbidden: true},
+		{host: "::ffff:127.0.0.1", forbidden: true},
+		{host: "169.254.169.254", forbidden: true},
+		{host: "10.0.0.8", forbidden: true},
+		{host: "172.20.1.1", forbidden: true},
+		{host: "192.168.1.1", forbidden: true},
+		{host: "100.64.0.1", forbidden: true},
+		{host: "0.0.0.0", forbidden: true},
+		{host: "fd12:3456::1", forbidden: true},
+		{host: "fe80::1", forbidden: true},
+		{host: "93.184.216.34", forbidden: false},
+		{host: "2606:2800:220:1::1", forbidden: false},
+	}
+
+	for _, tt := range hosts {
+		err := client.CheckHost(ctx, tt.host)
+		if tt.forbidden {
+			assert.Equal(t, ErrForbiddenAddress, err, tt.host)
+		} else {
+			assert.Nil(t, err, tt.host)
+		}
+		assert.Nil(t, NewClient(time.Second, true).CheckHost(ctx, tt.host), tt.host)
+	}
+
+	// Refused when connecting too, whatever was checked before
+	hook := &domain.Webhook{ID: "w1", URL: endpoint.server.URL, Secret: "segredo"}
+	status, err := client.Send(ctx, hook, &domain.WebhookDelivery{ID: "d1", Payload: `{}`})
+	assert.True(t, errors.Is(err, ErrForbiddenAddress))
+	assert.Equal(t, 0, status)
+	assert.Empty(t, endpoint.requests)
+	assert.Equal(t, ErrForbiddenAddress.Error(), FailureReason(status, err))
+}
+
+func TestFailureReason(t *testing.T) {
+
+	assert.Equal(t, "webhook respondeu 503", FailureReason(503, errors.New("webhook respondeu 503")))
+	assert.Equal(t, "webhook não respondeu a tempo", FailureReason(0, context.DeadlineExceeded))
+	assert.Equal(t, "não foi possível conectar ao webhook", FailureReason(0, errors.New("dial tcp 10.0.0.8:80: connect: connection refused")))
+}
+
+func TestWorker(t *testing.T) {
+
+	ctx := context.Background()
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	endpoint := newReceiver()
+	defer endpoint.server.Close()
+
+	repo := repository.NewWebhookMockRepository()
+	worker := NewWorker(repo, NewClient(time.Second, true), outbox.Options{
+		PollInterval: time.Second,
+		Backoff:      time.Minute,
+		MaxBackoff:   time.Hour,
+		MaxAttempts:  2,
+		Lease:        time.Minute,
+	})
+	worker.now = func() time.Time { return now }
+
+	hook := &domain.Webhook{StoreID: "s1", URL: endpoint.server.URL, Secret: "segredo", Events: []string{"consumer.joined"}}
+	assert.Nil(t, repo.CreateWebhook(ctx, hook))
+
+	enqueue := func() {
+		assert.Nil(t, repo.EnqueueDeliveries(ctx, &domain.WebhookDelivery{
+			WebhookID:     hook.ID,
+			StoreID:       "s1",
+			Event:         "consumer.joined",
+			Payload:       `{"type":"consumer.joined"}`,
+			Status:        domain.DeliveryPending,
+			CreatedAt:     now,
+			NextAttemptAt: now,
+		}))
+	}
+
+	// Retried after the backoff, then delivered
+	endpoint.status = http.StatusServiceUnavailable
+	enqueue()
+
+	attempted, err := worker.Drain(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, attempted)
+
+	deliveries, err := repo.ListDeliveries(ctx, "s1", hook.ID, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, domain.DeliveryPending, deliveries[0].Status)
+	assert.Equal(t, http.StatusServiceUnavailable, deliveries[0].ResponseStatus)
+	assert.Equal(t, now.Add(time.Minute), deliveries[0].NextAttemptAt)
+
+	endpoint.status = http.StatusNoContent
+	now = now.Add(time.Minute)
+	_, err = worker.Drain(ctx)
+	assert.Nil(t, err)
+
+	deliveries, _ = repo.ListDeliveries(ctx, "s1", hook.ID, 10)
+	assert.Equal(t, domain.DeliverySent, deliveries[0].Status)
+	assert.Equal(t, http.StatusNoContent, deliveries[0].ResponseStatus)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	assert.True(t, Verify("segredo", endpoint.requests[1].Header.Get(HeaderTimestamp), endpoint.bodies[1], endpoint.requests[1].Header.Get(HeaderSignature)))
+
+	// Dead after MaxAttempts failures
+	endpoint.status = http.StatusInternalServerError
+	enqueue()
+	for i := 0; i < 3; i++ {
+		_, err = worker.Drain(ctx)
+		assert.Nil(t, err)
+		now = now.Add(time.Hour)
+	}
+
+	deliveries, _ = repo.ListDeliveries(ctx, "s1", hook.ID, 10)
+	assert.Equal(t, domain.DeliveryDead, deliveries[0].Status)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	assert.Len(t, endpoint.requests, 4)
+}
+
+func TestWorkerRemovedWebhook(t *testing.T) {
+
+	ctx := context.Background()
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	endpoint := newReceiver()
+	defer endpoint.server.Close()
+
+	repo := repository.NewWebhookMockRepository()
+	worker := NewWorker(repo, NewClient(time.Second, true), outbox.Options{Backoff: time.Minute, MaxBackoff: time.Hour, MaxAttempts: 3, Lease: time.Minute})
+	worker.now = func() time.Time { return now }
+
+	delivery := &domain.WebhookDelivery{WebhookID: "removed", StoreID: "s1", Status: domain.DeliveryPending, CreatedAt: now, NextAttemptAt: now}
+	assert.Nil(t, repo.EnqueueDeliveries(ctx, delivery))
+
+	_, err := worker.Drain(ctx)
+	assert.Nil(t, err)
+
+	deliveries, _ := repo.ListDeliveries(ctx, "s1", "removed", 10)
+	assert.Equal(t, domain.DeliveryDead, deliveries[0].Status)
+	assert.Equal(t, repository.ErrorNotFoundWebhook, deliveries[0].LastError)
+	assert.Empty(t, endpoint.requests)
+}
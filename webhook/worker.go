@@ -0,0 +1,114 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rokoga/filas-backend/domain"
+	"github.com/rokoga/filas-backend/logging"
+	"github.com/rokoga/filas-backend/outbox"
+	"github.com/rokoga/filas-backend/repository"
+	"github.com/sirupsen/logrus"
+)
+
+// Worker posts the pending deliveries to their webhooks
+type Worker struct {
+	repo   repository.WebhookRepository
+	sender Sender
+	opts   outbox.Options
+	now    func() time.Time
+}
+
+// NewWorker implements
+// Deliveries are polled, retried and dead lettered as opts tells, the same
+// way the outbox worker does for messages.
+func NewWorker(repo repository.WebhookRepository, sender Sender, opts outbox.Options) *Worker {
+	return &Worker{
+		repo:   repo,
+		sender: sender,
+		opts:   opts,
+		now:    time.Now,
+	}
+}
+
+// Run drains the deliveries every PollInterval until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.Drain(ctx); err != nil && ctx.Err() == nil {
+			logging.FromContext(ctx).WithError(err).Error("webhook drain failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Drain posts every delivery due now and returns how many were attempted
+func (w *Worker) Drain(ctx context.Context) (int, error) {
+	attempted := 0
+
+	for ctx.Err() == nil {
+		delivery, err := w.repo.ClaimDelivery(ctx, w.now().UTC(), w.opts.Lease)
+		if errors.Is(err, repository.ErrNoDueDeliveries) {
+			return attempted, nil
+		}
+		if err != nil {
+			return attempted, err
+		}
+
+		if err := w.deliver(ctx, delivery); err != nil {
+			return attempted, err
+		}
+		attempted++
+	}
+
+	return attempted, ctx.Err()
+}
+
+// deliver posts a claimed delivery and records the outcome. Only a failure
+// to record it is returned, the delivery itself is retried later.
+func (w *Worker) deliver(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	log := logging.FromContext(ctx).WithFields(logrus.Fields{
+		"delivery_id": delivery.ID,
+		"webhook_id":  delivery.WebhookID,
+		"store_id":    delivery.StoreID,
+		"event":       delivery.Event,
+	})
+
+	hook, err := w.repo.GetWebhook(ctx, delivery.StoreID, delivery.WebhookID)
+	if errors.Is(err, repository.ErrNotFoundWebhook) {
+		// Removed after the event, there is nowhere to send it
+		return w.repo.MarkDeliveryFailed(ctx, delivery.ID, 0, err.Error(), w.now().UTC(), true)
+	}
+	if err != nil {
+		return err
+	}
+
+	status, err := w.sender.Send(ctx, hook, delivery)
+	if err == nil {
+		return w.repo.MarkDelivered(ctx, delivery.ID, status, w.now().UTC())
+	}
+
+	if ctx.Err() != nil {
+		// Shutting down, the lock expires and the delivery is sent again
+		return ctx.Err()
+	}
+
+	attempts := delivery.Attempts + 1
+	dead := attempts >= w.opts.MaxAttempts
+	log = log.WithError(err).WithFields(logrus.Fields{"attempts": attempts, "status": status})
+	if dead {
+		log.Error("webhook delivery moved to dead letters")
+	} else {
+		log.Warn("webhook delivery failed, will retry")
+	}
+
+	return w.repo.MarkDeliveryFailed(ctx, delivery.ID, status, FailureReason(status, err), w.now().UTC().Add(w.opts.Wait(attempts)), dead)
+}